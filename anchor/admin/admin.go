@@ -0,0 +1,436 @@
+// Package admin provides an HTTP API for anchor operators to inspect
+// transfers and act on them.
+//
+// The Handler serves, relative to where it is mounted:
+//
+//	GET  /transfers                          list and search transfers
+//	GET  /transfers/{id}                     transfer with its history and notes
+//	GET  /transfers/{id}/history             audit trail
+//	GET  /transfers/{id}/notes               internal notes
+//	POST /transfers/{id}/notes               add a note {"body"}
+//	POST /transfers/{id}/deny                Deny {"reason"}
+//	POST /transfers/{id}/cancel              Cancel {"reason"}
+//	POST /transfers/{id}/funds-received      NotifyFundsReceived {"external_ref", "amount"}
+//	POST /transfers/{id}/disbursement-sent   NotifyDisbursementSent {"external_ref"}
+//
+// Every request is authenticated by the configured Authenticator, and
+// changes are recorded in the transfer history with the operator as actor.
+// Responses are JSON; errors are {"error": "..."}.
+package admin
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/anchor"
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+	maxRequestBytes = 64 << 10
+)
+
+// Config configures the admin Handler.
+type Config struct {
+	// Auth authenticates operators.
+	Auth Authenticator
+
+	// Optional: where notes are kept (default: the transfer store, if it
+	// implements stellarconnect.NoteStore; otherwise notes are disabled)
+	Notes stellarconnect.NoteStore
+}
+
+// Handler is the operator admin API. Mount it under a prefix with
+// http.StripPrefix, e.g. mux.Handle("/admin/", http.StripPrefix("/admin", h)).
+type Handler struct {
+	tm    *anchor.TransferManager
+	store stellarconnect.TransferStore
+	auth  Authenticator
+	notes stellarconnect.NoteStore
+	mux   *http.ServeMux
+}
+
+// NewHandler creates the admin API for the transfers in store, acting on
+// them through tm. Returns a CONFIG_INVALID error if tm, store, or
+// cfg.Auth is missing.
+func NewHandler(tm *anchor.TransferManager, store stellarconnect.TransferStore, cfg Config) (*Handler, error) {
+	if tm == nil || store == nil {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "transfer manager and store are required", nil)
+	}
+	if cfg.Auth == nil {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "operator authenticator is required", nil)
+	}
+	if cfg.Notes == nil {
+		cfg.Notes, _ = store.(stellarconnect.NoteStore)
+	}
+
+	h := &Handler{tm: tm, store: store, auth: cfg.Auth, notes: cfg.Notes, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /transfers", h.listTransfers)
+	h.mux.HandleFunc("GET /transfers/{id}", h.getTransfer)
+	h.mux.HandleFunc("GET /transfers/{id}/history", h.getHistory)
+	h.mux.HandleFunc("GET /transfers/{id}/notes", h.getNotes)
+	h.mux.HandleFunc("POST /transfers/{id}/notes", h.addNote)
+	h.mux.HandleFunc("POST /transfers/{id}/deny", h.deny)
+	h.mux.HandleFunc("POST /transfers/{id}/cancel", h.cancel)
+	h.mux.HandleFunc("POST /transfers/{id}/funds-received", h.fundsReceived)
+	h.mux.HandleFunc("POST /transfers/{id}/disbursement-sent", h.disbursementSent)
+	return h, nil
+}
+
+// ServeHTTP authenticates the operator and dispatches the request.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	operator, err := h.auth.Authenticate(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "operator authentication required")
+		return
+	}
+	ctx := anchor.WithActor(r.Context(), stellarconnect.Actor{Type: stellarconnect.ActorOperator, ID: operator})
+	ctx = context.WithValue(ctx, operatorContextKey{}, operator)
+	h.mux.ServeHTTP(w, r.WithContext(ctx))
+}
+
+type operatorContextKey struct{}
+
+// OperatorFromContext returns the operator authenticated for an admin
+// request.
+func OperatorFromContext(ctx context.Context) (string, bool) {
+	operator, ok := ctx.Value(operatorContextKey{}).(string)
+	return operator, ok
+}
+
+// listTransfers serves GET /transfers. Query parameters: status, kind,
+// account, asset, created_after, created_before (RFC 3339 or YYYY-MM-DD),
+// q (substring of the ID, account, external reference, Stellar transaction
+// hash, or memo), limit, and offset. Results are newest first.
+func (h *Handler) listTransfers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filters := stellarconnect.TransferFilters{
+		Account:   query.Get("account"),
+		AssetCode: query.Get("asset"),
+	}
+	if status := query.Get("status"); status != "" {
+		s := stellarconnect.TransferStatus(status)
+		filters.Status = &s
+	}
+	if kind := query.Get("kind"); kind != "" {
+		k := stellarconnect.TransferKind(kind)
+		filters.Kind = &k
+	}
+	var err error
+	if filters.CreatedAfter, err = ParseTime(query.Get("created_after")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid created_after: "+err.Error())
+		return
+	}
+	if filters.CreatedBefore, err = ParseTime(query.Get("created_before")); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid created_before: "+err.Error())
+		return
+	}
+	limit, err := parseInt(query.Get("limit"), defaultPageSize)
+	if err != nil || limit <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid limit")
+		return
+	}
+	limit = min(limit, maxPageSize)
+	offset, err := parseInt(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest, "invalid offset")
+		return
+	}
+
+	// Stores may not order or page results, so both are done here.
+	transfers, err := h.store.List(r.Context(), filters)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list transfers")
+		return
+	}
+	transfers = Search(transfers, query.Get("q"))
+
+	total := len(transfers)
+	page := transfers[min(offset, total):min(offset+limit, total)]
+	views := make([]TransferView, len(page))
+	for i, t := range page {
+		views[i] = NewTransferView(t)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"transfers": views,
+		"total":     total,
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
+
+// getTransfer serves GET /transfers/{id}. History and notes are included
+// when the store keeps them.
+func (h *Handler) getTransfer(w http.ResponseWriter, r *http.Request) {
+	transfer, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	response := map[string]any{"transfer": NewTransferView(transfer)}
+	if history, err := h.tm.History(r.Context(), transfer.ID); err == nil {
+		response["history"] = NewHistoryViews(history)
+	}
+	if h.notes != nil {
+		notes, err := h.notes.Notes(r.Context(), transfer.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to load notes")
+			return
+		}
+		response["notes"] = NewNoteViews(notes)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// getHistory serves GET /transfers/{id}/history.
+func (h *Handler) getHistory(w http.ResponseWriter, r *http.Request) {
+	transfer, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	history, err := h.tm.History(r.Context(), transfer.ID)
+	if err != nil {
+		writeSDKError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"history": NewHistoryViews(history)})
+}
+
+// getNotes serves GET /transfers/{id}/notes.
+func (h *Handler) getNotes(w http.ResponseWriter, r *http.Request) {
+	if h.notes == nil {
+		writeError(w, http.StatusNotImplemented, "transfer store does not keep notes")
+		return
+	}
+	transfer, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	notes, err := h.notes.Notes(r.Context(), transfer.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load notes")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"notes": NewNoteViews(notes)})
+}
+
+// addNote serves POST /transfers/{id}/notes.
+func (h *Handler) addNote(w http.ResponseWriter, r *http.Request) {
+	if h.notes == nil {
+		writeError(w, http.StatusNotImplemented, "transfer store does not keep notes")
+		return
+	}
+	var body struct {
+		Body string `json:"body"`
+	}
+	if !decode(w, r, &body) {
+		return
+	}
+	if strings.TrimSpace(body.Body) == "" {
+		writeError(w, http.StatusBadRequest, "body is required")
+		return
+	}
+	transfer, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	operator, _ := OperatorFromContext(r.Context())
+	note, err := h.notes.AddNote(r.Context(), stellarconnect.Note{
+		TransferID: transfer.ID,
+		Author:     operator,
+		Body:       body.Body,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to add note")
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"note": NewNoteView(*note)})
+}
+
+// deny serves POST /transfers/{id}/deny.
+func (h *Handler) deny(w http.ResponseWriter, r *http.Request) {
+	h.act(w, r, "", func(ctx context.Context, t *stellarconnect.Transfer, body actionRequest) error {
+		return h.tm.Deny(ctx, t.ID, body.Reason)
+	})
+}
+
+// cancel serves POST /transfers/{id}/cancel.
+func (h *Handler) cancel(w http.ResponseWriter, r *http.Request) {
+	h.act(w, r, "", func(ctx context.Context, t *stellarconnect.Transfer, body actionRequest) error {
+		return h.tm.Cancel(ctx, t.ID, body.Reason)
+	})
+}
+
+// fundsReceived serves POST /transfers/{id}/funds-received for deposits.
+// The external reference is kept if none is given.
+func (h *Handler) fundsReceived(w http.ResponseWriter, r *http.Request) {
+	h.act(w, r, stellarconnect.KindDeposit, func(ctx context.Context, t *stellarconnect.Transfer, body actionRequest) error {
+		return h.tm.NotifyFundsReceived(ctx, t.ID, anchor.FundsReceivedDetails{
+			ExternalRef: cmp.Or(body.ExternalRef, t.ExternalRef),
+			Amount:      body.Amount,
+		})
+	})
+}
+
+// disbursementSent serves POST /transfers/{id}/disbursement-sent for
+// withdrawals. The external reference is kept if none is given.
+func (h *Handler) disbursementSent(w http.ResponseWriter, r *http.Request) {
+	h.act(w, r, stellarconnect.KindWithdrawal, func(ctx context.Context, t *stellarconnect.Transfer, body actionRequest) error {
+		return h.tm.NotifyDisbursementSent(ctx, t.ID, anchor.DisbursementDetails{
+			ExternalRef: cmp.Or(body.ExternalRef, t.ExternalRef),
+		})
+	})
+}
+
+// actionRequest is the body of the action endpoints; each uses its own
+// fields.
+type actionRequest struct {
+	Reason      string `json:"reason"`
+	ExternalRef string `json:"external_ref"`
+	Amount      string `json:"amount"`
+}
+
+// act runs a TransferManager action and responds with the updated transfer.
+// A non-empty kind restricts the action to transfers of that kind.
+func (h *Handler) act(w http.ResponseWriter, r *http.Request, kind stellarconnect.TransferKind,
+	action func(context.Context, *stellarconnect.Transfer, actionRequest) error) {
+	var body actionRequest
+	if !decode(w, r, &body) {
+		return
+	}
+	transfer, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	if kind != "" && transfer.Kind != kind {
+		writeError(w, http.StatusConflict, "transfer is a "+string(transfer.Kind)+", not a "+string(kind))
+		return
+	}
+	if err := action(r.Context(), transfer, body); err != nil {
+		writeSDKError(w, err)
+		return
+	}
+	transfer, err := h.store.FindByID(r.Context(), transfer.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to reload transfer")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"transfer": NewTransferView(transfer)})
+}
+
+// load finds the transfer named in the path, responding 404 if it does not
+// exist.
+func (h *Handler) load(w http.ResponseWriter, r *http.Request) (*stellarconnect.Transfer, bool) {
+	transfer, err := h.store.FindByID(r.Context(), r.PathValue("id"))
+	if err != nil || transfer == nil {
+		writeError(w, http.StatusNotFound, "transfer not found")
+		return nil, false
+	}
+	return transfer, true
+}
+
+// Search returns the transfers whose ID, account, external reference,
+// transaction hash, or memo contains query, ignoring case, newest first.
+// An empty query keeps every transfer. transfers is reordered in place.
+func Search(transfers []*stellarconnect.Transfer, query string) []*stellarconnect.Transfer {
+	if search := strings.ToLower(strings.TrimSpace(query)); search != "" {
+		matched := transfers[:0]
+		for _, t := range transfers {
+			if matches(t, search) {
+				matched = append(matched, t)
+			}
+		}
+		transfers = matched
+	}
+	sort.Slice(transfers, func(i, j int) bool {
+		if !transfers[i].CreatedAt.Equal(transfers[j].CreatedAt) {
+			return transfers[i].CreatedAt.After(transfers[j].CreatedAt)
+		}
+		return transfers[i].ID < transfers[j].ID
+	})
+	return transfers
+}
+
+// matches reports whether a transfer's identifiers contain search, which
+// must be lowercase.
+func matches(t *stellarconnect.Transfer, search string) bool {
+	for _, field := range []string{t.ID, t.ExternalRef, t.StellarTxHash, t.Memo, t.Account} {
+		if field != "" && strings.Contains(strings.ToLower(field), search) {
+			return true
+		}
+	}
+	return false
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	body := http.MaxBytesReader(w, r.Body, maxRequestBytes)
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// ParseTime parses an RFC 3339 timestamp or a YYYY-MM-DD date; "" is the
+// zero time.
+func ParseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+func parseInt(s string, fallback int) (int, error) {
+	if s == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// writeSDKError maps SDK error codes to HTTP statuses.
+func writeSDKError(w http.ResponseWriter, err error) {
+	var sdkErr *errors.StellarConnectError
+	if !errors.As(err, &sdkErr) {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	status := http.StatusInternalServerError
+	switch sdkErr.Code {
+	case errors.TRANSFER_NOT_FOUND:
+		status = http.StatusNotFound
+	case errors.TRANSITION_INVALID, errors.VERSION_CONFLICT, errors.LOCK_FAILED:
+		status = http.StatusConflict
+	case errors.PAYMENT_MISMATCH, errors.INVALID_ASSET:
+		status = http.StatusUnprocessableEntity
+	case errors.CONFIG_INVALID:
+		status = http.StatusNotImplemented
+	}
+	writeJSON(w, status, map[string]string{"error": sdkErr.Message, "code": string(sdkErr.Code)})
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Verify that Handler implements http.Handler
+var _ http.Handler = (*Handler)(nil)
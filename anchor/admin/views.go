@@ -0,0 +1,135 @@
+package admin
+
+import (
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/core/amount"
+)
+
+// TransferView is the JSON form of a transfer, as served by the Handler and
+// printed by anchorctl. The interactive token is omitted: it is a credential
+// for the user's session.
+type TransferView struct {
+	ID                 string         `json:"id"`
+	Kind               string         `json:"kind"`
+	Mode               string         `json:"mode"`
+	Status             string         `json:"status"`
+	AssetCode          string         `json:"asset_code"`
+	AssetIssuer        string         `json:"asset_issuer,omitempty"`
+	Account            string         `json:"account"`
+	Amount             amount.Amount  `json:"amount,omitzero"`
+	AmountReceived     amount.Amount  `json:"amount_received,omitzero"`
+	ExternalRef        string         `json:"external_ref,omitempty"`
+	StellarTxHash      string         `json:"stellar_tx_hash,omitempty"`
+	Memo               string         `json:"memo,omitempty"`
+	MemoType           string         `json:"memo_type,omitempty"`
+	MuxID              uint64         `json:"mux_id,omitempty"`
+	DepositMemo        string         `json:"deposit_memo,omitempty"`
+	DepositMemoType    string         `json:"deposit_memo_type,omitempty"`
+	ClaimableBalanceID string         `json:"claimable_balance_id,omitempty"`
+	OnChangeCallback   string         `json:"on_change_callback,omitempty"`
+	Message            string         `json:"message,omitempty"`
+	Metadata           map[string]any `json:"metadata,omitempty"`
+	Version            int64          `json:"version"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	CompletedAt        *time.Time     `json:"completed_at,omitempty"`
+}
+
+// NewTransferView returns the view of t.
+func NewTransferView(t *stellarconnect.Transfer) TransferView {
+	return TransferView{
+		ID:                 t.ID,
+		Kind:               string(t.Kind),
+		Mode:               string(t.Mode),
+		Status:             string(t.Status),
+		AssetCode:          t.AssetCode,
+		AssetIssuer:        t.AssetIssuer,
+		Account:            t.Account,
+		Amount:             t.Amount,
+		AmountReceived:     t.AmountReceived,
+		ExternalRef:        t.ExternalRef,
+		StellarTxHash:      t.StellarTxHash,
+		Memo:               t.Memo,
+		MemoType:           string(t.MemoType),
+		MuxID:              t.MuxID,
+		DepositMemo:        t.DepositMemo,
+		DepositMemoType:    string(t.DepositMemoType),
+		ClaimableBalanceID: t.ClaimableBalanceID,
+		OnChangeCallback:   t.OnChangeCallback,
+		Message:            t.Message,
+		Metadata:           t.Metadata,
+		Version:            t.Version,
+		CreatedAt:          t.CreatedAt,
+		UpdatedAt:          t.UpdatedAt,
+		CompletedAt:        t.CompletedAt,
+	}
+}
+
+// ActorView is the JSON form of a stellarconnect.Actor.
+type ActorView struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+}
+
+// ChangeView is the JSON form of a stellarconnect.FieldChange.
+type ChangeView struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// HistoryView is the JSON form of a history entry.
+type HistoryView struct {
+	ID         string       `json:"id"`
+	FromStatus string       `json:"from_status,omitempty"`
+	ToStatus   string       `json:"to_status"`
+	Actor      ActorView    `json:"actor"`
+	Reason     string       `json:"reason,omitempty"`
+	Changes    []ChangeView `json:"changes,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// NewHistoryViews returns the views of entries, in order.
+func NewHistoryViews(entries []stellarconnect.HistoryEntry) []HistoryView {
+	views := make([]HistoryView, len(entries))
+	for i, e := range entries {
+		changes := make([]ChangeView, len(e.Changes))
+		for j, c := range e.Changes {
+			changes[j] = ChangeView{Field: c.Field, From: c.From, To: c.To}
+		}
+		views[i] = HistoryView{
+			ID:         e.ID,
+			FromStatus: string(e.FromStatus),
+			ToStatus:   string(e.ToStatus),
+			Actor:      ActorView{Type: string(e.Actor.Type), ID: e.Actor.ID},
+			Reason:     e.Reason,
+			Changes:    changes,
+			CreatedAt:  e.CreatedAt,
+		}
+	}
+	return views
+}
+
+// NoteView is the JSON form of a note.
+type NoteView struct {
+	ID        string    `json:"id"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewNoteView returns the view of n.
+func NewNoteView(n stellarconnect.Note) NoteView {
+	return NoteView{ID: n.ID, Author: n.Author, Body: n.Body, CreatedAt: n.CreatedAt}
+}
+
+// NewNoteViews returns the views of notes, in order.
+func NewNoteViews(notes []stellarconnect.Note) []NoteView {
+	views := make([]NoteView, len(notes))
+	for i, n := range notes {
+		views[i] = NewNoteView(n)
+	}
+	return views
+}
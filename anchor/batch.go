@@ -0,0 +1,254 @@
+package anchor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/stellar/go/txnbuild"
+)
+
+// maxBatchOps is the most operations a Stellar transaction may contain.
+const maxBatchOps = 100
+
+// batchable reports whether a deposit can share a transaction with others.
+// Deposits with a memo need a transaction of their own, and deposits with a
+// transaction already pending are resolved one by one.
+func (w *PayoutWorker) batchable(transfer *stellarconnect.Transfer, payout *stellarconnect.PayoutState) bool {
+	return w.batchOps > 1 && transfer.DepositMemo == "" && payout.Envelope == ""
+}
+
+// processBatchLocked pays out the given deposits in shared transactions,
+// skipping those whose payout lock is held by another worker.
+func (w *PayoutWorker) processBatchLocked(ctx context.Context, transferIDs []string) (int, error) {
+	locked := make([]string, 0, len(transferIDs))
+	for _, id := range transferIDs {
+		lease, err := w.tryLock(ctx, id)
+		if err != nil {
+			continue
+		}
+		defer lease.Release(ctx)
+		locked = append(locked, id)
+	}
+	if len(locked) == 0 {
+		return 0, nil
+	}
+	return w.processBatch(ctx, locked)
+}
+
+// processBatch pays out deposits with one payment operation each in a single
+// transaction, recording the transaction on every transfer before it is
+// submitted. If the transaction fails because of some of its operations,
+// those transfers are dealt with as in process, by switching to a claimable
+// balance, moving to pending_trust, or holding, and the rest are paid in a
+// new transaction. A submission with an unknown outcome leaves the
+// transaction recorded on each transfer for process to resolve. The caller
+// must hold the payout lock of each transfer. Returns how many were
+// completed or moved to pending_trust; the first error is returned.
+func (w *PayoutWorker) processBatch(ctx context.Context, transferIDs []string) (int, error) {
+	handled := 0
+	var firstErr error
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for attempt := 0; attempt < maxPayoutSubmissions; attempt++ {
+		transfers, payouts, ops, parked, err := w.prepareBatch(ctx, transferIDs)
+		handled += parked
+		if err != nil {
+			fail(err)
+		}
+		if len(transfers) == 0 {
+			return handled, firstErr
+		}
+		ids := make([]string, len(transfers))
+		for i, transfer := range transfers {
+			ids[i] = transfer.ID
+		}
+		label := strings.Join(ids, ",")
+
+		channel, envelope, hash, expiresAt, err := w.assemble(ctx, label, ops, nil)
+		if err != nil {
+			fail(err)
+			return handled, firstErr
+		}
+		// Persist on every transfer before submitting, as in process.
+		for i, id := range ids {
+			err := w.updatePayout(ctx, id, func(p *stellarconnect.PayoutState) {
+				p.TxHash, p.Envelope, p.ExpiresAt, p.OpIndex = hash, envelope, expiresAt, i
+				p.Channel = channelAccount(channel)
+			})
+			if err != nil {
+				for _, recorded := range ids[:i] {
+					_ = w.clearPending(ctx, recorded)
+				}
+				if channel != nil {
+					channel.Discard()
+				}
+				fail(err)
+				return handled, firstErr
+			}
+		}
+
+		result, err := w.submitter.SubmitTransaction(ctx, envelope)
+		w.endLease(channel, err, expiresAt)
+		if err == nil {
+			return w.finishBatch(ctx, ids, envelope, result, handled, firstErr)
+		}
+		submitErr, rejected := stellarconnect.AsSubmitError(err)
+		if !rejected {
+			fail(payoutError(label, "batch payout submission outcome unknown; it will be checked and resubmitted", err))
+			return handled, firstErr
+		}
+		if submitErr.TransactionCode == "tx_insufficient_fee" && w.feeAccount != nil {
+			// Still valid; process fee-bumps it on the next poll.
+			fail(payoutError(label, "batch payout fee too low; it will be fee-bumped", submitErr))
+			return handled, firstErr
+		}
+
+		if submitErr.TransactionCode == "tx_failed" {
+			// Nothing was applied. Isolate the failing operations and pay
+			// the rest again.
+			retry := ids[:0:0]
+			for i, transfer := range transfers {
+				if err := w.clearPending(ctx, transfer.ID); err != nil {
+					fail(err)
+					continue
+				}
+				code := operationCode(submitErr, i)
+				switch {
+				case code == "" || code == "op_success":
+					retry = append(retry, transfer.ID)
+				case code == "op_no_trust" && transfer.ClaimableBalanceSupported && !payouts[i].Claimable:
+					if err := w.updatePayout(ctx, transfer.ID, func(p *stellarconnect.PayoutState) { p.Claimable = true }); err != nil {
+						fail(err)
+						continue
+					}
+					retry = append(retry, transfer.ID)
+				case code == "op_no_trust" && !transfer.ClaimableBalanceSupported:
+					if err := w.tm.NotifyTrustlineRequired(ctx, transfer.ID); err != nil {
+						fail(err)
+						continue
+					}
+					handled++
+				default:
+					fail(w.hold(ctx, transfer.ID, fmt.Sprintf("payment failed with %s", code), submitErr))
+				}
+			}
+			transferIDs = retry
+			continue
+		}
+		if !w.rebuildable(submitErr) {
+			for _, id := range ids {
+				fail(w.hold(ctx, id, submitErr.Error(), submitErr))
+			}
+			return handled, firstErr
+		}
+		// The envelope can no longer be applied, unless it already was.
+		result, err = w.submitter.TransactionStatus(ctx, hash)
+		if err != nil {
+			fail(payoutError(label, "failed to check rejected batch payout transaction", err))
+			return handled, firstErr
+		}
+		if result != nil {
+			return w.finishBatch(ctx, ids, envelope, result, handled, firstErr)
+		}
+		for _, id := range ids {
+			if err := w.clearPending(ctx, id); err != nil {
+				fail(err)
+			}
+		}
+		transferIDs = ids
+	}
+	if len(transferIDs) > 0 {
+		fail(payoutError(strings.Join(transferIDs, ","), fmt.Sprintf("batch payout not accepted after %d submissions", maxPayoutSubmissions), nil))
+	}
+	return handled, firstErr
+}
+
+// prepareBatch reloads the given deposits and returns those that can be
+// paid in a shared transaction, with their payout states and operations. Deposits whose user
+// cannot receive the asset are switched to a claimable balance or moved to
+// pending_trust (counted in parked); deposits that cannot be paid are held.
+// Deposits that are no longer eligible are skipped.
+func (w *PayoutWorker) prepareBatch(ctx context.Context, transferIDs []string) (transfers []*stellarconnect.Transfer, payouts []*stellarconnect.PayoutState, ops []txnbuild.Operation, parked int, err error) {
+	fail := func(e error) {
+		if err == nil {
+			err = e
+		}
+	}
+	for _, id := range transferIDs {
+		transfer, loadErr := w.tm.store.FindByID(ctx, id)
+		if loadErr != nil {
+			fail(payoutError(id, "failed to load transfer", loadErr))
+			continue
+		}
+		payout, loadErr := w.payout(ctx, id)
+		if loadErr != nil {
+			fail(loadErr)
+			continue
+		}
+		if transfer.Kind != stellarconnect.KindDeposit || transfer.Status != stellarconnect.StatusPendingStellar ||
+			payout.Error != "" || !w.batchable(transfer, payout) {
+			continue
+		}
+		if !payout.Claimable {
+			trusted, trustErr := w.trusted(ctx, transfer)
+			if trustErr != nil {
+				fail(trustErr)
+				continue
+			}
+			if !trusted && !transfer.ClaimableBalanceSupported {
+				if e := w.tm.NotifyTrustlineRequired(ctx, transfer.ID); e != nil {
+					fail(e)
+					continue
+				}
+				parked++
+				continue
+			}
+			if !trusted {
+				if e := w.updatePayout(ctx, transfer.ID, func(p *stellarconnect.PayoutState) { p.Claimable = true }); e != nil {
+					fail(e)
+					continue
+				}
+				payout.Claimable = true
+			}
+		}
+		op, opErr := w.operation(ctx, transfer, payout)
+		if opErr != nil {
+			fail(opErr)
+			continue
+		}
+		transfers = append(transfers, transfer)
+		payouts = append(payouts, payout)
+		ops = append(ops, op)
+	}
+	return transfers, payouts, ops, parked, err
+}
+
+// finishBatch completes every transfer paid by an applied batch transaction,
+// adding to the handled count and first error so far.
+func (w *PayoutWorker) finishBatch(ctx context.Context, transferIDs []string, envelope string, result *stellarconnect.SubmitResult, handled int, firstErr error) (int, error) {
+	for i, id := range transferIDs {
+		if err := w.finish(ctx, id, envelope, i, result); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		handled++
+	}
+	return handled, firstErr
+}
+
+// operationCode returns the result code of operation i of a rejected
+// transaction, or "" if it is not reported.
+func operationCode(err *stellarconnect.SubmitError, i int) string {
+	if i < len(err.OperationCodes) {
+		return err.OperationCodes[i]
+	}
+	return ""
+}
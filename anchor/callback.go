@@ -0,0 +1,406 @@
+package anchor
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+)
+
+const (
+	defaultCallbackTimeout        = 10 * time.Second
+	defaultCallbackMaxAttempts    = 5
+	defaultCallbackInitialBackoff = time.Second
+	defaultCallbackMaxBackoff     = time.Minute
+	defaultCallbackLogSize        = 1000
+
+	// postMessageCallback is the on_change_callback value asking for
+	// window.postMessage notifications, which only the interactive page can
+	// send.
+	postMessageCallback = "postMessage"
+)
+
+// CallbackConfig configures a CallbackNotifier.
+type CallbackConfig struct {
+	Signer         stellarconnect.CallbackSigner                               // Required: the anchor's SIGNING_KEY (see signers.CallbackSignerFromSecret)
+	HTTPClient     *http.Client                                                // Optional: client for callback requests; must refuse private addresses itself (default: 10s timeout, public addresses only)
+	MaxAttempts    int                                                         // Optional: attempts per notification before giving up (default: 5)
+	InitialBackoff time.Duration                                               // Optional: wait before the first retry, doubled on each retry (default: 1s)
+	MaxBackoff     time.Duration                                               // Optional: upper bound of the wait between retries (default: 1m)
+	LogSize        int                                                         // Optional: delivery attempts kept for Deliveries (default: 1000)
+	Payload        func(*stellarconnect.Transfer, *TransferStatusResponse) any // Optional: request body for a transfer (default: {"transaction": <resp>})
+}
+
+// CallbackDelivery records one attempt to notify a wallet.
+type CallbackDelivery struct {
+	TransferID string
+	URL        string
+	Status     stellarconnect.TransferStatus // Transfer status being notified
+	Attempt    int
+	StatusCode int    // HTTP status of the response; 0 if none was received
+	Error      string // Why the attempt failed; empty if Delivered
+	Delivered  bool
+	Superseded bool // Retries were abandoned for a newer status of the same transfer
+	At         time.Time
+}
+
+// CallbackNotifier POSTs a transfer to the wallet's on_change_callback URL
+// whenever HookTransferStatusChanged fires, as SEP-24 specifies.
+//
+// Each request carries a Signature header of the form "t=<unix time>,
+// s=<base64 signature>", where the signature covers "<t>.<callback
+// host>.<body>" and is made with the anchor's signing key, so wallets can
+// verify it against SIGNING_KEY in stellar.toml. The same value is sent as
+// X-Stellar-Signature for wallets implementing earlier SEP-24 versions.
+//
+// Notifications run in the background, one at a time per transfer and in
+// status order. Failed requests (network errors and non-2xx responses) are
+// retried with exponential backoff up to MaxAttempts. If the transfer
+// changes again while a notification is being retried, the retries are
+// abandoned in favour of the newer status, since each callback carries the
+// whole transaction. Every attempt is recorded in a bounded delivery log.
+type CallbackNotifier struct {
+	tm             *TransferManager
+	signer         stellarconnect.CallbackSigner
+	client         *http.Client
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	logSize        int
+	payload        func(*stellarconnect.Transfer, *TransferStatusResponse) any
+
+	ctx         context.Context
+	cancel      context.CancelFunc
+	unsubscribe func()
+	wg          sync.WaitGroup
+
+	mu     sync.Mutex
+	queues map[string]*callbackQueue
+	log    []CallbackDelivery
+}
+
+// callbackRequest is a rendered notification waiting to be sent.
+type callbackRequest struct {
+	transferID string
+	url        string
+	status     stellarconnect.TransferStatus
+	body       []byte
+}
+
+// callbackQueue holds the next notification for a transfer. A newer
+// notification replaces one that has not been sent yet.
+type callbackQueue struct {
+	pending *callbackRequest
+}
+
+// NewCallbackNotifier creates a notifier and subscribes it to
+// HookTransferStatusChanged on the manager's HookRegistry. Call Close on
+// shutdown to stop pending retries.
+func NewCallbackNotifier(tm *TransferManager, config CallbackConfig) (*CallbackNotifier, error) {
+	if tm == nil {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "transfer manager is required", nil)
+	}
+	if config.Signer == nil {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "signer is required", nil)
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = callbackClient(tm.config.InsecureCallbacks)
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultCallbackMaxAttempts
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = defaultCallbackInitialBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaultCallbackMaxBackoff
+	}
+	if config.LogSize <= 0 {
+		config.LogSize = defaultCallbackLogSize
+	}
+	if config.Payload == nil {
+		config.Payload = func(_ *stellarconnect.Transfer, resp *TransferStatusResponse) any {
+			return map[string]any{"transaction": resp}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &CallbackNotifier{
+		tm:             tm,
+		signer:         config.Signer,
+		client:         config.HTTPClient,
+		maxAttempts:    config.MaxAttempts,
+		initialBackoff: config.InitialBackoff,
+		maxBackoff:     config.MaxBackoff,
+		logSize:        config.LogSize,
+		payload:        config.Payload,
+		ctx:            ctx,
+		cancel:         cancel,
+		queues:         make(map[string]*callbackQueue),
+	}
+	n.unsubscribe = tm.hooks.On(HookTransferStatusChanged, func(_ context.Context, event *HookEnvelope) error {
+		n.Notify(event.Transfer)
+		return nil
+	})
+	return n, nil
+}
+
+// Notify queues a notification of the transfer's current state to its
+// on_change_callback. Transfers without a callback URL, or asking for
+// postMessage, are ignored. Notify is the HookTransferStatusChanged handler;
+// call it directly to resend a notification.
+func (n *CallbackNotifier) Notify(transfer *stellarconnect.Transfer) {
+	if transfer == nil || transfer.OnChangeCallback == "" || transfer.OnChangeCallback == postMessageCallback {
+		return
+	}
+	req := &callbackRequest{
+		transferID: transfer.ID,
+		url:        transfer.OnChangeCallback,
+		status:     transfer.Status,
+	}
+	body, err := json.Marshal(n.payload(transfer, n.tm.statusResponse(transfer)))
+	if err != nil {
+		n.record(req, 0, 0, fmt.Errorf("failed to encode payload: %w", err), false)
+		return
+	}
+	req.body = body
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ctx.Err() != nil {
+		return
+	}
+	if queue, running := n.queues[req.transferID]; running {
+		queue.pending = req
+		return
+	}
+	n.queues[req.transferID] = &callbackQueue{pending: req}
+	n.wg.Add(1)
+	go n.drain(req.transferID)
+}
+
+// Deliveries returns the logged attempts for a transfer, oldest first, or
+// all logged attempts if transferID is empty.
+func (n *CallbackNotifier) Deliveries(transferID string) []CallbackDelivery {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var result []CallbackDelivery
+	for _, d := range n.log {
+		if transferID == "" || d.TransferID == transferID {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// Close unsubscribes the notifier, stops retries, and waits for requests in
+// flight to finish. Notifications queued afterwards are ignored.
+func (n *CallbackNotifier) Close() {
+	n.unsubscribe()
+	n.mu.Lock()
+	n.cancel()
+	n.mu.Unlock()
+	n.wg.Wait()
+}
+
+// drain sends a transfer's notifications until its queue is empty.
+func (n *CallbackNotifier) drain(transferID string) {
+	defer n.wg.Done()
+	for {
+		n.mu.Lock()
+		queue := n.queues[transferID]
+		req := queue.pending
+		queue.pending = nil
+		if req == nil || n.ctx.Err() != nil {
+			delete(n.queues, transferID)
+			n.mu.Unlock()
+			return
+		}
+		n.mu.Unlock()
+		n.deliver(req)
+	}
+}
+
+// deliver sends one notification, retrying with backoff until it succeeds,
+// attempts run out, or a newer notification for the transfer is queued.
+func (n *CallbackNotifier) deliver(req *callbackRequest) {
+	backoff := n.initialBackoff
+	for attempt := 1; ; attempt++ {
+		code, err := n.send(req)
+		if err == nil {
+			n.record(req, attempt, code, nil, false)
+			return
+		}
+		if attempt >= n.maxAttempts {
+			n.record(req, attempt, code, err, false)
+			return
+		}
+		if n.superseded(req.transferID) {
+			n.record(req, attempt, code, err, true)
+			return
+		}
+		n.record(req, attempt, code, err, false)
+
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, n.maxBackoff)
+	}
+}
+
+// send makes one signed request and returns the HTTP status code.
+func (n *CallbackNotifier) send(req *callbackRequest) (int, error) {
+	if err := validateCallbackURL(req.url, n.tm.config.InsecureCallbacks); err != nil {
+		return 0, fmt.Errorf("invalid callback URL: %w", err)
+	}
+	target, err := url.Parse(req.url)
+	if err != nil {
+		return 0, fmt.Errorf("invalid callback URL: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature, err := n.signer.SignCallback(n.ctx, []byte(timestamp+"."+target.Host+"."+string(req.body)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to sign callback: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(n.ctx, http.MethodPost, req.url, bytes.NewReader(req.body))
+	if err != nil {
+		return 0, err
+	}
+	header := "t=" + timestamp + ", s=" + base64.StdEncoding.EncodeToString(signature)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Signature", header)
+	httpReq.Header.Set("X-Stellar-Signature", header)
+
+	resp, err := n.client.Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("callback returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// superseded reports whether a newer notification is queued for the transfer.
+func (n *CallbackNotifier) superseded(transferID string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	queue, ok := n.queues[transferID]
+	return ok && queue.pending != nil
+}
+
+// record appends an attempt to the delivery log, dropping the oldest entries
+// beyond the log size.
+func (n *CallbackNotifier) record(req *callbackRequest, attempt, code int, err error, superseded bool) {
+	d := CallbackDelivery{
+		TransferID: req.transferID,
+		URL:        req.url,
+		Status:     req.status,
+		Attempt:    attempt,
+		StatusCode: code,
+		Delivered:  err == nil,
+		Superseded: superseded,
+		At:         time.Now(),
+	}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.log = append(n.log, d)
+	if len(n.log) > n.logSize {
+		n.log = append(n.log[:0], n.log[len(n.log)-n.logSize:]...)
+	}
+}
+
+// validateCallbackURL accepts an empty callback, postMessage, or an absolute
+// https URL whose host is not localhost or a non-public IP address. With
+// insecure set, http URLs and any host are accepted. Host names are checked
+// again when the callback connects, since DNS can change.
+func validateCallbackURL(callback string, insecure bool) error {
+	if callback == "" || callback == postMessageCallback {
+		return nil
+	}
+	u, err := url.Parse(callback)
+	if err != nil {
+		return err
+	}
+	if insecure {
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("callback must be an absolute http(s) URL or %q", postMessageCallback)
+		}
+		return nil
+	}
+	if u.Scheme != "https" || u.Hostname() == "" {
+		return fmt.Errorf("callback must be an absolute https URL or %q", postMessageCallback)
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("callback host %s is not public", u.Hostname())
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !publicAddress(ip) {
+		return fmt.Errorf("callback host %s is not public", u.Hostname())
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), which
+// netip does not count as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddress reports whether ip is a globally routable unicast address:
+// not loopback, private, link-local (including the 169.254.169.254 cloud
+// metadata endpoint), shared, unspecified, or multicast.
+func publicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// callbackClient returns the default client for callback requests. Unless
+// insecure is set, its dialer refuses non-public addresses when connecting,
+// so a callback host that resolves, or is re-pointed, to the anchor's
+// network is never reached. Redirects are dialed the same way.
+func callbackClient(insecure bool) *http.Client {
+	if insecure {
+		return &http.Client{Timeout: defaultCallbackTimeout}
+	}
+	dialer := &net.Dialer{
+		Timeout: defaultCallbackTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			ip, err := netip.ParseAddrPort(address)
+			if err != nil || !publicAddress(ip.Addr()) {
+				return fmt.Errorf("callback address %s is not public", address)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: defaultCallbackTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			TLSHandshakeTimeout: defaultCallbackTimeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
@@ -0,0 +1,304 @@
+package anchor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+)
+
+// ChannelPool hands out channel accounts so that transactions from one
+// distribution account can be submitted concurrently. Each transaction uses a
+// channel account as its source, and so its sequence number, while its
+// operations keep the distribution account as their source.
+//
+// Sequence numbers are tracked locally and loaded from the network only when
+// a channel is first used or after a submission leaves it uncertain. Channels
+// must be funded to pay fees. A pool is in-process: separate processes need
+// separate channel accounts.
+//
+// A channel whose transaction may still be applied is held: it is not leased
+// again until the transaction is settled or its hold expires, so no other
+// transaction is built on the same sequence number.
+type ChannelPool struct {
+	submitter  stellarconnect.TransactionSubmitter
+	passphrase string
+	channels   []*channel
+	mu         sync.Mutex
+	wake       chan struct{} // closed and replaced when a channel may have become free
+}
+
+// channel is a channel account and its locally tracked sequence number.
+// seq and synced are only accessed by the holder of its lease; the other
+// fields are guarded by the pool's mutex.
+type channel struct {
+	signer    stellarconnect.Signer
+	seq       int64
+	synced    bool
+	leased    bool
+	heldUntil time.Time // not leased before this while a transaction may be pending
+	stale     bool      // reload the sequence number on next lease
+}
+
+// NewChannelPool creates a pool of the channel accounts controlled by the
+// given signers. Returns a CONFIG_INVALID error if no channels are given or a
+// channel account appears twice.
+func NewChannelPool(submitter stellarconnect.TransactionSubmitter, networkPassphrase string, channels ...stellarconnect.Signer) (*ChannelPool, error) {
+	if submitter == nil {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "submitter is required", nil)
+	}
+	if len(channels) == 0 {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "at least one channel account is required", nil)
+	}
+
+	p := &ChannelPool{
+		submitter:  submitter,
+		passphrase: networkPassphrase,
+		wake:       make(chan struct{}),
+	}
+	seen := make(map[string]bool, len(channels))
+	for _, signer := range channels {
+		account := signer.PublicKey()
+		if seen[account] {
+			return nil, errors.NewAnchorError(errors.CONFIG_INVALID, fmt.Sprintf("duplicate channel account %s", account), nil)
+		}
+		seen[account] = true
+		p.channels = append(p.channels, &channel{signer: signer})
+	}
+	return p, nil
+}
+
+// Size returns the number of channel accounts in the pool.
+func (p *ChannelPool) Size() int {
+	return len(p.channels)
+}
+
+// Acquire leases an idle channel, blocking until one is free or ctx is done.
+// Held channels are skipped until they are settled or their hold expires; if
+// every channel is held, Acquire fails at once rather than wait for a hold to
+// expire. The lease must be ended with Release, Discard, or Hold.
+func (p *ChannelPool) Acquire(ctx context.Context) (*ChannelLease, error) {
+	for {
+		p.mu.Lock()
+		ch, busy, next := p.takeLocked(time.Now())
+		wake := p.wake
+		p.mu.Unlock()
+		if ch != nil {
+			return &ChannelLease{pool: p, ch: ch}, nil
+		}
+		if !busy {
+			return nil, errors.NewAnchorError(errors.LOCK_FAILED, "all channel accounts are held by pending transactions", nil)
+		}
+
+		var expired <-chan time.Time
+		var timer *time.Timer
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			expired = timer.C
+		}
+		select {
+		case <-wake:
+		case <-expired:
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return nil, errors.NewAnchorError(errors.LOCK_FAILED, "no channel account available", ctx.Err())
+		}
+	}
+}
+
+// takeLocked leases the first free channel. If none is free it reports
+// whether any channel is leased, and so will be returned soon, and the
+// earliest time a hold expires, or zero if none is held. The caller must hold
+// the mutex.
+func (p *ChannelPool) takeLocked(now time.Time) (ch *channel, busy bool, next time.Time) {
+	for _, ch := range p.channels {
+		if ch.leased {
+			busy = true
+			continue
+		}
+		if now.Before(ch.heldUntil) {
+			if next.IsZero() || ch.heldUntil.Before(next) {
+				next = ch.heldUntil
+			}
+			continue
+		}
+		ch.leased = true
+		ch.heldUntil = time.Time{}
+		if ch.stale {
+			ch.synced = false
+			ch.stale = false
+		}
+		return ch, true, time.Time{}
+	}
+	return nil, busy, next
+}
+
+// Hold keeps a channel from being leased until the given time, or until
+// Settle, because a transaction using it may still be applied. A channel that
+// is leased at the time is held once its lease ends. Its sequence number is
+// reloaded on next use. Unknown accounts are ignored.
+func (p *ChannelPool) Hold(account string, until time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if ch := p.find(account); ch != nil {
+		p.holdLocked(ch, until)
+	}
+}
+
+// Settle releases a held channel once its transaction has been applied or
+// can no longer be. Unknown accounts are ignored.
+func (p *ChannelPool) Settle(account string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if ch := p.find(account); ch != nil {
+		ch.heldUntil = time.Time{}
+		p.wakeLocked()
+	}
+}
+
+// find returns the channel for an account, or nil.
+func (p *ChannelPool) find(account string) *channel {
+	for _, ch := range p.channels {
+		if ch.signer.PublicKey() == account {
+			return ch
+		}
+	}
+	return nil
+}
+
+// holdLocked extends a channel's hold. The caller must hold the mutex.
+func (p *ChannelPool) holdLocked(ch *channel, until time.Time) {
+	if until.After(ch.heldUntil) {
+		ch.heldUntil = until
+	}
+	ch.stale = true
+	// Waiters recompute when the next hold expires.
+	p.wakeLocked()
+}
+
+// put ends a lease. The caller must not hold the mutex.
+func (p *ChannelPool) put(ch *channel) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ch.leased = false
+	p.wakeLocked()
+}
+
+// wakeLocked wakes every Acquire waiting for a channel. The caller must hold
+// the mutex.
+func (p *ChannelPool) wakeLocked() {
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
+
+// ChannelLease is exclusive use of one channel account from a ChannelPool.
+type ChannelLease struct {
+	pool *ChannelPool
+	ch   *channel
+	used bool
+	once sync.Once
+}
+
+// Account returns the channel account to use as the transaction source.
+func (l *ChannelLease) Account() string {
+	return l.ch.signer.PublicKey()
+}
+
+// Sequence returns the channel's current sequence number, loading it from the
+// network if it is not known. Build the transaction with this value and
+// IncrementSequenceNum set, as for a freshly loaded account.
+func (l *ChannelLease) Sequence(ctx context.Context) (int64, error) {
+	if !l.ch.synced {
+		seq, err := l.pool.submitter.SequenceNumber(ctx, l.Account())
+		if err != nil {
+			return 0, errors.NewAnchorError(errors.NETWORK_ERROR, "failed to load channel account sequence", err)
+		}
+		l.ch.seq = seq
+		l.ch.synced = true
+	}
+	l.used = true
+	return l.ch.seq, nil
+}
+
+// Sign signs a transaction envelope (base64 XDR) with the channel account and
+// then with each of the given signers, typically the distribution account.
+func (l *ChannelLease) Sign(ctx context.Context, envelopeXDR string, signers ...stellarconnect.Signer) (string, error) {
+	signed, err := l.ch.signer.SignTransaction(ctx, envelopeXDR, l.pool.passphrase)
+	if err != nil {
+		return "", fmt.Errorf("channel %s failed to sign: %w", l.Account(), err)
+	}
+	for _, signer := range signers {
+		signed, err = signer.SignTransaction(ctx, signed, l.pool.passphrase)
+		if err != nil {
+			return "", fmt.Errorf("signer %s failed to sign: %w", signer.PublicKey(), err)
+		}
+	}
+	return signed, nil
+}
+
+// Release returns the channel to the pool after a submission. submitErr is
+// the outcome of SubmitTransaction: nil if the transaction was applied.
+// A tx_bad_seq rejection or an unknown outcome makes the channel reload its
+// sequence number on next use. Release, Discard, and Hold are no-ops after
+// the first call.
+func (l *ChannelLease) Release(submitErr error) {
+	l.once.Do(func() {
+		if l.used {
+			l.ch.advance(submitErr)
+		}
+		l.pool.put(l.ch)
+	})
+}
+
+// Discard returns the channel to the pool when no transaction using its
+// sequence number was submitted.
+func (l *ChannelLease) Discard() {
+	l.once.Do(func() {
+		l.pool.put(l.ch)
+	})
+}
+
+// Hold ends the lease after a submission whose transaction may still be
+// applied, such as one with an unknown outcome. The channel is not leased
+// again until the pool's Settle is called for it or until the given time,
+// typically the transaction's expiry.
+func (l *ChannelLease) Hold(until time.Time) {
+	l.once.Do(func() {
+		l.pool.mu.Lock()
+		defer l.pool.mu.Unlock()
+
+		l.ch.leased = false
+		l.pool.holdLocked(l.ch, until)
+	})
+}
+
+// advance updates the tracked sequence number after a submission.
+func (ch *channel) advance(submitErr error) {
+	if submitErr == nil {
+		ch.seq++
+		return
+	}
+	rejection, ok := stellarconnect.AsSubmitError(submitErr)
+	if !ok {
+		// The transaction may or may not have been applied.
+		ch.synced = false
+		return
+	}
+	switch rejection.TransactionCode {
+	case "tx_bad_seq":
+		ch.synced = false
+	case "tx_failed":
+		// Applied with failed operations; the sequence number was consumed.
+		ch.seq++
+	}
+}
@@ -0,0 +1,155 @@
+package anchor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/stellar/go/txnbuild"
+)
+
+// feeBumpFactor is how much a fee bump raises the fee over the previous bid.
+// stellar-core only replaces a queued transaction with one bidding at least
+// ten times as much.
+const feeBumpFactor = 10
+
+// FeeStrategy chooses the fee, in stroops per operation, for transactions the
+// anchor submits.
+type FeeStrategy interface {
+	// BaseFee returns the fee to bid per operation.
+	BaseFee(ctx context.Context) (int64, error)
+}
+
+// FixedFee returns a FeeStrategy that always bids the given fee.
+// Fees below the network minimum of 100 stroops are raised to it.
+func FixedFee(stroops int64) FeeStrategy {
+	return fixedFee(max(stroops, txnbuild.MinBaseFee))
+}
+
+// FeeStatsFee returns a FeeStrategy that bids the given percentile of recent
+// max-fee bids reported by source, e.g. 90 to outbid nine in ten
+// transactions. The bid is never below the last ledger's base fee. Unknown
+// percentiles round up to the next one reported.
+func FeeStatsFee(source stellarconnect.FeeStatsSource, percentile int) FeeStrategy {
+	return feeStatsFee{source: source, percentile: percentile}
+}
+
+// CappedFee returns a FeeStrategy that bids what strategy does, but never more
+// than maxFee stroops per operation. The cap also bounds fee bumps.
+func CappedFee(strategy FeeStrategy, maxFee int64) FeeStrategy {
+	return cappedFee{strategy: strategy, maxFee: max(maxFee, txnbuild.MinBaseFee)}
+}
+
+type fixedFee int64
+
+func (f fixedFee) BaseFee(context.Context) (int64, error) {
+	return int64(f), nil
+}
+
+type feeStatsFee struct {
+	source     stellarconnect.FeeStatsSource
+	percentile int
+}
+
+func (f feeStatsFee) BaseFee(ctx context.Context) (int64, error) {
+	stats, err := f.source.FeeStats(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load fee stats: %w", err)
+	}
+	percentiles := make([]int, 0, len(stats.MaxFee))
+	for p := range stats.MaxFee {
+		percentiles = append(percentiles, p)
+	}
+	sort.Ints(percentiles)
+
+	var fee int64
+	for _, p := range percentiles {
+		fee = stats.MaxFee[p]
+		if p >= f.percentile {
+			break
+		}
+	}
+	return max(fee, stats.LastLedgerBaseFee, txnbuild.MinBaseFee), nil
+}
+
+type cappedFee struct {
+	strategy FeeStrategy
+	maxFee   int64
+}
+
+func (f cappedFee) BaseFee(ctx context.Context) (int64, error) {
+	fee, err := f.strategy.BaseFee(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return min(fee, f.maxFee), nil
+}
+
+// feeCap returns the most a strategy will bid, or zero if it is unbounded.
+func feeCap(strategy FeeStrategy) int64 {
+	if capped, ok := strategy.(cappedFee); ok {
+		return capped.maxFee
+	}
+	return 0
+}
+
+// bumpFee returns the fee for bumping a transaction that bid previous: ten
+// times the previous bid or the strategy's current fee, whichever is higher.
+// Bumps stay within the strategy's cap or, for uncapped strategies, ten times
+// its current fee. ok is false if the fee cannot be raised.
+func bumpFee(ctx context.Context, strategy FeeStrategy, previous int64) (fee int64, ok bool, err error) {
+	current, err := strategy.BaseFee(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	limit := feeCap(strategy)
+	if limit == 0 {
+		limit = current * feeBumpFactor
+	}
+	fee = min(max(current, previous*feeBumpFactor), limit)
+	return fee, fee > previous, nil
+}
+
+// feeBump wraps the inner transaction of envelope in a fee-bump transaction
+// paid by feeAccount. If envelope is already a fee bump, its inner
+// transaction is wrapped again. Returns ok false if the fee cannot be raised.
+func feeBump(ctx context.Context, envelope string, strategy FeeStrategy, feeAccount stellarconnect.Signer, passphrase string) (bumped string, ok bool, err error) {
+	parsed, err := txnbuild.TransactionFromXDR(envelope)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to parse transaction XDR: %w", err)
+	}
+	var inner *txnbuild.Transaction
+	var previous int64
+	if outer, isFeeBump := parsed.FeeBump(); isFeeBump {
+		inner = outer.InnerTransaction()
+		previous = outer.BaseFee()
+	} else if tx, isTx := parsed.Transaction(); isTx {
+		inner = tx
+		previous = tx.BaseFee()
+	} else {
+		return "", false, fmt.Errorf("unsupported transaction envelope")
+	}
+
+	fee, ok, err := bumpFee(ctx, strategy, previous)
+	if err != nil || !ok {
+		return "", false, err
+	}
+	tx, err := txnbuild.NewFeeBumpTransaction(txnbuild.FeeBumpTransactionParams{
+		Inner:      inner,
+		FeeAccount: feeAccount.PublicKey(),
+		BaseFee:    fee,
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to build fee bump: %w", err)
+	}
+	unsigned, err := tx.Base64()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to encode fee bump: %w", err)
+	}
+	bumped, err = feeAccount.SignTransaction(ctx, unsigned, passphrase)
+	if err != nil {
+		return "", false, fmt.Errorf("fee account failed to sign: %w", err)
+	}
+	return bumped, true, nil
+}
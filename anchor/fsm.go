@@ -8,6 +8,7 @@ package anchor
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/marwen-abid/anchor-sdk-go"
 	"github.com/marwen-abid/anchor-sdk-go/errors"
@@ -16,7 +17,7 @@ import (
 // legalTransitions defines the allowed state transitions for SEP-24 transfers.
 // Each key is a "from" state, and the value is a set of valid "to" states.
 //
-// Terminal states (completed, failed, denied, cancelled, expired) have no outgoing transitions.
+// Terminal states (completed, failed, denied, cancelled, expired, refunded) have no outgoing transitions.
 var legalTransitions = map[stellarconnect.TransferStatus]map[stellarconnect.TransferStatus]bool{
 	stellarconnect.StatusInitiating: {
 		stellarconnect.StatusInteractive:              true,
@@ -36,19 +37,31 @@ var legalTransitions = map[stellarconnect.TransferStatus]map[stellarconnect.Tran
 		stellarconnect.StatusPendingStellar:  true,
 		stellarconnect.StatusFailed:          true,
 		stellarconnect.StatusCancelled:       true,
+		stellarconnect.StatusRefunded:        true,
 	},
 	stellarconnect.StatusPendingExternal: {
 		stellarconnect.StatusPendingStellar: true,
 		stellarconnect.StatusFailed:         true,
 		stellarconnect.StatusCancelled:      true,
+		stellarconnect.StatusRefunded:       true,
 	},
 	stellarconnect.StatusPendingStellar: {
-		stellarconnect.StatusCompleted: true,
-		stellarconnect.StatusFailed:    true,
+		stellarconnect.StatusPendingTrust: true,
+		stellarconnect.StatusCompleted:    true,
+		stellarconnect.StatusFailed:       true,
+		stellarconnect.StatusRefunded:     true,
+	},
+	stellarconnect.StatusPendingTrust: {
+		stellarconnect.StatusPendingStellar: true,
+		stellarconnect.StatusFailed:         true,
+		stellarconnect.StatusCancelled:      true,
+		stellarconnect.StatusExpired:        true,
+		stellarconnect.StatusRefunded:       true,
 	},
 	stellarconnect.StatusPaymentRequired: {
 		stellarconnect.StatusPendingStellar: true,
 		stellarconnect.StatusFailed:         true,
+		stellarconnect.StatusRefunded:       true,
 	},
 	// Terminal states have no outgoing transitions
 	stellarconnect.StatusCompleted: {},
@@ -56,6 +69,7 @@ var legalTransitions = map[stellarconnect.TransferStatus]map[stellarconnect.Tran
 	stellarconnect.StatusDenied:    {},
 	stellarconnect.StatusCancelled: {},
 	stellarconnect.StatusExpired:   {},
+	stellarconnect.StatusRefunded:  {},
 }
 
 // ValidateTransition checks if a state transition from "from" to "to" is legal
@@ -92,3 +106,28 @@ func ValidateTransition(from, to stellarconnect.TransferStatus) error {
 
 	return nil
 }
+
+// Statuses returns every status known to the state machine, sorted by name.
+func Statuses() []stellarconnect.TransferStatus {
+	statuses := make([]stellarconnect.TransferStatus, 0, len(legalTransitions))
+	for status := range legalTransitions {
+		statuses = append(statuses, status)
+	}
+	sortStatuses(statuses)
+	return statuses
+}
+
+// NextStatuses returns the statuses a transfer in "from" may move to, sorted
+// by name. Terminal and unknown statuses have none.
+func NextStatuses(from stellarconnect.TransferStatus) []stellarconnect.TransferStatus {
+	var statuses []stellarconnect.TransferStatus
+	for status := range legalTransitions[from] {
+		statuses = append(statuses, status)
+	}
+	sortStatuses(statuses)
+	return statuses
+}
+
+func sortStatuses(statuses []stellarconnect.TransferStatus) {
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i] < statuses[j] })
+}
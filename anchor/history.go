@@ -0,0 +1,174 @@
+package anchor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/core/amount"
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+)
+
+type actorContextKey struct{}
+
+// WithActor returns a context that attributes transfer changes made with it
+// to actor in the transfer history.
+func WithActor(ctx context.Context, actor stellarconnect.Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, or the system actor.
+func ActorFromContext(ctx context.Context) stellarconnect.Actor {
+	if actor, ok := ctx.Value(actorContextKey{}).(stellarconnect.Actor); ok {
+		return actor
+	}
+	return stellarconnect.Actor{Type: stellarconnect.ActorSystem}
+}
+
+// History returns the audit trail of a transfer, oldest first.
+// Requires a store that implements stellarconnect.HistoryStore.
+func (tm *TransferManager) History(ctx context.Context, transferID string) ([]stellarconnect.HistoryEntry, error) {
+	hs, ok := tm.store.(stellarconnect.HistoryStore)
+	if !ok {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "transfer store does not record history", nil)
+	}
+	entries, err := hs.History(ctx, transferID)
+	if err != nil {
+		return nil, errors.NewAnchorError(errors.STORE_ERROR, "failed to load transfer history", err)
+	}
+	return entries, nil
+}
+
+// Update applies changes that do not move the transfer between states, such
+// as metadata or an external reference, and records them in the history.
+// Status changes must go through the lifecycle methods and are rejected.
+func (tm *TransferManager) Update(ctx context.Context, transferID string, update stellarconnect.TransferUpdate) error {
+	if update.Status != nil {
+		return errors.NewAnchorError(errors.TRANSITION_INVALID, "status cannot be changed with Update", nil)
+	}
+	return tm.mutate(ctx, transferID, func(*stellarconnect.Transfer) (*stellarconnect.TransferUpdate, []HookEvent, error) {
+		u := update
+		return &u, nil, nil
+	})
+}
+
+// createdEntry returns the history entry for a new transfer.
+func createdEntry(ctx context.Context, transfer *stellarconnect.Transfer) stellarconnect.HistoryEntry {
+	return stellarconnect.HistoryEntry{
+		TransferID: transfer.ID,
+		ToStatus:   transfer.Status,
+		Actor:      ActorFromContext(ctx),
+		CreatedAt:  time.Now(),
+	}
+}
+
+// changeEntry returns the history entry for an update applied to before.
+func changeEntry(ctx context.Context, before *stellarconnect.Transfer, update *stellarconnect.TransferUpdate, changes []stellarconnect.FieldChange) stellarconnect.HistoryEntry {
+	entry := stellarconnect.HistoryEntry{
+		TransferID: before.ID,
+		FromStatus: before.Status,
+		ToStatus:   before.Status,
+		Actor:      ActorFromContext(ctx),
+		Changes:    changes,
+		CreatedAt:  time.Now(),
+	}
+	if update.Status != nil {
+		entry.ToStatus = *update.Status
+	}
+	if update.Message != nil {
+		entry.Reason = *update.Message
+	}
+	return entry
+}
+
+// appendHistory stores the entry for a change that is already committed, if
+// the store supports history. Stores implementing
+// stellarconnect.AtomicHistoryStore write it with the change instead. The
+// change cannot be undone, so a failure is logged rather than returned.
+func (tm *TransferManager) appendHistory(ctx context.Context, entry stellarconnect.HistoryEntry) {
+	hs, ok := tm.store.(stellarconnect.HistoryStore)
+	if !ok {
+		return
+	}
+	if err := hs.AppendHistory(ctx, entry); err != nil {
+		log.Printf("transfer %s changed but its history entry could not be recorded: %v", entry.TransferID, err)
+	}
+}
+
+// diffUpdate lists the fields the update changes, excluding Status, which
+// the history entry records separately.
+func diffUpdate(t *stellarconnect.Transfer, u *stellarconnect.TransferUpdate) []stellarconnect.FieldChange {
+	var changes []stellarconnect.FieldChange
+	add := func(field, from string, to *string) {
+		if to != nil && *to != from {
+			changes = append(changes, stellarconnect.FieldChange{Field: field, From: from, To: *to})
+		}
+	}
+	addAmount := func(field string, from amount.Amount, to *amount.Amount) {
+		if to != nil && !to.Equal(from) {
+			changes = append(changes, stellarconnect.FieldChange{Field: field, From: from.String(), To: to.String()})
+		}
+	}
+	addAmount("amount", t.Amount, u.Amount)
+	addAmount("amount_received", t.AmountReceived, u.AmountReceived)
+	add("asset_code", t.AssetCode, u.AssetCode)
+	add("asset_issuer", t.AssetIssuer, u.AssetIssuer)
+	add("external_ref", t.ExternalRef, u.ExternalRef)
+	add("stellar_tx_hash", t.StellarTxHash, u.StellarTxHash)
+	add("claimable_balance_id", t.ClaimableBalanceID, u.ClaimableBalanceID)
+	add("interactive_url", t.InteractiveURL, u.InteractiveURL)
+	add("message", t.Message, u.Message)
+	if u.InteractiveToken != nil && *u.InteractiveToken != t.InteractiveToken {
+		// Never write tokens to the audit trail.
+		changes = append(changes, stellarconnect.FieldChange{Field: "interactive_token", From: "[redacted]", To: "[redacted]"})
+	}
+	if u.CompletedAt != nil {
+		from := ""
+		if t.CompletedAt != nil {
+			from = t.CompletedAt.Format(time.RFC3339)
+		}
+		to := u.CompletedAt.Format(time.RFC3339)
+		add("completed_at", from, &to)
+	}
+	if u.Metadata != nil {
+		changes = append(changes, diffMetadata(t.Metadata, u.Metadata)...)
+	}
+	return changes
+}
+
+// diffMetadata compares metadata maps key by key, in sorted key order.
+func diffMetadata(from, to map[string]any) []stellarconnect.FieldChange {
+	keys := make(map[string]struct{}, len(from)+len(to))
+	for k := range from {
+		keys[k] = struct{}{}
+	}
+	for k := range to {
+		keys[k] = struct{}{}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var changes []stellarconnect.FieldChange
+	for _, k := range sorted {
+		oldVal, hadOld := from[k]
+		newVal, hasNew := to[k]
+		oldStr, newStr := "", ""
+		if hadOld {
+			oldStr = fmt.Sprint(oldVal)
+		}
+		if hasNew {
+			newStr = fmt.Sprint(newVal)
+		}
+		if hadOld == hasNew && oldStr == newStr {
+			continue
+		}
+		changes = append(changes, stellarconnect.FieldChange{Field: "metadata." + k, From: oldStr, To: newStr})
+	}
+	return changes
+}
@@ -3,72 +3,554 @@
 package anchor
 
 import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"log"
+	"slices"
 	"sync"
+	"time"
 
 	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+)
+
+const (
+	defaultHookWorkers   = 4
+	defaultHookQueueSize = 256
 )
 
 // HookEvent represents a named lifecycle event that anchors can subscribe to.
 type HookEvent string
 
-// Hook event constants represent the lifecycle events that anchors can react to.
+// Hook event constants represent the lifecycle events that anchors can react
+// to. Kind-specific events are named "<kind>:<stage>" and fire exactly once
+// per transition, followed by HookTransferStatusChanged when the transition
+// changes the status:
+//
+//   - initiated: the transfer was created; for non-interactive deposits, when
+//     it moves to pending_external
+//   - interactive_completed: the user finished the interactive flow
+//     (deposits and withdrawals only; SEP-31 has no interactive flow)
+//   - funds_received: the anchor received the user's funds, off-chain for
+//     deposits and on Stellar for withdrawals and receives
+//   - payment_sent: the anchor paid out, on Stellar for deposits and
+//     off-chain for withdrawals and receives
+//   - completed, failed, denied, cancelled, expired, refunded: the transfer
+//     reached that terminal status, whichever method moved it there
 const (
-	HookDepositInitiated             HookEvent = "deposit:initiated"
-	HookDepositKYCComplete           HookEvent = "deposit:kyc_complete"
-	HookDepositFundsReceived         HookEvent = "deposit:funds_received"
-	HookWithdrawalInitiated          HookEvent = "withdrawal:initiated"
+	HookDepositInitiated            HookEvent = "deposit:initiated"
+	HookDepositInteractiveCompleted HookEvent = "deposit:interactive_completed"
+	HookDepositFundsReceived        HookEvent = "deposit:funds_received"
+	HookDepositPaymentSent          HookEvent = "deposit:payment_sent"
+	HookDepositCompleted            HookEvent = "deposit:completed"
+	HookDepositFailed               HookEvent = "deposit:failed"
+	HookDepositDenied               HookEvent = "deposit:denied"
+	HookDepositCancelled            HookEvent = "deposit:cancelled"
+	HookDepositExpired              HookEvent = "deposit:expired"
+	HookDepositRefunded             HookEvent = "deposit:refunded"
+
+	HookWithdrawalInitiated            HookEvent = "withdrawal:initiated"
+	HookWithdrawalInteractiveCompleted HookEvent = "withdrawal:interactive_completed"
+	HookWithdrawalFundsReceived        HookEvent = "withdrawal:funds_received"
+	HookWithdrawalPaymentSent          HookEvent = "withdrawal:payment_sent"
+	HookWithdrawalCompleted            HookEvent = "withdrawal:completed"
+	HookWithdrawalFailed               HookEvent = "withdrawal:failed"
+	HookWithdrawalDenied               HookEvent = "withdrawal:denied"
+	HookWithdrawalCancelled            HookEvent = "withdrawal:cancelled"
+	HookWithdrawalExpired              HookEvent = "withdrawal:expired"
+	HookWithdrawalRefunded             HookEvent = "withdrawal:refunded"
+
+	HookReceiveInitiated     HookEvent = "receive:initiated"
+	HookReceiveFundsReceived HookEvent = "receive:funds_received"
+	HookReceivePaymentSent   HookEvent = "receive:payment_sent"
+	HookReceiveCompleted     HookEvent = "receive:completed"
+	HookReceiveFailed        HookEvent = "receive:failed"
+	HookReceiveDenied        HookEvent = "receive:denied"
+	HookReceiveCancelled     HookEvent = "receive:cancelled"
+	HookReceiveExpired       HookEvent = "receive:expired"
+	HookReceiveRefunded      HookEvent = "receive:refunded"
+
+	HookTransferStatusChanged HookEvent = "transfer:status_changed"
+	HookPaymentMismatch       HookEvent = "payment:mismatch"
+
+	// Deprecated: use HookDepositInteractiveCompleted. It still fires,
+	// right after HookDepositInteractiveCompleted.
+	HookDepositKYCComplete HookEvent = "deposit:kyc_complete"
+
+	// Deprecated: use HookWithdrawalFundsReceived. It still fires, right
+	// after HookWithdrawalFundsReceived.
 	HookWithdrawalStellarPaymentSent HookEvent = "withdrawal:stellar_payment_sent"
-	HookTransferStatusChanged        HookEvent = "transfer:status_changed"
 )
 
+// legacyHookEvents maps events to the deprecated event that fires with them,
+// so handlers and webhooks subscribed to the old names keep working.
+var legacyHookEvents = map[HookEvent]HookEvent{
+	HookDepositInteractiveCompleted: HookDepositKYCComplete,
+	HookWithdrawalFundsReceived:     HookWithdrawalStellarPaymentSent,
+}
+
+// HookEvents returns every event the TransferManager fires, including the
+// deprecated ones.
+func HookEvents() []HookEvent {
+	return []HookEvent{
+		HookDepositInitiated, HookDepositInteractiveCompleted, HookDepositFundsReceived, HookDepositPaymentSent,
+		HookDepositCompleted, HookDepositFailed, HookDepositDenied, HookDepositCancelled, HookDepositExpired, HookDepositRefunded,
+		HookWithdrawalInitiated, HookWithdrawalInteractiveCompleted, HookWithdrawalFundsReceived, HookWithdrawalPaymentSent,
+		HookWithdrawalCompleted, HookWithdrawalFailed, HookWithdrawalDenied, HookWithdrawalCancelled, HookWithdrawalExpired, HookWithdrawalRefunded,
+		HookReceiveInitiated, HookReceiveFundsReceived, HookReceivePaymentSent,
+		HookReceiveCompleted, HookReceiveFailed, HookReceiveDenied, HookReceiveCancelled, HookReceiveExpired, HookReceiveRefunded,
+		HookTransferStatusChanged, HookPaymentMismatch,
+		HookDepositKYCComplete, HookWithdrawalStellarPaymentSent,
+	}
+}
+
+// hookStage is a step of a transfer flow with a kind-specific event.
+type hookStage string
+
+const (
+	stageInitiated            hookStage = "initiated"
+	stageInteractiveCompleted hookStage = "interactive_completed"
+	stageFundsReceived        hookStage = "funds_received"
+	stagePaymentSent          hookStage = "payment_sent"
+)
+
+// stageHook returns the event for a stage of a transfer of the given kind.
+func stageHook(kind stellarconnect.TransferKind, stage hookStage) HookEvent {
+	return HookEvent(string(kind) + ":" + string(stage))
+}
+
+// statusHook returns the kind-specific event for reaching a terminal status,
+// or "" for other statuses.
+func statusHook(kind stellarconnect.TransferKind, status stellarconnect.TransferStatus) HookEvent {
+	if !isTerminal(status) {
+		return ""
+	}
+	return HookEvent(string(kind) + ":" + string(status))
+}
+
+// transitionHooks completes the hooks a change produces: the stage hooks fn
+// chose, the kind-specific event for a terminal status, and
+// HookTransferStatusChanged last if the status changes. Each event appears
+// once; HookTransferStatusChanged is dropped if the status does not change.
+func transitionHooks(transfer *stellarconnect.Transfer, update *stellarconnect.TransferUpdate, hooks []HookEvent) []HookEvent {
+	statusChanged := update.Status != nil && *update.Status != transfer.Status
+	var result []HookEvent
+	add := func(hook HookEvent) {
+		if hook != "" && !slices.Contains(result, hook) {
+			result = append(result, hook)
+		}
+	}
+	for _, hook := range hooks {
+		if hook != HookTransferStatusChanged {
+			add(hook)
+			add(legacyHookEvents[hook])
+		}
+	}
+	if statusChanged {
+		add(statusHook(transfer.Kind, *update.Status))
+		add(HookTransferStatusChanged)
+	}
+	return result
+}
+
+// HookEnvelope describes one lifecycle event. Events produced by the same
+// transfer change share their PreviousStatus, Changes, Actor, Timestamp and
+// CorrelationID. Handlers must not modify the envelope or its transfer.
+type HookEnvelope struct {
+	Event          HookEvent
+	Transfer       *stellarconnect.Transfer      // Transfer after the change
+	PreviousStatus stellarconnect.TransferStatus // Status before the change; empty when the transfer was created
+	Status         stellarconnect.TransferStatus // Status after the change
+	Changes        []stellarconnect.FieldChange  // Fields the change modified, excluding status, as in the history
+	Actor          stellarconnect.Actor          // Who made the change (see WithActor)
+	Timestamp      time.Time                     // When the change was committed
+	CorrelationID  string                        // Identifies the change (see WithCorrelationID)
+}
+
+// StatusChanged reports whether the change moved the transfer to a new
+// status, including its creation.
+func (e *HookEnvelope) StatusChanged() bool {
+	return e.PreviousStatus != e.Status
+}
+
+// HookHandler handles a lifecycle event. A returned error is reported to the
+// caller of Trigger for synchronous handlers, and to the registry's error
+// handler for asynchronous ones.
+type HookHandler func(ctx context.Context, event *HookEnvelope) error
+
+type correlationIDContextKey struct{}
+
+// WithCorrelationID returns a context whose transfer changes carry id as the
+// CorrelationID of their hook events, for example a request ID. Without it
+// each change gets a random ID.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDContextKey{}, id)
+}
+
+// CorrelationIDFromContext returns the ID set by WithCorrelationID, or "".
+func CorrelationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDContextKey{}).(string)
+	return id
+}
+
+// HookOption configures a handler registered with On.
+type HookOption func(*hookHandler)
+
+// HookAsync runs the handler on the registry's worker pool instead of in the
+// caller of Trigger. The handler receives a copy of the transfer and a
+// context that is not cancelled with the caller's.
+func HookAsync() HookOption {
+	return func(h *hookHandler) {
+		h.async = true
+	}
+}
+
+// HookTimeout bounds how long the handler may run, overriding the registry's
+// default timeout. Zero disables the timeout.
+func HookTimeout(timeout time.Duration) HookOption {
+	return func(h *hookHandler) {
+		h.timeout = timeout
+		h.timeoutSet = true
+	}
+}
+
+// HookAsset restricts the handler to transfers of the given asset codes.
+func HookAsset(codes ...string) HookOption {
+	return func(h *hookHandler) {
+		h.assets = append(h.assets, codes...)
+	}
+}
+
+// HookKind restricts the handler to transfers of the given kinds.
+func HookKind(kinds ...stellarconnect.TransferKind) HookOption {
+	return func(h *hookHandler) {
+		h.kinds = append(h.kinds, kinds...)
+	}
+}
+
+// HookStatus restricts the handler to events whose transfer is in one of the
+// given statuses after the change.
+func HookStatus(statuses ...stellarconnect.TransferStatus) HookOption {
+	return func(h *hookHandler) {
+		h.statuses = append(h.statuses, statuses...)
+	}
+}
+
+// HookRegistryOption configures a HookRegistry.
+type HookRegistryOption func(*HookRegistry)
+
+// WithHookWorkers sets the number of workers running asynchronous handlers
+// and how many invocations may wait for one (default: 4 workers, 256 queued).
+// When the queue is full, Trigger blocks until there is room or its context
+// is done.
+func WithHookWorkers(workers, queueSize int) HookRegistryOption {
+	return func(r *HookRegistry) {
+		r.workers = workers
+		r.queueSize = queueSize
+	}
+}
+
+// WithHookTimeout sets the default per-handler timeout (default: none).
+func WithHookTimeout(timeout time.Duration) HookRegistryOption {
+	return func(r *HookRegistry) {
+		r.timeout = timeout
+	}
+}
+
+// WithHookErrorHandler sets the function that receives errors from
+// asynchronous handlers and from hooks the TransferManager fires after a
+// change is committed (default: log.Printf).
+func WithHookErrorHandler(fn func(event *HookEnvelope, err error)) HookRegistryOption {
+	return func(r *HookRegistry) {
+		r.onError = fn
+	}
+}
+
 // HookRegistry manages lifecycle event handlers for transfer state changes.
 // It implements the observer pattern, allowing anchors to register callbacks
-// that execute sequentially when transfer lifecycle events occur.
+// that run when transfer lifecycle events occur.
 //
-// Handlers are stored per event and execute in registration order.
-// The registry is thread-safe for concurrent registration and triggering.
+// Synchronous handlers execute in registration order in the goroutine that
+// calls Trigger. Handlers registered with HookAsync are queued to a bounded
+// worker pool, started on first use. A panicking handler is recovered and
+// reported as a HANDLER_PANIC error; it does not stop the other handlers.
+// The registry is thread-safe, and handlers may register or unsubscribe
+// handlers themselves.
 type HookRegistry struct {
-	handlers map[HookEvent][]func(*stellarconnect.Transfer)
+	handlers map[HookEvent][]*hookHandler
 	mu       sync.RWMutex
+
+	workers   int
+	queueSize int
+	timeout   time.Duration
+	onError   func(*HookEnvelope, error)
+
+	startOnce sync.Once
+	queue     chan hookJob
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+type hookHandler struct {
+	fn         HookHandler
+	async      bool
+	timeout    time.Duration
+	timeoutSet bool
+
+	assets   []string
+	kinds    []stellarconnect.TransferKind
+	statuses []stellarconnect.TransferStatus
+}
+
+// matches reports whether the event passes the handler's filters.
+func (h *hookHandler) matches(e *HookEnvelope) bool {
+	if e.Transfer == nil {
+		return len(h.assets) == 0 && len(h.kinds) == 0 && len(h.statuses) == 0
+	}
+	return (len(h.assets) == 0 || slices.Contains(h.assets, e.Transfer.AssetCode)) &&
+		(len(h.kinds) == 0 || slices.Contains(h.kinds, e.Transfer.Kind)) &&
+		(len(h.statuses) == 0 || slices.Contains(h.statuses, e.Status))
+}
+
+// hookJob is an asynchronous handler invocation waiting for a worker.
+type hookJob struct {
+	ctx     context.Context
+	handler *hookHandler
+	event   *HookEnvelope
 }
 
 // NewHookRegistry creates a new lifecycle hook registry.
-func NewHookRegistry() *HookRegistry {
-	return &HookRegistry{
-		handlers: make(map[HookEvent][]func(*stellarconnect.Transfer)),
+func NewHookRegistry(opts ...HookRegistryOption) *HookRegistry {
+	r := &HookRegistry{
+		handlers:  make(map[HookEvent][]*hookHandler),
+		workers:   defaultHookWorkers,
+		queueSize: defaultHookQueueSize,
+		onError: func(event *HookEnvelope, err error) {
+			log.Printf("hook %s: correlation %s: %v", event.Event, event.CorrelationID, err)
+		},
+		done: make(chan struct{}),
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.workers <= 0 {
+		r.workers = defaultHookWorkers
+	}
+	if r.queueSize < 0 {
+		r.queueSize = 0
+	}
+	return r
 }
 
-// On registers a handler function for a specific lifecycle event.
-// Multiple handlers can be registered for the same event and will execute
-// sequentially in registration order when the event is triggered.
-//
-// The handler receives a pointer to the Transfer that triggered the event.
-// Handlers should be quick, non-blocking operations. If a handler panics,
-// the panic will propagate and prevent subsequent handlers from executing.
-func (r *HookRegistry) On(event HookEvent, handler func(*stellarconnect.Transfer)) {
+// On registers a handler for a specific lifecycle event and returns a
+// function that removes it. Multiple handlers can be registered for the same
+// event; synchronous ones execute sequentially in registration order when the
+// event is triggered.
+func (r *HookRegistry) On(event HookEvent, handler HookHandler, opts ...HookOption) (unsubscribe func()) {
+	h := &hookHandler{fn: handler}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if !h.timeoutSet {
+		h.timeout = r.timeout
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	r.handlers[event] = append(r.handlers[event], h)
 
-	r.handlers[event] = append(r.handlers[event], handler)
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		handlers := r.handlers[event]
+		for i, registered := range handlers {
+			if registered == h {
+				r.handlers[event] = append(handlers[:i:i], handlers[i+1:]...)
+				return
+			}
+		}
+	}
 }
 
-// Trigger executes all registered handlers for a specific lifecycle event,
-// passing the transfer that triggered the event. Handlers execute sequentially
-// in registration order.
-//
-// If any handler panics, the panic propagates to the caller and subsequent
-// handlers do not execute.
-func (r *HookRegistry) Trigger(event HookEvent, transfer *stellarconnect.Transfer) {
+// Trigger runs the handlers registered for event.Event whose filters match
+// it. Status defaults to the transfer's status and Timestamp to the current
+// time. Synchronous handlers run first, in registration order; every one runs
+// even if an earlier one fails, and their errors are returned joined.
+// Asynchronous handlers are queued, and Trigger returns an error only if one
+// could not be queued.
+func (r *HookRegistry) Trigger(ctx context.Context, event *HookEnvelope) error {
+	if event.Status == "" && event.Transfer != nil {
+		event.Status = event.Transfer.Status
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
 	r.mu.RLock()
-	defer r.mu.RUnlock()
+	var handlers []*hookHandler
+	for _, h := range r.handlers[event.Event] {
+		if h.matches(event) {
+			handlers = append(handlers, h)
+		}
+	}
+	r.mu.RUnlock()
 
-	handlers, ok := r.handlers[event]
-	if !ok {
-		return
+	var errs []error
+	for _, h := range handlers {
+		if h.async {
+			continue
+		}
+		if err := r.run(ctx, h, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, h := range handlers {
+		if !h.async {
+			continue
+		}
+		if err := r.enqueue(ctx, h, event); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	return stderrors.Join(errs...)
+}
 
-	for _, handler := range handlers {
-		handler(transfer)
+// Close stops the worker pool after the queued asynchronous handlers have
+// run. Asynchronous handlers triggered afterwards are not run.
+func (r *HookRegistry) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+	r.wg.Wait()
+}
+
+// report passes an error from a handler to the registry's error handler.
+func (r *HookRegistry) report(event *HookEnvelope, err error) {
+	if err != nil && r.onError != nil {
+		r.onError(event, err)
+	}
+}
+
+// enqueue queues an asynchronous handler, waiting for room in the queue
+// until ctx is done.
+func (r *HookRegistry) enqueue(ctx context.Context, h *hookHandler, event *HookEnvelope) error {
+	select {
+	case <-r.done:
+		return fmt.Errorf("hook %s: registry is closed", event.Event)
+	default:
+	}
+	r.startOnce.Do(r.start)
+
+	job := hookJob{
+		ctx:     context.WithoutCancel(ctx),
+		handler: h,
+		event:   cloneEnvelope(event),
+	}
+	select {
+	case r.queue <- job:
+		return nil
+	case <-r.done:
+		return fmt.Errorf("hook %s: registry is closed", event.Event)
+	case <-ctx.Done():
+		return fmt.Errorf("hook %s: failed to queue handler: %w", event.Event, ctx.Err())
+	}
+}
+
+// start launches the worker pool.
+func (r *HookRegistry) start() {
+	r.queue = make(chan hookJob, r.queueSize)
+	for range r.workers {
+		r.wg.Add(1)
+		go r.work()
+	}
+}
+
+// work runs queued handlers until the registry is closed and the queue has
+// been drained.
+func (r *HookRegistry) work() {
+	defer r.wg.Done()
+	for {
+		select {
+		case job := <-r.queue:
+			r.report(job.event, r.run(job.ctx, job.handler, job.event))
+		case <-r.done:
+			for {
+				select {
+				case job := <-r.queue:
+					r.report(job.event, r.run(job.ctx, job.handler, job.event))
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// run calls one handler, recovering a panic into a HANDLER_PANIC error. With
+// a timeout, the handler's context is cancelled at the deadline and run
+// returns a HANDLER_TIMEOUT error without waiting for the handler to return.
+func (r *HookRegistry) run(ctx context.Context, h *hookHandler, event *HookEnvelope) error {
+	if h.timeout <= 0 {
+		return callHook(ctx, h.fn, event)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		result <- callHook(ctx, h.fn, event)
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return errors.NewAnchorError(errors.HANDLER_TIMEOUT, fmt.Sprintf("hook %s: handler did not return within %s", event.Event, h.timeout), ctx.Err())
+		}
+		return fmt.Errorf("hook %s: %w", event.Event, ctx.Err())
+	}
+}
+
+func callHook(ctx context.Context, fn HookHandler, event *HookEnvelope) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = errors.NewAnchorError(errors.HANDLER_PANIC, fmt.Sprintf("hook %s: handler panicked: %v", event.Event, p), nil)
+		}
+	}()
+	if err := fn(ctx, event); err != nil {
+		return fmt.Errorf("hook %s: %w", event.Event, err)
+	}
+	return nil
+}
+
+// cloneEnvelope returns a copy of e for an asynchronous handler, so later
+// changes by the caller are not visible to it.
+func cloneEnvelope(e *HookEnvelope) *HookEnvelope {
+	c := *e
+	c.Transfer = cloneTransfer(e.Transfer)
+	c.Changes = slices.Clone(e.Changes)
+	return &c
+}
+
+// cloneTransfer returns a copy of t for an asynchronous handler, so later
+// changes by the caller are not visible to it. Metadata is copied one level
+// deep.
+func cloneTransfer(t *stellarconnect.Transfer) *stellarconnect.Transfer {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	if t.Metadata != nil {
+		c.Metadata = make(map[string]any, len(t.Metadata))
+		for k, v := range t.Metadata {
+			c.Metadata[k] = v
+		}
+	}
+	if t.CompletedAt != nil {
+		completedAt := *t.CompletedAt
+		c.CompletedAt = &completedAt
 	}
+	return &c
 }
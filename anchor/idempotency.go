@@ -0,0 +1,129 @@
+package anchor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/core/amount"
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+)
+
+const (
+	defaultIdempotencyTTL   = 24 * time.Hour
+	defaultIdempotencyLease = time.Minute
+)
+
+// idempotencyReservation is a key claimed for an in-flight initiation.
+// A nil reservation means the request carried no key.
+type idempotencyReservation struct {
+	store stellarconnect.IdempotencyStore
+	key   string
+	ttl   time.Duration
+}
+
+// complete records the created transfer ID against the key and keeps it for
+// the idempotency TTL. The transfer exists either way, so a failure is logged
+// rather than returned: a retry inside the lease gets IDEMPOTENCY_IN_PROGRESS
+// and one after it creates a second transfer.
+func (r *idempotencyReservation) complete(ctx context.Context, transferID string) {
+	if r == nil {
+		return
+	}
+	if err := r.store.Complete(ctx, r.key, transferID, time.Now().Add(r.ttl)); err != nil {
+		log.Printf("transfer %s created but idempotency key %s could not be completed: %v", transferID, r.key, err)
+	}
+}
+
+// release frees the key after a failed initiation so the client can retry
+// with the same key. If that fails the key is freed when its lease ends.
+func (r *idempotencyReservation) release(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	if err := r.store.Release(ctx, r.key); err != nil {
+		log.Printf("idempotency key %s could not be released: %v", r.key, err)
+	}
+}
+
+// reserveIdempotencyKey claims the idempotency key for a new transfer.
+// Keys are scoped by transfer kind and account so clients cannot collide with
+// each other. If the key was already used with the same fingerprint, the
+// original transfer is returned; a different fingerprint is rejected with
+// IDEMPOTENCY_KEY_REUSED. Requests without a key, or managers without an
+// IdempotencyStore, always proceed.
+func (tm *TransferManager) reserveIdempotencyKey(ctx context.Context, kind stellarconnect.TransferKind, account, key, fingerprint string) (*stellarconnect.Transfer, *idempotencyReservation, error) {
+	if key == "" || tm.config.IdempotencyStore == nil {
+		return nil, nil, nil
+	}
+	ttl := tm.config.IdempotencyTTL
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	lease := tm.config.IdempotencyLease
+	if lease <= 0 {
+		lease = defaultIdempotencyLease
+	}
+
+	scoped := fmt.Sprintf("%s:%s:%s", kind, account, key)
+	record, reserved, err := tm.config.IdempotencyStore.Reserve(ctx, scoped, fingerprint, time.Now().Add(lease))
+	if err != nil {
+		return nil, nil, errors.NewAnchorError(errors.STORE_ERROR, "failed to reserve idempotency key", err)
+	}
+	if reserved {
+		return nil, &idempotencyReservation{store: tm.config.IdempotencyStore, key: scoped, ttl: ttl}, nil
+	}
+
+	if record.Fingerprint != fingerprint {
+		err := errors.NewAnchorError(errors.IDEMPOTENCY_KEY_REUSED, "idempotency key was already used with different parameters", nil)
+		err.Context["idempotency_key"] = key
+		return nil, nil, err
+	}
+	if record.CompletedAt == nil {
+		err := errors.NewAnchorError(errors.IDEMPOTENCY_IN_PROGRESS, "a request with this idempotency key is still in progress", nil)
+		err.Context["idempotency_key"] = key
+		return nil, nil, err
+	}
+	transfer, err := tm.store.FindByID(ctx, record.ResourceID)
+	if err != nil {
+		return nil, nil, errors.NewAnchorError(errors.STORE_ERROR, "failed to load transfer for idempotency key", err)
+	}
+	return transfer, nil, nil
+}
+
+// requestFingerprint hashes the parameters that define a transfer request.
+// Metadata is included via its JSON encoding, which orders map keys.
+func requestFingerprint(kind stellarconnect.TransferKind, mode stellarconnect.TransferMode, fields []string, metadata map[string]any) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s", kind, mode)
+	for _, f := range fields {
+		fmt.Fprintf(h, "\x00%s", f)
+	}
+	if len(metadata) > 0 {
+		if raw, err := json.Marshal(metadata); err == nil {
+			h.Write([]byte{0})
+			h.Write(raw)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fingerprint identifies the deposit request. amt is the parsed amount, so
+// "10" and "10.0" count as the same request.
+func (req DepositRequest) fingerprint(amt amount.Amount) string {
+	return requestFingerprint(stellarconnect.KindDeposit, req.Mode,
+		[]string{req.Account, req.AssetCode, amt.String(), req.Memo, string(req.MemoType),
+			strconv.FormatBool(req.ClaimableBalanceSupported), req.OnChangeCallback}, req.Metadata)
+}
+
+// fingerprint identifies the withdrawal request, using the parsed amount.
+func (req WithdrawalRequest) fingerprint(amt amount.Amount) string {
+	return requestFingerprint(stellarconnect.KindWithdrawal, req.Mode,
+		[]string{req.Account, req.AssetCode, amt.String(), req.Dest, req.DestExtra, req.OnChangeCallback}, req.Metadata)
+}
@@ -0,0 +1,159 @@
+package anchor
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/stellar/go/txnbuild"
+)
+
+const (
+	// maxTextMemoBytes is the Stellar protocol limit for text memos.
+	maxTextMemoBytes = 28
+
+	// textMemoEntropy is the number of random bytes in a generated text memo.
+	// 10 bytes encode to 16 base32 characters.
+	textMemoEntropy = 10
+)
+
+// MemoStrategy assigns the memo a user must attach to the Stellar payment that
+// funds a withdrawal. The memo is persisted on the transfer and used by the
+// observer to match incoming payments back to it, so it must be unique among
+// open transfers.
+type MemoStrategy interface {
+	// GenerateMemo returns the memo value and type for a new transfer.
+	// The transfer's ID, Kind, Account and AssetCode are populated.
+	GenerateMemo(ctx context.Context, transfer *stellarconnect.Transfer) (string, stellarconnect.MemoType, error)
+}
+
+// TextMemo returns a MemoStrategy that assigns random 16-character base32 text
+// memos. They are short enough to type by hand and fit the 28-byte limit.
+func TextMemo() MemoStrategy {
+	return textMemoStrategy{}
+}
+
+// IDMemo returns a MemoStrategy that assigns random 63-bit ID memos.
+// ID memos are the most widely supported by exchanges and custodial wallets.
+func IDMemo() MemoStrategy {
+	return idMemoStrategy{}
+}
+
+// HashMemo returns a MemoStrategy that assigns the SHA-256 hash of the transfer
+// ID as a hash memo, encoded as standard base64 per SEP-6/SEP-24.
+func HashMemo() MemoStrategy {
+	return hashMemoStrategy{}
+}
+
+type textMemoStrategy struct{}
+
+func (textMemoStrategy) GenerateMemo(_ context.Context, _ *stellarconnect.Transfer) (string, stellarconnect.MemoType, error) {
+	buf := make([]byte, textMemoEntropy)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("failed to generate text memo: %w", err)
+	}
+	memo := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf)
+	if len(memo) > maxTextMemoBytes {
+		return "", "", fmt.Errorf("text memo exceeds %d bytes", maxTextMemoBytes)
+	}
+	return memo, stellarconnect.MemoTypeText, nil
+}
+
+type idMemoStrategy struct{}
+
+func (idMemoStrategy) GenerateMemo(_ context.Context, _ *stellarconnect.Transfer) (string, stellarconnect.MemoType, error) {
+	id, err := randomUint63()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate ID memo: %w", err)
+	}
+	return strconv.FormatUint(id, 10), stellarconnect.MemoTypeID, nil
+}
+
+type hashMemoStrategy struct{}
+
+func (hashMemoStrategy) GenerateMemo(_ context.Context, transfer *stellarconnect.Transfer) (string, stellarconnect.MemoType, error) {
+	sum := sha256.Sum256([]byte(transfer.ID))
+	return base64.StdEncoding.EncodeToString(sum[:]), stellarconnect.MemoTypeHash, nil
+}
+
+// randomUint63 returns a non-zero random integer below 2^63. Staying within the
+// signed range keeps the value safe for databases and JSON clients that parse
+// IDs as int64.
+func randomUint63() (uint64, error) {
+	var buf [8]byte
+	for {
+		if _, err := rand.Read(buf[:]); err != nil {
+			return 0, err
+		}
+		id := binary.BigEndian.Uint64(buf[:]) >> 1
+		if id != 0 {
+			return id, nil
+		}
+	}
+}
+
+// validateMemo checks that a memo fits the Stellar protocol limits for its type.
+func validateMemo(memo string, memoType stellarconnect.MemoType) error {
+	if memo == "" {
+		return fmt.Errorf("memo is empty")
+	}
+	switch memoType {
+	case stellarconnect.MemoTypeText:
+		if len(memo) > maxTextMemoBytes {
+			return fmt.Errorf("text memo is %d bytes, limit is %d", len(memo), maxTextMemoBytes)
+		}
+	case stellarconnect.MemoTypeID:
+		if _, err := strconv.ParseUint(memo, 10, 64); err != nil {
+			return fmt.Errorf("ID memo must be an unsigned 64-bit integer: %w", err)
+		}
+	case stellarconnect.MemoTypeHash:
+		raw, err := base64.StdEncoding.DecodeString(memo)
+		if err != nil {
+			return fmt.Errorf("hash memo must be base64 encoded: %w", err)
+		}
+		if len(raw) != sha256.Size {
+			return fmt.Errorf("hash memo must be %d bytes, got %d", sha256.Size, len(raw))
+		}
+	default:
+		return fmt.Errorf("unsupported memo type %q", memoType)
+	}
+	return nil
+}
+
+// memoMatches reports whether the transfer was assigned the given memo.
+// An empty memoType matches any memo type.
+func memoMatches(transfer *stellarconnect.Transfer, memo string, memoType stellarconnect.MemoType) bool {
+	if transfer.Memo == "" || transfer.Memo != memo {
+		return false
+	}
+	return memoType == "" || transfer.MemoType == memoType
+}
+
+// transactionMemo converts a memo into its txnbuild form. An empty memo
+// returns nil, meaning no memo.
+func transactionMemo(memo string, memoType stellarconnect.MemoType) (txnbuild.Memo, error) {
+	if memo == "" {
+		return nil, nil
+	}
+	if err := validateMemo(memo, memoType); err != nil {
+		return nil, err
+	}
+	switch memoType {
+	case stellarconnect.MemoTypeID:
+		id, _ := strconv.ParseUint(memo, 10, 64)
+		return txnbuild.MemoID(id), nil
+	case stellarconnect.MemoTypeHash:
+		raw, _ := base64.StdEncoding.DecodeString(memo)
+		var hash txnbuild.MemoHash
+		copy(hash[:], raw)
+		return hash, nil
+	default:
+		return txnbuild.MemoText(memo), nil
+	}
+}
@@ -0,0 +1,96 @@
+package anchor
+
+import (
+	"context"
+	"fmt"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+	"github.com/stellar/go/xdr"
+)
+
+// muxedAddress derives the M-address for the given G-address and mux ID.
+func muxedAddress(account string, muxID uint64) (string, error) {
+	muxed, err := xdr.MuxedAccountFromAccountId(account, muxID)
+	if err != nil {
+		return "", fmt.Errorf("invalid account %q: %w", account, err)
+	}
+	return muxed.Address(), nil
+}
+
+// FindByMuxID returns the transfer that was assigned the given mux ID.
+// It uses the store's mux ID index when the store implements
+// stellarconnect.MuxedTransferStore and falls back to scanning withdrawals
+// and receives otherwise.
+func (tm *TransferManager) FindByMuxID(ctx context.Context, muxID uint64) (*stellarconnect.Transfer, error) {
+	if tm.store == nil {
+		return nil, errors.NewAnchorError(errors.STORE_ERROR, "transfer store not configured", nil)
+	}
+	if muxID == 0 {
+		return nil, errors.NewAnchorError(errors.TRANSFER_NOT_FOUND, "mux ID is zero", nil)
+	}
+	if ms, ok := tm.store.(stellarconnect.MuxedTransferStore); ok {
+		transfer, err := ms.FindByMuxID(ctx, muxID)
+		if err != nil {
+			return nil, errors.NewAnchorError(errors.TRANSFER_NOT_FOUND, "no transfer for mux ID", err)
+		}
+		return transfer, nil
+	}
+
+	transfers, err := tm.payableTransfers(ctx)
+	if err != nil {
+		return nil, errors.NewAnchorError(errors.STORE_ERROR, "failed to list transfers", err)
+	}
+	for _, transfer := range transfers {
+		if transfer.MuxID == muxID {
+			return transfer, nil
+		}
+	}
+	return nil, errors.NewAnchorError(errors.TRANSFER_NOT_FOUND, "no transfer for mux ID", nil)
+}
+
+// assignMuxID assigns a random mux ID to the transfer, retrying when the
+// generated ID is already assigned to another transfer.
+func (tm *TransferManager) assignMuxID(ctx context.Context, transfer *stellarconnect.Transfer) error {
+	if tm.config.DistributionAccount == "" {
+		return errors.NewAnchorError(errors.CONFIG_INVALID, "muxed withdrawals require a distribution account", nil)
+	}
+	for attempt := 0; attempt < memoGenerationAttempts; attempt++ {
+		muxID, err := randomUint63()
+		if err != nil {
+			return errors.NewAnchorError(errors.TRANSFER_INIT_FAILED, "failed to generate mux ID", err)
+		}
+		if existing, err := tm.FindByMuxID(ctx, muxID); err == nil && existing != nil {
+			continue
+		}
+		if _, err := muxedAddress(tm.config.DistributionAccount, muxID); err != nil {
+			return errors.NewAnchorError(errors.CONFIG_INVALID, "invalid distribution account", err)
+		}
+		transfer.MuxID = muxID
+		return nil
+	}
+	return errors.NewAnchorError(errors.TRANSFER_INIT_FAILED, "failed to generate a unique mux ID", nil)
+}
+
+// withdrawAnchorAccount returns the address the user must pay to fund the
+// withdrawal: the per-transfer M-address when muxed, the distribution account
+// otherwise.
+func (tm *TransferManager) withdrawAnchorAccount(transfer *stellarconnect.Transfer) string {
+	if transfer.MuxID != 0 {
+		if addr, err := muxedAddress(tm.config.DistributionAccount, transfer.MuxID); err == nil {
+			return addr
+		}
+	}
+	return tm.config.DistributionAccount
+}
+
+// baseAccount returns the G-address underlying a muxed (M...) address, or the
+// address itself if it is not muxed.
+func baseAccount(address string) (string, error) {
+	muxed, err := xdr.AddressToMuxedAccount(address)
+	if err != nil {
+		return "", err
+	}
+	accountID := muxed.ToAccountId()
+	return accountID.Address(), nil
+}
@@ -0,0 +1,287 @@
+package anchor
+
+import (
+	"context"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	corecrypto "github.com/marwen-abid/anchor-sdk-go/core/crypto"
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+)
+
+const (
+	defaultOutboxInterval      = time.Second
+	defaultOutboxBatchSize     = 100
+	defaultOutboxMaxAttempts   = 10
+	defaultOutboxBackoff       = time.Second
+	defaultOutboxMaxBackoff    = 10 * time.Minute
+	defaultOutboxRetention     = 7 * 24 * time.Hour
+	defaultOutboxPruneInterval = time.Hour
+)
+
+// hookBatch holds the hook events produced by one transfer change, with the
+// context every event of the change shares.
+type hookBatch struct {
+	events         []HookEvent
+	previousStatus stellarconnect.TransferStatus
+	changes        []stellarconnect.FieldChange
+	actor          stellarconnect.Actor
+	correlationID  string
+	at             time.Time
+}
+
+// newHookBatch stamps a change with the context's actor and correlation ID,
+// generating a correlation ID if the context has none.
+func newHookBatch(ctx context.Context, events []HookEvent, previous stellarconnect.TransferStatus, changes []stellarconnect.FieldChange) *hookBatch {
+	correlationID := CorrelationIDFromContext(ctx)
+	if correlationID == "" {
+		// Hooks still fire without an ID if the random source fails.
+		correlationID, _ = corecrypto.GenerateNonce(12)
+	}
+	return &hookBatch{
+		events:         events,
+		previousStatus: previous,
+		changes:        changes,
+		actor:          ActorFromContext(ctx),
+		correlationID:  correlationID,
+		at:             time.Now(),
+	}
+}
+
+// envelope returns the event for hook with the transfer after the change.
+func (b *hookBatch) envelope(hook HookEvent, transfer *stellarconnect.Transfer) *HookEnvelope {
+	return &HookEnvelope{
+		Event:          hook,
+		Transfer:       transfer,
+		PreviousStatus: b.previousStatus,
+		Status:         transfer.Status,
+		Changes:        b.changes,
+		Actor:          b.actor,
+		Timestamp:      b.at,
+		CorrelationID:  b.correlationID,
+	}
+}
+
+// outboxEvents converts the batch into outbox records for the store to fill.
+func (b *hookBatch) outboxEvents() []stellarconnect.OutboxEvent {
+	events := make([]stellarconnect.OutboxEvent, 0, len(b.events))
+	for _, hook := range b.events {
+		events = append(events, stellarconnect.OutboxEvent{
+			Event:          string(hook),
+			PreviousStatus: b.previousStatus,
+			Changes:        b.changes,
+			Actor:          b.actor,
+			CorrelationID:  b.correlationID,
+		})
+	}
+	return events
+}
+
+// OutboxDispatcher delivers events persisted by a TransferManager with
+// Config.Outbox enabled to HookRegistry subscribers. Delivery is at least
+// once: an event is marked delivered only after every handler returned, so
+// handlers must tolerate duplicates after a crash or a failed attempt.
+// Handlers registered with HookAsync are only queued before the event is
+// marked delivered, so their failures are not retried.
+//
+// Failed events are retried with exponential backoff and dead-lettered after
+// the maximum number of attempts; Replay redelivers them once the handler is
+// fixed. Run prunes delivered and dead events older than the retention.
+type OutboxDispatcher struct {
+	store       stellarconnect.OutboxStore
+	hooks       *HookRegistry
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	retention   time.Duration
+	lastPrune   time.Time
+}
+
+// OutboxOption configures an OutboxDispatcher.
+type OutboxOption func(*OutboxDispatcher)
+
+// WithOutboxInterval sets how often Run polls for pending events (default: 1s).
+func WithOutboxInterval(interval time.Duration) OutboxOption {
+	return func(d *OutboxDispatcher) {
+		d.interval = interval
+	}
+}
+
+// WithOutboxBatchSize sets how many events are delivered per poll (default: 100).
+func WithOutboxBatchSize(size int) OutboxOption {
+	return func(d *OutboxDispatcher) {
+		d.batchSize = size
+	}
+}
+
+// WithOutboxMaxAttempts sets how many delivery attempts an event gets before
+// it is dead-lettered (default: 10).
+func WithOutboxMaxAttempts(attempts int) OutboxOption {
+	return func(d *OutboxDispatcher) {
+		d.maxAttempts = attempts
+	}
+}
+
+// WithOutboxBackoff sets the delay before the first retry of a failed event,
+// doubled on each further failure up to ceiling (default: 1s, 10m). A
+// ceiling of zero or less keeps the delay at initial.
+func WithOutboxBackoff(initial, ceiling time.Duration) OutboxOption {
+	return func(d *OutboxDispatcher) {
+		d.backoff = initial
+		d.maxBackoff = ceiling
+	}
+}
+
+// WithOutboxRetention sets how long delivered and dead events are kept before
+// Run prunes them (default: 7 days). Zero or less disables pruning.
+func WithOutboxRetention(retention time.Duration) OutboxOption {
+	return func(d *OutboxDispatcher) {
+		d.retention = retention
+	}
+}
+
+// NewOutboxDispatcher creates a dispatcher that delivers pending events from
+// store to the handlers in hooks.
+func NewOutboxDispatcher(store stellarconnect.OutboxStore, hooks *HookRegistry, opts ...OutboxOption) *OutboxDispatcher {
+	d := &OutboxDispatcher{
+		store:       store,
+		hooks:       hooks,
+		interval:    defaultOutboxInterval,
+		batchSize:   defaultOutboxBatchSize,
+		maxAttempts: defaultOutboxMaxAttempts,
+		backoff:     defaultOutboxBackoff,
+		maxBackoff:  defaultOutboxMaxBackoff,
+		retention:   defaultOutboxRetention,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Run delivers pending events until ctx is cancelled, polling every interval.
+// Delivery errors are recorded on the events, which are retried once their
+// backoff has passed. Once an hour Run also prunes old events.
+func (d *OutboxDispatcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		// Failures stay pending in the store and are retried on a later tick.
+		_, _ = d.DispatchPending(ctx)
+		if time.Since(d.lastPrune) >= defaultOutboxPruneInterval {
+			d.lastPrune = time.Now()
+			// A failed prune is retried at the next interval.
+			_, _ = d.Prune(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchPending delivers one batch of due events in order and returns how
+// many were delivered. An event whose handlers return an error, including a
+// recovered panic or a timeout, is marked failed and retried after a backoff,
+// or dead-lettered once it has used all its attempts. Later events for the
+// same transfer are held back until it is delivered or dead, so each
+// transfer's events are delivered in order.
+func (d *OutboxDispatcher) DispatchPending(ctx context.Context) (int, error) {
+	events, err := d.store.PendingEvents(ctx, d.batchSize)
+	if err != nil {
+		return 0, errors.NewAnchorError(errors.STORE_ERROR, "failed to load pending events", err)
+	}
+	delivered := 0
+	blocked := make(map[string]bool)
+	for i := range events {
+		if blocked[events[i].TransferID] {
+			continue
+		}
+		if err := d.deliver(ctx, &events[i]); err != nil {
+			blocked[events[i].TransferID] = true
+			continue
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+// Prune removes delivered and dead events older than the retention and
+// returns how many were removed.
+func (d *OutboxDispatcher) Prune(ctx context.Context) (int, error) {
+	if d.retention <= 0 {
+		return 0, nil
+	}
+	removed, err := d.store.PruneEvents(ctx, time.Now().Add(-d.retention))
+	if err != nil {
+		return 0, errors.NewAnchorError(errors.STORE_ERROR, "failed to prune events", err)
+	}
+	return removed, nil
+}
+
+// Replay redelivers every event recorded for a transfer, including ones that
+// were already delivered or dead-lettered, e.g. after fixing a faulty handler.
+func (d *OutboxDispatcher) Replay(ctx context.Context, transferID string) (int, error) {
+	events, err := d.store.ListEvents(ctx, transferID)
+	if err != nil {
+		return 0, errors.NewAnchorError(errors.STORE_ERROR, "failed to list events", err)
+	}
+	delivered := 0
+	for i := range events {
+		if err := d.deliver(ctx, &events[i]); err != nil {
+			continue
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+// deliver runs the handlers for one event and records the outcome.
+func (d *OutboxDispatcher) deliver(ctx context.Context, evt *stellarconnect.OutboxEvent) error {
+	if err := d.trigger(ctx, evt); err != nil {
+		// The attempt is retried even if recording it fails.
+		_ = d.fail(ctx, evt, err)
+		return err
+	}
+	if err := d.store.MarkDelivered(ctx, evt.ID); err != nil {
+		return errors.NewAnchorError(errors.STORE_ERROR, "failed to mark event delivered", err)
+	}
+	return nil
+}
+
+// fail records a failed attempt, scheduling the next one after an
+// exponential backoff or dead-lettering the event once it is out of attempts.
+// Failed replays of delivered events are only recorded.
+func (d *OutboxDispatcher) fail(ctx context.Context, evt *stellarconnect.OutboxEvent, cause error) error {
+	attempts := evt.Attempts + 1
+	if evt.DeliveredAt == nil && d.maxAttempts > 0 && attempts >= d.maxAttempts {
+		return d.store.MarkDead(ctx, evt.ID, cause.Error())
+	}
+	delay := d.backoff
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	if d.maxBackoff > 0 {
+		delay = min(delay, d.maxBackoff)
+	}
+	return d.store.MarkFailed(ctx, evt.ID, cause.Error(), time.Now().Add(delay))
+}
+
+// trigger fires the event's hook with its transfer snapshot. Handler errors,
+// including recovered panics, fail the attempt so the event is retried.
+func (d *OutboxDispatcher) trigger(ctx context.Context, evt *stellarconnect.OutboxEvent) error {
+	snapshot := evt.Transfer
+	return d.hooks.Trigger(ctx, &HookEnvelope{
+		Event:          HookEvent(evt.Event),
+		Transfer:       &snapshot,
+		PreviousStatus: evt.PreviousStatus,
+		Status:         snapshot.Status,
+		Changes:        evt.Changes,
+		Actor:          evt.Actor,
+		Timestamp:      evt.CreatedAt,
+		CorrelationID:  evt.CorrelationID,
+	})
+}
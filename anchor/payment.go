@@ -0,0 +1,254 @@
+package anchor
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/core/amount"
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+)
+
+// MismatchAction is the policy applied when an incoming Stellar payment does
+// not match the transfer it was matched to.
+type MismatchAction string
+
+const (
+	// MismatchHold leaves the transfer in its current status for operator
+	// review. This is the default for every mismatch kind.
+	MismatchHold MismatchAction = "hold"
+
+	// MismatchAccept accepts the payment and adjusts the transfer to what was
+	// actually received before moving it to pending_stellar.
+	MismatchAccept MismatchAction = "accept"
+
+	// MismatchRefund flags the payment for refund. The anchor returns the funds
+	// and then calls TransferManager.NotifyRefunded.
+	MismatchRefund MismatchAction = "refund"
+)
+
+// PaymentMismatchKind describes how a received payment differs from the transfer.
+type PaymentMismatchKind string
+
+const (
+	MismatchOverpayment  PaymentMismatchKind = "overpayment"
+	MismatchUnderpayment PaymentMismatchKind = "underpayment"
+	MismatchWrongAsset   PaymentMismatchKind = "wrong_asset"
+)
+
+// PaymentPolicy configures how NotifyPaymentReceived handles payments that do
+// not match the transfer. Empty fields default to MismatchHold.
+type PaymentPolicy struct {
+	Overpayment  MismatchAction
+	Underpayment MismatchAction
+	WrongAsset   MismatchAction
+}
+
+// actionFor returns the configured action for the given mismatch kind.
+func (p PaymentPolicy) actionFor(kind PaymentMismatchKind) MismatchAction {
+	var action MismatchAction
+	switch kind {
+	case MismatchOverpayment:
+		action = p.Overpayment
+	case MismatchUnderpayment:
+		action = p.Underpayment
+	case MismatchWrongAsset:
+		action = p.WrongAsset
+	}
+	if action == "" {
+		return MismatchHold
+	}
+	return action
+}
+
+// PaymentMismatch describes a discrepancy between a received payment and the
+// transfer it was matched to. It is recorded in the transfer's Metadata under
+// the "payment_mismatch" key before HookPaymentMismatch fires.
+type PaymentMismatch struct {
+	Kind           PaymentMismatchKind
+	Action         MismatchAction
+	ExpectedAmount string
+	ReceivedAmount string
+	ExpectedAsset  string
+	ReceivedAsset  string
+}
+
+func (m *PaymentMismatch) metadata() map[string]any {
+	return map[string]any{
+		"kind":            string(m.Kind),
+		"action":          string(m.Action),
+		"expected_amount": m.ExpectedAmount,
+		"received_amount": m.ReceivedAmount,
+		"expected_asset":  m.ExpectedAsset,
+		"received_asset":  m.ReceivedAsset,
+	}
+}
+
+func (m *PaymentMismatch) message() string {
+	switch m.Kind {
+	case MismatchWrongAsset:
+		return fmt.Sprintf("payment mismatch: received %s, expected %s", m.ReceivedAsset, m.ExpectedAsset)
+	default:
+		return fmt.Sprintf("payment mismatch: received %s, expected %s", m.ReceivedAmount, m.ExpectedAmount)
+	}
+}
+
+// error returns the PAYMENT_MISMATCH error reported to the caller.
+func (m *PaymentMismatch) error(transferID string) error {
+	err := errors.NewAnchorError(errors.PAYMENT_MISMATCH, fmt.Sprintf("%s (%s)", m.message(), m.Action), nil)
+	err.Context["transfer_id"] = transferID
+	err.Context["kind"] = string(m.Kind)
+	err.Context["action"] = string(m.Action)
+	err.Context["expected_amount"] = m.ExpectedAmount
+	err.Context["received_amount"] = m.ReceivedAmount
+	err.Context["expected_asset"] = m.ExpectedAsset
+	err.Context["received_asset"] = m.ReceivedAsset
+	return err
+}
+
+// checkPayment compares a received payment against the transfer. total is
+// the amount received so far including this payment, as returned by
+// receivedTotal. It returns nil if the payment matches. Unknown received fields
+// are not validated, which keeps callers that only know the transaction hash
+// working.
+//
+// A transfer recorded with a zero amount (e.g. an interactive withdrawal where
+// the user never entered one) accepts any positive amount.
+func checkPayment(transfer *stellarconnect.Transfer, details PaymentReceivedDetails, total *amount.Amount, policy PaymentPolicy) *PaymentMismatch {
+	mismatch := &PaymentMismatch{
+		ExpectedAmount: transfer.Amount.String(),
+		ReceivedAmount: details.Amount,
+		ExpectedAsset:  formatTransferAsset(transfer),
+		ReceivedAsset:  details.AssetCode,
+	}
+
+	if wrongAsset(transfer, details) {
+		mismatch.Kind = MismatchWrongAsset
+		mismatch.Action = policy.actionFor(MismatchWrongAsset)
+		return mismatch
+	}
+
+	if total == nil {
+		return nil
+	}
+	mismatch.ReceivedAmount = total.String()
+
+	switch {
+	case transfer.Amount.IsZero() || total.Equal(transfer.Amount):
+		return nil
+	case total.GreaterThan(transfer.Amount):
+		mismatch.Kind = MismatchOverpayment
+	default:
+		mismatch.Kind = MismatchUnderpayment
+	}
+	mismatch.Action = policy.actionFor(mismatch.Kind)
+	return mismatch
+}
+
+// receivedTotal returns the amount received for the transfer including this
+// payment: the payment's amount added to Transfer.AmountReceived, or the
+// payment alone if it is in a different asset. It returns nil when the
+// payment's amount is unknown.
+func receivedTotal(transfer *stellarconnect.Transfer, details PaymentReceivedDetails) (*amount.Amount, error) {
+	if strings.TrimSpace(details.Amount) == "" {
+		return nil, nil
+	}
+	received, err := amount.Parse(details.Amount)
+	if err != nil || !received.IsPositive() {
+		return nil, errors.NewAnchorError(errors.PAYMENT_MISMATCH, fmt.Sprintf("invalid received amount %q", details.Amount), err)
+	}
+	if wrongAsset(transfer, details) {
+		return &received, nil
+	}
+	if reported(transfer, details.StellarTxHash) {
+		// Reported again, e.g. by an observer replaying from an older cursor.
+		total := transfer.AmountReceived
+		return &total, nil
+	}
+	total, err := transfer.AmountReceived.Add(received)
+	if err != nil {
+		return nil, errors.NewAnchorError(errors.PAYMENT_MISMATCH, "received amount overflows", err)
+	}
+	return &total, nil
+}
+
+// receivedHashesKey is the Metadata key listing the transaction hashes of the
+// payments counted in Transfer.AmountReceived.
+const receivedHashesKey = "received_tx_hashes"
+
+// reported reports whether the payment in txHash was already counted in the
+// transfer's AmountReceived.
+func reported(transfer *stellarconnect.Transfer, txHash string) bool {
+	if strings.TrimSpace(txHash) == "" {
+		return false
+	}
+	return transfer.StellarTxHash == txHash || slices.Contains(receivedHashes(transfer), txHash)
+}
+
+// receivedHashes returns the hashes listed under receivedHashesKey. Stores
+// that round-trip Metadata through JSON return them as []any.
+func receivedHashes(transfer *stellarconnect.Transfer) []string {
+	switch hashes := transfer.Metadata[receivedHashesKey].(type) {
+	case []string:
+		return hashes
+	case []any:
+		result := make([]string, 0, len(hashes))
+		for _, h := range hashes {
+			if s, ok := h.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// wrongAsset reports whether the payment names an asset other than the
+// transfer's.
+func wrongAsset(transfer *stellarconnect.Transfer, details PaymentReceivedDetails) bool {
+	return strings.TrimSpace(details.AssetCode) != "" && !assetMatches(transfer, details.AssetCode)
+}
+
+// assetMatches reports whether a received asset matches the transfer's asset.
+// The received asset may be "native", "CODE" or "CODE:ISSUER". The issuer is
+// only compared when both sides specify one.
+func assetMatches(transfer *stellarconnect.Transfer, received string) bool {
+	code, issuer, _ := strings.Cut(received, ":")
+	if isNativeAsset(code) || isNativeAsset(transfer.AssetCode) {
+		return isNativeAsset(code) && isNativeAsset(transfer.AssetCode)
+	}
+	if code != transfer.AssetCode {
+		return false
+	}
+	if issuer != "" && transfer.AssetIssuer != "" && issuer != transfer.AssetIssuer {
+		return false
+	}
+	return true
+}
+
+func isNativeAsset(code string) bool {
+	return code == "native" || code == "XLM"
+}
+
+// formatTransferAsset returns the transfer's asset as "CODE:ISSUER", or just
+// "CODE" when the issuer is unknown.
+func formatTransferAsset(transfer *stellarconnect.Transfer) string {
+	if transfer.AssetIssuer == "" {
+		return transfer.AssetCode
+	}
+	return transfer.AssetCode + ":" + transfer.AssetIssuer
+}
+
+// mergeMetadata returns a copy of existing with the given keys added.
+// TransferUpdate.Metadata replaces the whole map, so callers must merge first.
+func mergeMetadata(existing map[string]any, keys map[string]any) map[string]any {
+	merged := make(map[string]any, len(existing)+len(keys))
+	for k, v := range existing {
+		merged[k] = v
+	}
+	for k, v := range keys {
+		merged[k] = v
+	}
+	return merged
+}
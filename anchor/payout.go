@@ -0,0 +1,844 @@
+package anchor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+	"github.com/stellar/go/txnbuild"
+)
+
+const (
+	defaultPayoutTimeout      = 5 * time.Minute
+	defaultPayoutPollInterval = 5 * time.Second
+	defaultPayoutBatchSize    = 20
+	defaultTrustCheckInterval = time.Minute
+
+	// payoutLockWait bounds how long ProcessPending waits for a transfer that
+	// another worker is paying out before moving on.
+	payoutLockWait = 100 * time.Millisecond
+
+	// maxPayoutSubmissions is how many submissions Process makes before
+	// giving up, when transactions expire, hit a stale sequence number, or
+	// are fee-bumped.
+	maxPayoutSubmissions = 5
+
+	// payoutExpiryGrace is how long after a transaction's max time Process
+	// waits before treating it as expired, to allow for ledger close time.
+	payoutExpiryGrace = 10 * time.Second
+)
+
+// PayoutConfig configures a PayoutWorker.
+type PayoutConfig struct {
+	Signer             stellarconnect.Signer               // Required: signs payments from the distribution account
+	Payouts            stellarconnect.PayoutStore          // Optional: keeps payout progress (default: the transfer store, if it implements PayoutStore)
+	Submitter          stellarconnect.TransactionSubmitter // Required: submits transactions to the network
+	NetworkPassphrase  string                              // Required: network the transactions are signed for
+	SourceAccount      string                              // Optional: paying account (default: Config.DistributionAccount, then Signer.PublicKey())
+	AssetIssuers       map[string]string                   // Optional: issuer per asset code, for transfers without AssetIssuer
+	Fees               FeeStrategy                         // Optional: fee per operation (default: FixedFee(100))
+	FeeAccount         stellarconnect.Signer               // Optional: fee-bumps payments that miss inclusion
+	TxTimeout          time.Duration                       // Optional: validity window of each payment transaction (default: 5m)
+	PollInterval       time.Duration                       // Optional: how often Run looks for pending payouts (default: 5s)
+	BatchSize          int                                 // Optional: payouts processed per poll (default: 20)
+	Channels           *ChannelPool                        // Optional: submit through channel accounts, one concurrent payout per channel
+	BatchOps           int                                 // Optional: deposits paid per transaction, up to 100 (default: 1); deposits with a memo are paid alone
+	Accounts           stellarconnect.AccountInfoFetcher   // Optional: checks the user's trustline before paying an issued asset
+	TrustCheckInterval time.Duration                       // Optional: how often Run rechecks deposits in pending_trust (default: 1m; requires Accounts)
+}
+
+// PayoutWorker sends the Stellar payment for deposits in pending_stellar and
+// completes them with NotifyPaymentSent.
+//
+// Each payment is built with the transfer's deposit memo, signed, and recorded
+// in the PayoutStore before it is submitted. If the submission times out, the
+// next attempt looks the hash up and resubmits the same envelope until it
+// expires, so a payment is never sent twice. Expired transactions and stale
+// sequence numbers lead to a fresh transaction. Any other rejection is stored
+// as the payout's Error and the transfer is held until Retry is called.
+// Payout state is kept out of the transfer, so it never reaches its metadata,
+// history, hooks, or webhooks.
+//
+// If the payment fails with op_no_trust and the wallet set
+// ClaimableBalanceSupported on the deposit, the payout is retried as a
+// claimable balance for the user (PayoutState.Claimable is set) and its
+// ID is recorded on the transfer. Otherwise the deposit moves to
+// pending_trust and waits for the user to add the trustline. With an
+// Accounts fetcher the trustline is checked before building the payment, so
+// no failed transaction is needed, and Run periodically resumes deposits
+// whose trustline has appeared; observer.AutoResumeTrustlines resumes them as
+// soon as the change_trust operation is seen.
+//
+// Fees are chosen by the FeeStrategy when a transaction is built. With a
+// FeeAccount, a payment that times out or is rejected with
+// tx_insufficient_fee is wrapped in a fee bump paid by that account, bidding
+// ten times the previous fee within the strategy's cap; the inner
+// transaction is unchanged, so it can still only be applied once. Without
+// one, tx_insufficient_fee leads to a fresh transaction at the current fee.
+//
+// With a ChannelPool, each transaction's source is a leased channel account
+// and the payment's source is the distribution account, so ProcessPending
+// can submit one payout per channel at a time.
+type PayoutWorker struct {
+	tm           *TransferManager
+	payouts      stellarconnect.PayoutStore
+	signer       stellarconnect.Signer
+	submitter    stellarconnect.TransactionSubmitter
+	passphrase   string
+	source       string
+	issuers      map[string]string
+	fees         FeeStrategy
+	feeAccount   stellarconnect.Signer
+	txTimeout    time.Duration
+	pollInterval time.Duration
+	batchSize    int
+	channels     *ChannelPool
+	batchOps     int
+	accounts     stellarconnect.AccountInfoFetcher
+	trustCheck   time.Duration
+}
+
+// NewPayoutWorker creates a worker that pays out deposits managed by tm.
+// Returns a CONFIG_INVALID error if a required field is missing.
+func NewPayoutWorker(tm *TransferManager, config PayoutConfig) (*PayoutWorker, error) {
+	if tm == nil || tm.store == nil {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "transfer manager with a store is required", nil)
+	}
+	if config.Signer == nil {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "signer is required", nil)
+	}
+	if config.Submitter == nil {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "submitter is required", nil)
+	}
+	if config.NetworkPassphrase == "" {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "network passphrase is required", nil)
+	}
+	if config.Payouts == nil {
+		payouts, ok := tm.store.(stellarconnect.PayoutStore)
+		if !ok {
+			return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "payout store is required when the transfer store does not implement PayoutStore", nil)
+		}
+		config.Payouts = payouts
+	}
+
+	source := config.SourceAccount
+	if source == "" {
+		source = tm.config.DistributionAccount
+	}
+	if source == "" {
+		source = config.Signer.PublicKey()
+	}
+	if config.Fees == nil {
+		config.Fees = FixedFee(txnbuild.MinBaseFee)
+	}
+	if config.TxTimeout <= 0 {
+		config.TxTimeout = defaultPayoutTimeout
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaultPayoutPollInterval
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultPayoutBatchSize
+	}
+	if config.BatchOps > maxBatchOps {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, fmt.Sprintf("batch ops cannot exceed %d", maxBatchOps), nil)
+	}
+	if config.BatchOps <= 0 {
+		config.BatchOps = 1
+	}
+	if config.TrustCheckInterval <= 0 {
+		config.TrustCheckInterval = defaultTrustCheckInterval
+	}
+
+	return &PayoutWorker{
+		tm:           tm,
+		payouts:      config.Payouts,
+		signer:       config.Signer,
+		submitter:    config.Submitter,
+		passphrase:   config.NetworkPassphrase,
+		source:       source,
+		issuers:      config.AssetIssuers,
+		fees:         config.Fees,
+		feeAccount:   config.FeeAccount,
+		txTimeout:    config.TxTimeout,
+		pollInterval: config.PollInterval,
+		batchSize:    config.BatchSize,
+		channels:     config.Channels,
+		batchOps:     config.BatchOps,
+		accounts:     config.Accounts,
+		trustCheck:   config.TrustCheckInterval,
+	}, nil
+}
+
+// Run processes pending payouts until ctx is cancelled, polling every
+// PollInterval. Failed payouts are retried on the next poll unless held.
+// With an Accounts fetcher, deposits in pending_trust are rechecked every
+// TrustCheckInterval.
+func (w *PayoutWorker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+	lastTrustCheck := time.Now()
+	for {
+		if w.accounts != nil && time.Since(lastTrustCheck) >= w.trustCheck {
+			_, _ = w.CheckTrustlines(ctx)
+			lastTrustCheck = time.Now()
+		}
+		// Errors are recorded on the transfers and retried on the next tick.
+		_, _ = w.ProcessPending(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckTrustlines looks up the account of each deposit waiting in
+// pending_trust and resumes those that can now receive the asset, so the
+// next ProcessPending pays them out. Returns how many were resumed.
+// Requires an Accounts fetcher; without one it does nothing.
+func (w *PayoutWorker) CheckTrustlines(ctx context.Context) (int, error) {
+	if w.accounts == nil {
+		return 0, nil
+	}
+	status := stellarconnect.StatusPendingTrust
+	kind := stellarconnect.KindDeposit
+	transfers, err := w.tm.store.List(ctx, stellarconnect.TransferFilters{
+		Status: &status,
+		Kind:   &kind,
+		Limit:  w.batchSize,
+	})
+	if err != nil {
+		return 0, errors.NewAnchorError(errors.STORE_ERROR, "failed to list deposits waiting for a trustline", err)
+	}
+
+	resumed := 0
+	var firstErr error
+	for i, transfer := range transfers {
+		if i >= w.batchSize {
+			break
+		}
+		trusted, err := w.trusted(ctx, transfer)
+		if err == nil && trusted {
+			err = w.tm.NotifyTrustlineAdded(ctx, transfer.ID)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if trusted {
+			resumed++
+		}
+	}
+	return resumed, firstErr
+}
+
+// ProcessPending pays out up to BatchSize deposits in pending_stellar and
+// returns how many were completed or moved to pending_trust. Held transfers
+// and transfers locked by another worker are skipped. With BatchOps, deposits
+// without a memo are paid together, BatchOps per transaction. With a
+// ChannelPool, up to one transaction per channel is submitted concurrently.
+// Processing continues past failures; the first error is returned.
+func (w *PayoutWorker) ProcessPending(ctx context.Context) (int, error) {
+	status := stellarconnect.StatusPendingStellar
+	kind := stellarconnect.KindDeposit
+	transfers, err := w.tm.store.List(ctx, stellarconnect.TransferFilters{
+		Status: &status,
+		Kind:   &kind,
+		Limit:  w.batchSize,
+	})
+	if err != nil {
+		return 0, errors.NewAnchorError(errors.STORE_ERROR, "failed to list pending payouts", err)
+	}
+
+	var jobs []func() (int, error)
+	var batchable []string
+	for i, transfer := range transfers {
+		if i >= w.batchSize {
+			break
+		}
+		payout, err := w.payout(ctx, transfer.ID)
+		if err != nil {
+			return 0, err
+		}
+		if payout.Error != "" {
+			continue
+		}
+		if w.batchable(transfer, payout) {
+			batchable = append(batchable, transfer.ID)
+			continue
+		}
+		jobs = append(jobs, func() (int, error) {
+			return w.processLocked(ctx, transfer.ID)
+		})
+	}
+	for start := 0; start < len(batchable); start += w.batchOps {
+		ids := batchable[start:min(start+w.batchOps, len(batchable))]
+		jobs = append(jobs, func() (int, error) {
+			return w.processBatchLocked(ctx, ids)
+		})
+	}
+
+	concurrency := 1
+	if w.channels != nil {
+		concurrency = w.channels.Size()
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		handled  int
+		firstErr error
+	)
+	sem := make(chan struct{}, concurrency)
+	for _, job := range jobs {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			n, err := job()
+
+			mu.Lock()
+			defer mu.Unlock()
+			handled += n
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}()
+	}
+	wg.Wait()
+	return handled, firstErr
+}
+
+// processLocked processes a single transfer unless another worker holds its
+// payout lock. Returns 1 if it was completed or moved to pending_trust.
+func (w *PayoutWorker) processLocked(ctx context.Context, transferID string) (int, error) {
+	lease, err := w.tryLock(ctx, transferID)
+	if err != nil {
+		return 0, nil
+	}
+	defer lease.Release(ctx)
+
+	if err := w.process(ctx, transferID); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// Process pays out a single deposit, waiting for any other worker processing
+// it to finish. Returns nil once the transfer is completed or waiting in
+// pending_trust.
+func (w *PayoutWorker) Process(ctx context.Context, transferID string) error {
+	lease, err := w.lock(ctx, transferID)
+	if err != nil {
+		return err
+	}
+	defer lease.Release(ctx)
+
+	return w.process(ctx, transferID)
+}
+
+// Retry clears a held payout's error and processes it again.
+func (w *PayoutWorker) Retry(ctx context.Context, transferID string) error {
+	lease, err := w.lock(ctx, transferID)
+	if err != nil {
+		return err
+	}
+	defer lease.Release(ctx)
+
+	if err := w.updatePayout(ctx, transferID, func(p *stellarconnect.PayoutState) { p.Error = "" }); err != nil {
+		return err
+	}
+	return w.process(ctx, transferID)
+}
+
+// lock acquires the payout lock for a transfer. The lease covers a full
+// transaction validity window plus one slow submission.
+func (w *PayoutWorker) lock(ctx context.Context, transferID string) (stellarconnect.Lease, error) {
+	lease, err := w.tm.config.Locker.Acquire(ctx, "payout:"+transferID, w.txTimeout+time.Minute)
+	if err != nil {
+		return nil, errors.NewAnchorError(errors.LOCK_FAILED, "failed to lock payout", err)
+	}
+	return lease, nil
+}
+
+// tryLock is lock with a short wait, for skipping busy transfers.
+func (w *PayoutWorker) tryLock(ctx context.Context, transferID string) (stellarconnect.Lease, error) {
+	lockCtx, cancel := context.WithTimeout(ctx, payoutLockWait)
+	defer cancel()
+	return w.lock(lockCtx, transferID)
+}
+
+// process runs the payout state machine for a transfer. The caller must hold
+// the payout lock.
+func (w *PayoutWorker) process(ctx context.Context, transferID string) error {
+	for attempt := 0; attempt < maxPayoutSubmissions; attempt++ {
+		transfer, err := w.tm.store.FindByID(ctx, transferID)
+		if err != nil {
+			return errors.NewAnchorError(errors.STORE_ERROR, "failed to load transfer", err)
+		}
+		if transfer.Kind != stellarconnect.KindDeposit || transfer.Status != stellarconnect.StatusPendingStellar {
+			return errors.NewAnchorError(errors.TRANSITION_INVALID, "transfer is not a deposit awaiting a Stellar payment", nil)
+		}
+		payout, err := w.payout(ctx, transfer.ID)
+		if err != nil {
+			return err
+		}
+		if payout.Error != "" {
+			return payoutError(transfer.ID, "payout is held: "+payout.Error, nil)
+		}
+
+		var channel *ChannelLease
+		envelope, hash, expiresAt := payout.Envelope, payout.TxHash, payout.ExpiresAt
+		if envelope != "" {
+			// An earlier attempt may have reached the network.
+			result, err := w.submitter.TransactionStatus(ctx, hash)
+			if err != nil {
+				return payoutError(transfer.ID, "failed to check earlier payout transaction", err)
+			}
+			if result != nil {
+				return w.finish(ctx, transfer.ID, envelope, payout.OpIndex, result)
+			}
+			if time.Now().After(expiresAt.Add(payoutExpiryGrace)) {
+				if err := w.clearPending(ctx, transfer.ID); err != nil {
+					return err
+				}
+				continue
+			}
+			// Keep its channel from being reused, also after a restart,
+			// until the envelope is final.
+			if w.channels != nil && payout.Channel != "" {
+				w.channels.Hold(payout.Channel, expiresAt.Add(payoutExpiryGrace))
+			}
+			// It missed inclusion; outbid it if possible.
+			if envelope, err = w.bump(ctx, transfer.ID, envelope); err != nil {
+				return err
+			}
+		} else {
+			if !payout.Claimable {
+				trusted, err := w.trusted(ctx, transfer)
+				if err != nil {
+					return err
+				}
+				if !trusted {
+					if transfer.ClaimableBalanceSupported {
+						if err := w.updatePayout(ctx, transfer.ID, func(p *stellarconnect.PayoutState) { p.Claimable = true }); err != nil {
+							return err
+						}
+						continue
+					}
+					return w.tm.NotifyTrustlineRequired(ctx, transfer.ID)
+				}
+			}
+			channel, envelope, hash, expiresAt, err = w.build(ctx, transfer, payout)
+			if err != nil {
+				return err
+			}
+			// Persist before submitting so a crash or timeout cannot lead to
+			// a second, different payment.
+			if err := w.updatePayout(ctx, transfer.ID, func(p *stellarconnect.PayoutState) {
+				p.TxHash, p.Envelope, p.ExpiresAt, p.OpIndex = hash, envelope, expiresAt, 0
+				p.Channel = channelAccount(channel)
+			}); err != nil {
+				if channel != nil {
+					channel.Discard()
+				}
+				return err
+			}
+		}
+
+		result, err := w.submitter.SubmitTransaction(ctx, envelope)
+		w.endLease(channel, err, expiresAt)
+		if err == nil {
+			return w.finish(ctx, transfer.ID, envelope, payout.OpIndex, result)
+		}
+		submitErr, rejected := stellarconnect.AsSubmitError(err)
+		if !rejected {
+			return payoutError(transfer.ID, "payout submission outcome unknown; it will be checked and resubmitted", err)
+		}
+		if submitErr.TransactionCode == "tx_insufficient_fee" && w.feeAccount != nil {
+			// Still valid; the next attempt fee-bumps it.
+			continue
+		}
+		opCode := operationCode(submitErr, payout.OpIndex)
+		if opCode == "op_no_trust" && transfer.ClaimableBalanceSupported && !payout.Claimable {
+			// The user has no trustline for the asset; the payment failed
+			// in the ledger, so pay a claimable balance instead.
+			if err := w.updatePayout(ctx, transfer.ID, func(p *stellarconnect.PayoutState) {
+				clearTransaction(p)
+				p.Claimable = true
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+		if opCode == "op_no_trust" && !transfer.ClaimableBalanceSupported {
+			// Wait in pending_trust for the user to add the trustline.
+			if err := w.clearPending(ctx, transfer.ID); err != nil {
+				return err
+			}
+			return w.tm.NotifyTrustlineRequired(ctx, transfer.ID)
+		}
+		if submitErr.TransactionCode == "tx_failed" && opCode == "op_success" {
+			// Another payment in the batch failed; pay this one again.
+			if err := w.clearPending(ctx, transfer.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		if !w.rebuildable(submitErr) {
+			return w.hold(ctx, transfer.ID, submitErr.Error(), submitErr)
+		}
+		// The envelope can no longer be applied, unless it already was.
+		result, err = w.submitter.TransactionStatus(ctx, hash)
+		if err != nil {
+			return payoutError(transfer.ID, "failed to check rejected payout transaction", err)
+		}
+		if result != nil {
+			return w.finish(ctx, transfer.ID, envelope, payout.OpIndex, result)
+		}
+		if err := w.clearPending(ctx, transfer.ID); err != nil {
+			return err
+		}
+	}
+	return payoutError(transferID, fmt.Sprintf("payout not accepted after %d submissions", maxPayoutSubmissions), nil)
+}
+
+// endLease ends a channel lease after submitting a transaction. While the
+// transaction may still be applied it stays recorded as pending, so the
+// channel is held until the payout settles it or the transaction expires;
+// otherwise another payout could be built on the same sequence number.
+func (w *PayoutWorker) endLease(channel *ChannelLease, submitErr error, expiresAt time.Time) {
+	if channel == nil {
+		return
+	}
+	submitError, rejected := stellarconnect.AsSubmitError(submitErr)
+	if submitErr != nil && (!rejected || submitError.TransactionCode == "tx_insufficient_fee" && w.feeAccount != nil) {
+		channel.Hold(expiresAt.Add(payoutExpiryGrace))
+		return
+	}
+	channel.Release(submitErr)
+}
+
+// channelAccount returns the account of a leased channel, or "" without one.
+func channelAccount(channel *ChannelLease) string {
+	if channel == nil {
+		return ""
+	}
+	return channel.Account()
+}
+
+// bump fee-bumps a pending envelope and records it, if a fee account is
+// configured and the fee can still be raised. Otherwise the envelope is
+// returned unchanged for resubmission.
+func (w *PayoutWorker) bump(ctx context.Context, transferID string, envelope string) (string, error) {
+	if w.feeAccount == nil {
+		return envelope, nil
+	}
+	bumped, ok, err := feeBump(ctx, envelope, w.fees, w.feeAccount, w.passphrase)
+	if err != nil {
+		return "", payoutError(transferID, "failed to fee-bump payment", err)
+	}
+	if !ok {
+		return envelope, nil
+	}
+	if err := w.updatePayout(ctx, transferID, func(p *stellarconnect.PayoutState) { p.Envelope = bumped }); err != nil {
+		return "", err
+	}
+	return bumped, nil
+}
+
+// build creates and signs the payment transaction for a transfer. With a
+// ChannelPool it returns the leased channel, which the caller must release
+// after submitting. Problems with the transfer itself hold the payout.
+func (w *PayoutWorker) build(ctx context.Context, transfer *stellarconnect.Transfer, payout *stellarconnect.PayoutState) (channel *ChannelLease, envelope, hash string, expiresAt time.Time, err error) {
+	memo, err := transactionMemo(transfer.DepositMemo, transfer.DepositMemoType)
+	if err != nil {
+		return nil, "", "", time.Time{}, w.hold(ctx, transfer.ID, "invalid deposit memo: "+err.Error(), err)
+	}
+	payment, err := w.operation(ctx, transfer, payout)
+	if err != nil {
+		return nil, "", "", time.Time{}, err
+	}
+	return w.assemble(ctx, transfer.ID, []txnbuild.Operation{payment}, memo)
+}
+
+// operation returns the validated operation paying out a transfer, holding
+// the payout if the transfer cannot be paid as it stands.
+func (w *PayoutWorker) operation(ctx context.Context, transfer *stellarconnect.Transfer, payout *stellarconnect.PayoutState) (txnbuild.Operation, error) {
+	asset, err := w.asset(transfer)
+	if err != nil {
+		return nil, w.hold(ctx, transfer.ID, err.Error(), err)
+	}
+	payment, err := w.paymentOp(transfer, payout, asset)
+	if err != nil {
+		return nil, w.hold(ctx, transfer.ID, err.Error(), err)
+	}
+	if err := payment.Validate(); err != nil {
+		return nil, w.hold(ctx, transfer.ID, "invalid payment: "+err.Error(), err)
+	}
+	return payment, nil
+}
+
+// assemble builds and signs a transaction with the given operations. label
+// identifies the transfers paid, for errors. With a ChannelPool it returns
+// the leased channel, which the caller must release after submitting.
+func (w *PayoutWorker) assemble(ctx context.Context, label string, ops []txnbuild.Operation, memo txnbuild.Memo) (channel *ChannelLease, envelope, hash string, expiresAt time.Time, err error) {
+	source := w.source
+	var seq int64
+	if w.channels != nil {
+		channel, err = w.channels.Acquire(ctx)
+		if err != nil {
+			return nil, "", "", time.Time{}, payoutError(label, "failed to lease channel account", err)
+		}
+		source = channel.Account()
+		seq, err = channel.Sequence(ctx)
+	} else {
+		seq, err = w.submitter.SequenceNumber(ctx, w.source)
+	}
+	if err != nil {
+		return w.abandon(channel, payoutError(label, "failed to load source account sequence", err))
+	}
+	fee, err := w.fees.BaseFee(ctx)
+	if err != nil {
+		return w.abandon(channel, payoutError(label, "failed to choose fee", err))
+	}
+
+	expiresAt = time.Now().Add(w.txTimeout)
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &txnbuild.SimpleAccount{AccountID: source, Sequence: seq},
+		IncrementSequenceNum: true,
+		Operations:           ops,
+		BaseFee:              fee,
+		Memo:                 memo,
+		Preconditions:        txnbuild.Preconditions{TimeBounds: txnbuild.NewTimebounds(0, expiresAt.Unix())},
+	})
+	if err != nil {
+		return w.abandon(channel, payoutError(label, "failed to build payment", err))
+	}
+	hash, err = tx.HashHex(w.passphrase)
+	if err != nil {
+		return w.abandon(channel, payoutError(label, "failed to hash payment", err))
+	}
+	unsigned, err := tx.Base64()
+	if err != nil {
+		return w.abandon(channel, payoutError(label, "failed to encode payment", err))
+	}
+	if channel != nil {
+		envelope, err = channel.Sign(ctx, unsigned, w.signer)
+	} else {
+		envelope, err = w.signer.SignTransaction(ctx, unsigned, w.passphrase)
+	}
+	if err != nil {
+		return w.abandon(channel, payoutError(label, "failed to sign payment", err))
+	}
+	return channel, envelope, hash, expiresAt, nil
+}
+
+// paymentOp returns the operation delivering the deposit: a payment, or a
+// claimable balance for the user after a missing trustline. With a
+// ChannelPool the operation's source is the distribution account.
+func (w *PayoutWorker) paymentOp(transfer *stellarconnect.Transfer, payout *stellarconnect.PayoutState, asset txnbuild.Asset) (txnbuild.Operation, error) {
+	var opSource string
+	if w.channels != nil {
+		opSource = w.source
+	}
+	if !payout.Claimable {
+		return &txnbuild.Payment{
+			Destination:   transfer.Account,
+			Amount:        transfer.Amount.String(),
+			Asset:         asset,
+			SourceAccount: opSource,
+		}, nil
+	}
+	claimant, err := baseAccount(transfer.Account)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deposit account: %w", err)
+	}
+	return &txnbuild.CreateClaimableBalance{
+		Destinations:  []txnbuild.Claimant{txnbuild.NewClaimant(claimant, nil)},
+		Amount:        transfer.Amount.String(),
+		Asset:         asset,
+		SourceAccount: opSource,
+	}, nil
+}
+
+// abandon returns an unused channel to the pool and passes err through as
+// assemble's result.
+func (w *PayoutWorker) abandon(channel *ChannelLease, err error) (*ChannelLease, string, string, time.Time, error) {
+	if channel != nil {
+		channel.Discard()
+	}
+	return nil, "", "", time.Time{}, err
+}
+
+// asset returns the Stellar asset paid out for a transfer.
+func (w *PayoutWorker) asset(transfer *stellarconnect.Transfer) (txnbuild.Asset, error) {
+	if isNativeAsset(transfer.AssetCode) {
+		return txnbuild.NativeAsset{}, nil
+	}
+	issuer := transfer.AssetIssuer
+	if issuer == "" {
+		issuer = w.issuers[transfer.AssetCode]
+	}
+	if issuer == "" {
+		return nil, fmt.Errorf("no issuer configured for asset %s", transfer.AssetCode)
+	}
+	return txnbuild.CreditAsset{Code: transfer.AssetCode, Issuer: issuer}, nil
+}
+
+// trusted reports whether the deposit's account can receive its asset. It is
+// true for native assets, without an Accounts fetcher, and when the asset
+// cannot be resolved, leaving build to report the problem. An account that
+// does not exist cannot hold a trustline.
+func (w *PayoutWorker) trusted(ctx context.Context, transfer *stellarconnect.Transfer) (bool, error) {
+	if w.accounts == nil {
+		return true, nil
+	}
+	asset, err := w.asset(transfer)
+	if err != nil || asset.IsNative() {
+		return true, nil
+	}
+	account, err := baseAccount(transfer.Account)
+	if err != nil {
+		return true, nil
+	}
+	info, err := w.accounts.FetchAccountInfo(ctx, account)
+	if err != nil {
+		return false, payoutError(transfer.ID, "failed to check trustline", err)
+	}
+	return info != nil && info.HasTrustline(asset.GetCode()+":"+asset.GetIssuer()), nil
+}
+
+// finish completes the transfer paid by operation opIndex of a transaction
+// that made it into a ledger, or holds it if the transaction failed.
+func (w *PayoutWorker) finish(ctx context.Context, transferID string, envelope string, opIndex int, result *stellarconnect.SubmitResult) error {
+	if !result.Successful {
+		return w.hold(ctx, transferID, fmt.Sprintf("payment transaction %s failed", result.Hash), nil)
+	}
+	balanceID, err := claimableBalanceID(envelope, opIndex)
+	if err != nil {
+		return payoutError(transferID, "failed to derive claimable balance ID", err)
+	}
+	if err := w.tm.NotifyPaymentSent(ctx, transferID, PaymentSentDetails{
+		StellarTxHash:      result.Hash,
+		ClaimableBalanceID: balanceID,
+	}); err != nil {
+		return err
+	}
+	if payout, err := w.payouts.FindPayout(ctx, transferID); err == nil && payout != nil && payout.Channel != "" && w.channels != nil {
+		w.channels.Settle(payout.Channel)
+	}
+	// The transfer is complete; a leftover record is harmless.
+	_ = w.payouts.DeletePayout(ctx, transferID)
+	return nil
+}
+
+// claimableBalanceID returns the ID of the claimable balance created by the
+// envelope's operation opIndex, or "" if it is a plain payment.
+func claimableBalanceID(envelope string, opIndex int) (string, error) {
+	parsed, err := txnbuild.TransactionFromXDR(envelope)
+	if err != nil {
+		return "", err
+	}
+	tx, ok := parsed.Transaction()
+	if feeBump, isFeeBump := parsed.FeeBump(); isFeeBump {
+		tx, ok = feeBump.InnerTransaction(), true
+	}
+	if !ok || opIndex >= len(tx.Operations()) {
+		return "", nil
+	}
+	if _, isClaimable := tx.Operations()[opIndex].(*txnbuild.CreateClaimableBalance); !isClaimable {
+		return "", nil
+	}
+	return tx.ClaimableBalanceID(opIndex)
+}
+
+// hold records a payout error so the transfer is skipped until Retry, and
+// returns it as a PAYOUT_FAILED error.
+func (w *PayoutWorker) hold(ctx context.Context, transferID string, reason string, cause error) error {
+	if err := w.updatePayout(ctx, transferID, func(p *stellarconnect.PayoutState) {
+		p.Error = reason
+		p.Envelope, p.ExpiresAt, p.OpIndex = "", time.Time{}, 0
+	}); err != nil {
+		return err
+	}
+	return payoutError(transferID, reason, cause)
+}
+
+// clearPending forgets a transaction that can no longer be applied.
+func (w *PayoutWorker) clearPending(ctx context.Context, transferID string) error {
+	return w.updatePayout(ctx, transferID, clearTransaction)
+}
+
+// clearTransaction forgets the pending transaction of a payout.
+func clearTransaction(p *stellarconnect.PayoutState) {
+	p.TxHash, p.Envelope, p.ExpiresAt, p.OpIndex = "", "", time.Time{}, 0
+}
+
+// payout returns the payout state of a transfer, empty if it has none.
+func (w *PayoutWorker) payout(ctx context.Context, transferID string) (*stellarconnect.PayoutState, error) {
+	state, err := w.payouts.FindPayout(ctx, transferID)
+	if err != nil {
+		return nil, payoutStoreError(transferID, "failed to load payout state", err)
+	}
+	if state == nil {
+		state = &stellarconnect.PayoutState{TransferID: transferID}
+	}
+	return state, nil
+}
+
+// updatePayout applies fn to the payout state of a transfer and saves it.
+// A transaction is only forgotten once it can no longer be applied, so its
+// channel, if any, is then settled. The caller must hold the payout lock.
+func (w *PayoutWorker) updatePayout(ctx context.Context, transferID string, fn func(*stellarconnect.PayoutState)) error {
+	state, err := w.payout(ctx, transferID)
+	if err != nil {
+		return err
+	}
+	channel := state.Channel
+	fn(state)
+	if state.Envelope == "" {
+		state.Channel = ""
+	}
+	state.UpdatedAt = time.Now()
+	if err := w.payouts.SavePayout(ctx, state); err != nil {
+		return payoutStoreError(transferID, "failed to save payout state", err)
+	}
+	if w.channels != nil && channel != "" && state.Channel != channel {
+		w.channels.Settle(channel)
+	}
+	return nil
+}
+
+// rebuildable reports whether a rejection means a fresh transaction should
+// be built: the envelope can never be applied, or its fee is too low and
+// cannot be bumped.
+func (w *PayoutWorker) rebuildable(err *stellarconnect.SubmitError) bool {
+	switch err.TransactionCode {
+	case "tx_bad_seq", "tx_too_late":
+		return true
+	case "tx_insufficient_fee":
+		return w.feeAccount == nil
+	}
+	return false
+}
+
+func payoutError(transferID, message string, cause error) error {
+	err := errors.NewAnchorError(errors.PAYOUT_FAILED, message, cause)
+	err.Context["transfer_id"] = transferID
+	return err
+}
+
+func payoutStoreError(transferID, message string, cause error) error {
+	err := errors.NewAnchorError(errors.STORE_ERROR, message, cause)
+	err.Context["transfer_id"] = transferID
+	return err
+}
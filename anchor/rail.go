@@ -0,0 +1,427 @@
+package anchor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+	"github.com/marwen-abid/anchor-sdk-go/webhook"
+)
+
+// maxRailWebhookBytes bounds the size of a partner webhook body.
+const maxRailWebhookBytes = 1 << 20
+
+// RailOrderStatus is the state of an order on an off-chain rail.
+type RailOrderStatus string
+
+const (
+	// RailOrderCreated means the partner accepted the order and is waiting
+	// for funds: fiat for a deposit, the user's Stellar payment for a
+	// withdrawal.
+	RailOrderCreated RailOrderStatus = "created"
+
+	// RailOrderFunded means the partner received the funds.
+	RailOrderFunded RailOrderStatus = "funded"
+
+	// RailOrderCompleted means the partner delivered the funds: the Stellar
+	// payment for a deposit, the fiat disbursement for a withdrawal.
+	RailOrderCompleted RailOrderStatus = "completed"
+
+	// RailOrderFailed means the order could not be completed.
+	RailOrderFailed RailOrderStatus = "failed"
+
+	// RailOrderRefunded means the partner returned the funds to the user.
+	RailOrderRefunded RailOrderStatus = "refunded"
+
+	// RailOrderCancelled means the order was cancelled before it was funded.
+	RailOrderCancelled RailOrderStatus = "cancelled"
+)
+
+// RailOrder is an order with an off-chain rail partner backing one transfer.
+type RailOrder struct {
+	ID            string
+	Kind          stellarconnect.TransferKind // deposit (on-ramp) or withdrawal (off-ramp)
+	Status        RailOrderStatus
+	Amount        string            // Optional: amount of the Stellar asset, once known
+	StellarTxHash string            // Optional: Stellar transaction that paid or funded the order
+	Instructions  map[string]string // Optional: partner details, e.g. where the user sends fiat
+	Message       string            // Optional: partner's explanation, e.g. for a failure
+}
+
+// RailOrderRequest asks a rail to create an order for a transfer.
+type RailOrderRequest struct {
+	Transfer *stellarconnect.Transfer
+	QuoteID  string            // Optional: partner quote the order executes
+	Params   map[string]string // Optional: partner-specific parameters
+}
+
+// RailProvider is an off-chain payment partner, such as a bank or an
+// on/off-ramp, that moves the fiat side of transfers. Implementations wrap
+// the partner's API; RailAdapter turns their orders into TransferManager
+// transitions.
+type RailProvider interface {
+	// Name identifies the rail. It prefixes the transfer metadata keys the
+	// adapter writes, e.g. "<name>_order_id".
+	Name() string
+
+	// CreateDepositInstructions creates the order funding a deposit and
+	// returns it with the instructions for the user to send fiat.
+	CreateDepositInstructions(ctx context.Context, req RailOrderRequest) (*RailOrder, error)
+
+	// InitiateDisbursement creates the order paying out a withdrawal off-chain.
+	InitiateDisbursement(ctx context.Context, req RailOrderRequest) (*RailOrder, error)
+
+	// OrderStatus fetches the current state of an order.
+	OrderStatus(ctx context.Context, orderID string) (*RailOrder, error)
+
+	// WebhookConfig returns how the partner authenticates its webhooks: the
+	// Verifier and, if the partner signs a timestamp, TimestampHeader and
+	// Tolerance. The adapter sets Name and Parser.
+	WebhookConfig() webhook.Config
+
+	// ParseWebhook parses a partner webhook that was already authenticated.
+	// It returns (nil, nil) for events that do not concern an order.
+	ParseWebhook(header http.Header, body []byte) (*RailOrder, error)
+}
+
+// RailAdapter connects a RailProvider to a TransferManager. It creates
+// orders for transfers, records them in the transfer metadata, and applies
+// order updates from webhooks or polling as transfer transitions:
+//
+//	deposit:    funded → NotifyFundsReceived, completed → NotifyPaymentSent
+//	withdrawal: funded → NotifyPaymentReceived, completed → NotifyDisbursementSent
+//	both:       failed → Fail, cancelled → Cancel, refunded → NotifyRefunded
+//
+// Updates are idempotent: an order update the transfer already reflects is
+// ignored, so partners may redeliver webhooks.
+type RailAdapter struct {
+	tm   *TransferManager
+	rail RailProvider
+}
+
+// NewRailAdapter creates an adapter driving tm from rail.
+// Returns a CONFIG_INVALID error if either is missing.
+func NewRailAdapter(tm *TransferManager, rail RailProvider) (*RailAdapter, error) {
+	if tm == nil || tm.store == nil {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "transfer manager with a store is required", nil)
+	}
+	if rail == nil {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "rail provider is required", nil)
+	}
+	return &RailAdapter{tm: tm, rail: rail}, nil
+}
+
+// CreateDeposit creates the rail order funding a deposit, records it on the
+// transfer, and completes the interactive flow if the transfer is still
+// interactive. The returned order carries the user's instructions.
+func (a *RailAdapter) CreateDeposit(ctx context.Context, transferID string, req RailOrderRequest) (*RailOrder, error) {
+	return a.createOrder(ctx, transferID, stellarconnect.KindDeposit, req, a.rail.CreateDepositInstructions)
+}
+
+// InitiateDisbursement creates the rail order paying out a withdrawal,
+// records it on the transfer, and completes the interactive flow if the
+// transfer is still interactive.
+func (a *RailAdapter) InitiateDisbursement(ctx context.Context, transferID string, req RailOrderRequest) (*RailOrder, error) {
+	return a.createOrder(ctx, transferID, stellarconnect.KindWithdrawal, req, a.rail.InitiateDisbursement)
+}
+
+func (a *RailAdapter) createOrder(ctx context.Context, transferID string, kind stellarconnect.TransferKind, req RailOrderRequest,
+	create func(context.Context, RailOrderRequest) (*RailOrder, error)) (*RailOrder, error) {
+	transfer, err := a.tm.store.FindByID(ctx, transferID)
+	if err != nil {
+		return nil, errors.NewAnchorError(errors.STORE_ERROR, "failed to load transfer", err)
+	}
+	if transfer.Kind != kind {
+		return nil, errors.NewAnchorError(errors.TRANSITION_INVALID, fmt.Sprintf("transfer is a %s, not a %s", transfer.Kind, kind), nil)
+	}
+
+	req.Transfer = transfer
+	order, err := create(ctx, req)
+	if err != nil {
+		return nil, a.railError("failed to create order", transferID, err)
+	}
+	if err := a.record(ctx, transfer, order); err != nil {
+		return nil, err
+	}
+	if transfer.Status == stellarconnect.StatusInteractive {
+		if err := a.tm.CompleteInteractive(ctx, transferID, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Sync fetches the state of a transfer's order from the rail and applies
+// it, for partners without webhooks or to recover missed ones.
+func (a *RailAdapter) Sync(ctx context.Context, transferID string) error {
+	transfer, err := a.tm.store.FindByID(ctx, transferID)
+	if err != nil {
+		return errors.NewAnchorError(errors.STORE_ERROR, "failed to load transfer", err)
+	}
+	orderID, _ := transfer.Metadata[a.key("order_id")].(string)
+	if orderID == "" {
+		return errors.NewAnchorError(errors.TRANSFER_NOT_FOUND, "transfer has no rail order", nil)
+	}
+	order, err := a.rail.OrderStatus(ctx, orderID)
+	if err != nil {
+		return a.railError("failed to fetch order status", transferID, err)
+	}
+	return a.apply(ctx, transfer, order)
+}
+
+// Apply records an order update and moves the transfer that owns the order
+// to the matching status. Returns a TRANSFER_NOT_FOUND error if no transfer
+// has the order.
+func (a *RailAdapter) Apply(ctx context.Context, order *RailOrder) error {
+	transfer, err := a.FindByOrderID(ctx, order.ID)
+	if err != nil {
+		return err
+	}
+	return a.apply(ctx, transfer, order)
+}
+
+func (a *RailAdapter) apply(ctx context.Context, transfer *stellarconnect.Transfer, order *RailOrder) error {
+	if err := a.record(ctx, transfer, order); err != nil {
+		return err
+	}
+	err := a.advance(ctx, transfer, order)
+	if errorCode(err) != errors.TRANSITION_INVALID {
+		return err
+	}
+
+	// The update may be stale or may have overtaken one the partner sent
+	// earlier; apply the order's current state instead of dropping it.
+	current, statusErr := a.rail.OrderStatus(ctx, order.ID)
+	if statusErr != nil || current.Status == order.Status {
+		return err
+	}
+	transfer, loadErr := a.tm.store.FindByID(ctx, transfer.ID)
+	if loadErr != nil {
+		return errors.NewAnchorError(errors.STORE_ERROR, "failed to load transfer", loadErr)
+	}
+	return a.advance(ctx, transfer, current)
+}
+
+// advance moves the transfer to the status the order leads to. A completed
+// order whose funding the transfer has not seen yet is funded first, so a
+// lost or late funded update does not strand the transfer.
+func (a *RailAdapter) advance(ctx context.Context, transfer *stellarconnect.Transfer, order *RailOrder) error {
+	target, ok := railTarget(order.Status)
+	if !ok || transfer.Status == target {
+		return nil
+	}
+	if isTerminal(transfer.Status) {
+		return errors.NewAnchorError(errors.TRANSITION_INVALID,
+			fmt.Sprintf("order %s is %s but transfer is already %s", order.ID, order.Status, transfer.Status), nil)
+	}
+
+	switch order.Status {
+	case RailOrderFunded:
+		if !awaitingFunds(transfer.Status) {
+			// Already funded and further along.
+			return nil
+		}
+		return a.fund(ctx, transfer, order)
+	case RailOrderCompleted:
+		if awaitingFunds(transfer.Status) {
+			if err := a.fund(ctx, transfer, order); err != nil {
+				return err
+			}
+		}
+		if transfer.Kind == stellarconnect.KindDeposit {
+			return a.tm.NotifyPaymentSent(ctx, transfer.ID, PaymentSentDetails{StellarTxHash: order.StellarTxHash})
+		}
+		return a.tm.NotifyDisbursementSent(ctx, transfer.ID, DisbursementDetails{ExternalRef: order.ID})
+	case RailOrderFailed:
+		return a.tm.Fail(ctx, transfer.ID, a.reason(order, "failed"))
+	case RailOrderCancelled:
+		return a.tm.Cancel(ctx, transfer.ID, a.reason(order, "cancelled"))
+	case RailOrderRefunded:
+		return a.tm.NotifyRefunded(ctx, transfer.ID, RefundDetails{Reason: a.reason(order, "refunded")})
+	}
+	return nil
+}
+
+// fund records that the partner received the funds for the transfer.
+func (a *RailAdapter) fund(ctx context.Context, transfer *stellarconnect.Transfer, order *RailOrder) error {
+	if transfer.Kind == stellarconnect.KindDeposit {
+		return a.tm.NotifyFundsReceived(ctx, transfer.ID, FundsReceivedDetails{ExternalRef: order.ID, Amount: order.Amount})
+	}
+	return a.tm.NotifyPaymentReceived(ctx, transfer.ID, PaymentReceivedDetails{StellarTxHash: order.StellarTxHash, Amount: order.Amount})
+}
+
+// railTarget returns the transfer status an order status leads to. ok is
+// false for statuses that only carry information, such as created.
+func railTarget(status RailOrderStatus) (stellarconnect.TransferStatus, bool) {
+	switch status {
+	case RailOrderFunded:
+		return stellarconnect.StatusPendingStellar, true
+	case RailOrderCompleted:
+		return stellarconnect.StatusCompleted, true
+	case RailOrderFailed:
+		return stellarconnect.StatusFailed, true
+	case RailOrderCancelled:
+		return stellarconnect.StatusCancelled, true
+	case RailOrderRefunded:
+		return stellarconnect.StatusRefunded, true
+	}
+	return "", false
+}
+
+// awaitingFunds reports whether a transfer in status has not been funded yet.
+func awaitingFunds(status stellarconnect.TransferStatus) bool {
+	switch status {
+	case stellarconnect.StatusPendingUserTransferStart,
+		stellarconnect.StatusPendingExternal,
+		stellarconnect.StatusPaymentRequired:
+		return true
+	}
+	return false
+}
+
+// FindByOrderID returns the transfer with the given rail order. The adapter
+// sets the transfer's ExternalRef to the order ID, so stores implementing
+// stellarconnect.ExternalRefTransferStore resolve it through their index;
+// other stores are scanned.
+func (a *RailAdapter) FindByOrderID(ctx context.Context, orderID string) (*stellarconnect.Transfer, error) {
+	key := a.key("order_id")
+	notFound := errors.NewAnchorError(errors.TRANSFER_NOT_FOUND, "no transfer for rail order", nil)
+	notFound.Context["order_id"] = orderID
+
+	if rs, ok := a.tm.store.(stellarconnect.ExternalRefTransferStore); ok {
+		transfer, err := rs.FindByExternalRef(ctx, orderID)
+		if err != nil || transfer.Metadata[key] != orderID {
+			return nil, notFound
+		}
+		return transfer, nil
+	}
+
+	transfers, err := a.tm.store.List(ctx, stellarconnect.TransferFilters{})
+	if err != nil {
+		return nil, errors.NewAnchorError(errors.STORE_ERROR, "failed to list transfers", err)
+	}
+	for _, transfer := range transfers {
+		if id, _ := transfer.Metadata[key].(string); id != "" && id == orderID {
+			return transfer, nil
+		}
+	}
+	return nil, notFound
+}
+
+// railOrderEvent is the event type the adapter's webhook parser assigns to
+// order updates.
+const railOrderEvent = "rail_order"
+
+// WebhookHandler returns a webhook.Receiver for the partner's webhooks,
+// configured with the rail's WebhookConfig. Requests are authenticated,
+// checked against the signed timestamp if the rail provides one, and
+// deduplicated with dedup, so a replayed request is not applied twice.
+// Updates are applied with a webhook actor named after the rail; updates
+// that redelivery cannot fix, such as orders of unknown transfers, are
+// acknowledged. Returns a CONFIG_INVALID error if dedup is nil and the rail
+// configures none, or if the rail has no Verifier.
+func (a *RailAdapter) WebhookHandler(dedup stellarconnect.IdempotencyStore) (*webhook.Receiver, error) {
+	cfg := a.rail.WebhookConfig()
+	cfg.Name = a.rail.Name()
+	cfg.Parser = a.parseWebhook
+	if dedup != nil {
+		cfg.Dedup = dedup
+	}
+	if cfg.Dedup == nil {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "rail webhooks require a deduplication store", nil)
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = maxRailWebhookBytes
+	}
+	receiver, err := webhook.NewReceiver(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.On(receiver, railOrderEvent, func(ctx context.Context, event *webhook.Event, order RailOrder) error {
+		ctx = WithActor(ctx, stellarconnect.Actor{Type: stellarconnect.ActorWebhook, ID: a.rail.Name()})
+		err := a.Apply(ctx, &order)
+		switch errorCode(err) {
+		case errors.TRANSFER_NOT_FOUND, errors.TRANSITION_INVALID, errors.PAYMENT_MISMATCH:
+			return webhook.Permanent(err)
+		}
+		return err
+	})
+	return receiver, nil
+}
+
+// parseWebhook is the receiver's Parser: it turns an authenticated body into
+// a rail_order event carrying the order.
+func (a *RailAdapter) parseWebhook(header http.Header, body []byte) (*webhook.Event, error) {
+	order, err := a.rail.ParseWebhook(header, body)
+	if err != nil || order == nil {
+		return nil, err
+	}
+	data, err := json.Marshal(order)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook.Event{Type: railOrderEvent, Data: data}, nil
+}
+
+// record stores the order ID and instructions in the transfer metadata,
+// under keys prefixed with the rail name, and sets the order ID as the
+// transfer's ExternalRef. Nothing is written if the transfer already has
+// them.
+func (a *RailAdapter) record(ctx context.Context, transfer *stellarconnect.Transfer, order *RailOrder) error {
+	keys := map[string]any{a.key("order_id"): order.ID}
+	for k, v := range order.Instructions {
+		keys[a.key(k)] = v
+	}
+	for k, v := range keys {
+		if transfer.Metadata[k] == v {
+			delete(keys, k)
+		}
+	}
+	if len(keys) == 0 && transfer.ExternalRef == order.ID {
+		return nil
+	}
+	return a.tm.mutate(ctx, transfer.ID, func(current *stellarconnect.Transfer) (*stellarconnect.TransferUpdate, []HookEvent, error) {
+		update := &stellarconnect.TransferUpdate{}
+		if len(keys) > 0 {
+			update.Metadata = mergeMetadata(current.Metadata, keys)
+		}
+		if current.ExternalRef != order.ID {
+			update.ExternalRef = &order.ID
+		}
+		return update, nil, nil
+	})
+}
+
+func (a *RailAdapter) key(name string) string {
+	return a.rail.Name() + "_" + name
+}
+
+func (a *RailAdapter) reason(order *RailOrder, what string) string {
+	if order.Message != "" {
+		return order.Message
+	}
+	return fmt.Sprintf("%s order %s", a.rail.Name(), what)
+}
+
+func (a *RailAdapter) railError(message, transferID string, cause error) error {
+	if errorCode(cause) != "" {
+		return cause
+	}
+	err := errors.NewAnchorError(errors.RAIL_ERROR, message, cause)
+	err.Context["rail"] = a.rail.Name()
+	err.Context["transfer_id"] = transferID
+	return err
+}
+
+// errorCode returns the code of an SDK error, or "" for other errors.
+func errorCode(err error) errors.Code {
+	var sdkErr *errors.StellarConnectError
+	if errors.As(err, &sdkErr) {
+		return sdkErr.Code
+	}
+	return ""
+}
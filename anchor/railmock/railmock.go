@@ -0,0 +1,260 @@
+// Package railmock provides an in-memory anchor.RailProvider for tests and
+// local development.
+//
+// A Rail creates orders without contacting any partner. Tests move orders
+// along with SetStatus and deliver the result either directly with
+// RailAdapter.Apply or as a signed, timestamped webhook built by Webhook,
+// which exercises RailAdapter.WebhookHandler end to end.
+package railmock
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/anchor"
+	"github.com/marwen-abid/anchor-sdk-go/webhook"
+)
+
+const (
+	// SignatureHeader carries the hex HMAC-SHA256 of "<timestamp>.<body>".
+	SignatureHeader = "X-Railmock-Signature"
+
+	// TimestampHeader carries the Unix time the webhook was signed at.
+	TimestampHeader = "X-Railmock-Timestamp"
+)
+
+// Rail is an in-memory anchor.RailProvider.
+type Rail struct {
+	name     string
+	secret   string
+	orders   map[string]*anchor.RailOrder
+	next     int
+	failures []error
+	mu       sync.Mutex
+}
+
+// New creates a Rail with the given name. Webhooks are signed with secret;
+// an empty secret disables signature checks.
+func New(name, webhookSecret string) *Rail {
+	return &Rail{
+		name:   name,
+		secret: webhookSecret,
+		orders: make(map[string]*anchor.RailOrder),
+	}
+}
+
+// Name returns the rail's name.
+func (r *Rail) Name() string {
+	return r.name
+}
+
+// FailNext makes the next order creation or status lookup return err.
+// Calls queue up in order.
+func (r *Rail) FailNext(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failures = append(r.failures, err)
+}
+
+// CreateDepositInstructions creates a deposit order for the transfer's
+// amount. Its instructions hold a deposit_reference and deposit_amount.
+func (r *Rail) CreateDepositInstructions(ctx context.Context, req anchor.RailOrderRequest) (*anchor.RailOrder, error) {
+	order, err := r.create(ctx, req, stellarconnect.KindDeposit)
+	if err != nil {
+		return nil, err
+	}
+	order.Instructions = map[string]string{
+		"deposit_reference": order.ID,
+		"deposit_amount":    order.Amount,
+	}
+	return r.store(order), nil
+}
+
+// InitiateDisbursement creates a withdrawal order for the transfer's amount.
+func (r *Rail) InitiateDisbursement(ctx context.Context, req anchor.RailOrderRequest) (*anchor.RailOrder, error) {
+	order, err := r.create(ctx, req, stellarconnect.KindWithdrawal)
+	if err != nil {
+		return nil, err
+	}
+	return r.store(order), nil
+}
+
+func (r *Rail) create(ctx context.Context, req anchor.RailOrderRequest, kind stellarconnect.TransferKind) (*anchor.RailOrder, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if req.Transfer == nil {
+		return nil, fmt.Errorf("order request has no transfer")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.failureLocked(); err != nil {
+		return nil, err
+	}
+	r.next++
+	return &anchor.RailOrder{
+		ID:     fmt.Sprintf("%s-order-%d", r.name, r.next),
+		Kind:   kind,
+		Status: anchor.RailOrderCreated,
+		Amount: req.Transfer.Amount.String(),
+	}, nil
+}
+
+// store saves a new order and returns a copy of it.
+func (r *Rail) store(order *anchor.RailOrder) *anchor.RailOrder {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.orders[order.ID] = order
+	return cloneOrder(order)
+}
+
+// OrderStatus returns the current state of an order.
+func (r *Rail) OrderStatus(ctx context.Context, orderID string) (*anchor.RailOrder, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.failureLocked(); err != nil {
+		return nil, err
+	}
+	order, ok := r.orders[orderID]
+	if !ok {
+		return nil, fmt.Errorf("order %s not found", orderID)
+	}
+	return cloneOrder(order), nil
+}
+
+// SetStatus moves an order to status, as the partner would. stellarTxHash
+// is recorded if not empty.
+func (r *Rail) SetStatus(orderID string, status anchor.RailOrderStatus, stellarTxHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	order, ok := r.orders[orderID]
+	if !ok {
+		return fmt.Errorf("order %s not found", orderID)
+	}
+	order.Status = status
+	if stellarTxHash != "" {
+		order.StellarTxHash = stellarTxHash
+	}
+	return nil
+}
+
+// webhookPayload is the JSON body of a railmock webhook.
+type webhookPayload struct {
+	OrderID       string            `json:"order_id"`
+	Kind          string            `json:"kind"`
+	Status        string            `json:"status"`
+	Amount        string            `json:"amount,omitempty"`
+	StellarTxHash string            `json:"stellar_tx_hash,omitempty"`
+	Instructions  map[string]string `json:"instructions,omitempty"`
+	Message       string            `json:"message,omitempty"`
+}
+
+// Webhook returns the headers and body of a signed webhook reporting the
+// current state of an order, timestamped now.
+func (r *Rail) Webhook(orderID string) (http.Header, []byte, error) {
+	r.mu.Lock()
+	order, ok := r.orders[orderID]
+	if !ok {
+		r.mu.Unlock()
+		return nil, nil, fmt.Errorf("order %s not found", orderID)
+	}
+	body, err := json.Marshal(webhookPayload{
+		OrderID:       order.ID,
+		Kind:          string(order.Kind),
+		Status:        string(order.Status),
+		Amount:        order.Amount,
+		StellarTxHash: order.StellarTxHash,
+		Instructions:  order.Instructions,
+		Message:       order.Message,
+	})
+	r.mu.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	header.Set(TimestampHeader, timestamp)
+	if r.secret != "" {
+		header.Set(SignatureHeader, r.sign(append([]byte(timestamp+"."), body...)))
+	}
+	return header, body, nil
+}
+
+// WebhookConfig verifies the signature and timestamp of webhooks built by
+// Webhook. Without a secret, signatures are not checked.
+func (r *Rail) WebhookConfig() webhook.Config {
+	cfg := webhook.Config{TimestampHeader: TimestampHeader, Verifier: webhook.Unverified}
+	if r.secret != "" {
+		cfg.Verifier = webhook.HMACSHA256{Secret: []byte(r.secret), Header: SignatureHeader}
+	}
+	return cfg
+}
+
+// ParseWebhook returns the order an authenticated webhook reports.
+func (r *Rail) ParseWebhook(header http.Header, body []byte) (*anchor.RailOrder, error) {
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	if payload.OrderID == "" {
+		return nil, nil
+	}
+	return &anchor.RailOrder{
+		ID:            payload.OrderID,
+		Kind:          stellarconnect.TransferKind(payload.Kind),
+		Status:        anchor.RailOrderStatus(payload.Status),
+		Amount:        payload.Amount,
+		StellarTxHash: payload.StellarTxHash,
+		Instructions:  payload.Instructions,
+		Message:       payload.Message,
+	}, nil
+}
+
+func (r *Rail) sign(message []byte) string {
+	mac := hmac.New(sha256.New, []byte(r.secret))
+	mac.Write(message)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// failureLocked pops the next injected failure. The caller must hold the lock.
+func (r *Rail) failureLocked() error {
+	if len(r.failures) == 0 {
+		return nil
+	}
+	err := r.failures[0]
+	r.failures = r.failures[1:]
+	return err
+}
+
+func cloneOrder(order *anchor.RailOrder) *anchor.RailOrder {
+	c := *order
+	if order.Instructions != nil {
+		c.Instructions = make(map[string]string, len(order.Instructions))
+		for k, v := range order.Instructions {
+			c.Instructions[k] = v
+		}
+	}
+	return &c
+}
+
+// Verify that Rail implements anchor.RailProvider
+var _ anchor.RailProvider = (*Rail)(nil)
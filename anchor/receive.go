@@ -0,0 +1,82 @@
+package anchor
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	corecrypto "github.com/marwen-abid/anchor-sdk-go/core/crypto"
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+)
+
+// ReceiveRequest starts a SEP-31 receive for a sending anchor.
+type ReceiveRequest struct {
+	Account   string // Sending anchor's Stellar account
+	AssetCode string
+	Amount    string
+	Metadata  map[string]any // Optional: e.g. sender and receiver IDs, quote ID
+}
+
+// ReceiveResult tells the sending anchor where to pay.
+type ReceiveResult struct {
+	ID              string
+	StellarAccount  string
+	StellarMemo     string
+	StellarMemoType string
+}
+
+// InitiateReceive creates a SEP-31 receive in payment_required, assigned a
+// memo or mux ID like a withdrawal so the sending anchor's payment can be
+// matched. The rest of the flow uses the withdrawal methods:
+// NotifyPaymentReceived when the payment arrives and NotifyDisbursementSent
+// once the receiver has been paid. KYC of the sender and receiver is left to
+// the caller.
+func (tm *TransferManager) InitiateReceive(ctx context.Context, req ReceiveRequest) (*ReceiveResult, error) {
+	if tm.store == nil {
+		return nil, errors.NewAnchorError(errors.STORE_ERROR, "transfer store not configured", nil)
+	}
+	if strings.TrimSpace(req.Account) == "" || strings.TrimSpace(req.AssetCode) == "" || strings.TrimSpace(req.Amount) == "" {
+		return nil, errors.NewAnchorError(errors.TRANSFER_INIT_FAILED, "account, asset_code, and amount are required", nil)
+	}
+	amt, err := parseTransferAmount(req.Amount)
+	if err != nil {
+		return nil, errors.NewAnchorError(errors.TRANSFER_INIT_FAILED, "invalid amount", err)
+	}
+
+	id, err := corecrypto.GenerateNonce(16)
+	if err != nil {
+		return nil, errors.NewAnchorError(errors.TRANSFER_INIT_FAILED, "failed to generate transfer ID", err)
+	}
+	now := time.Now()
+	transfer := &stellarconnect.Transfer{
+		ID:        id,
+		Kind:      stellarconnect.KindReceive,
+		Mode:      stellarconnect.ModeAPI,
+		Status:    stellarconnect.StatusPaymentRequired,
+		AssetCode: req.AssetCode,
+		Account:   req.Account,
+		Amount:    amt,
+		Metadata:  req.Metadata,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if tm.config.MuxedWithdrawals {
+		if err := tm.assignMuxID(ctx, transfer); err != nil {
+			return nil, err
+		}
+	} else if err := tm.assignMemo(ctx, transfer); err != nil {
+		return nil, err
+	}
+
+	if err := tm.save(ctx, transfer, HookReceiveInitiated); err != nil {
+		return nil, err
+	}
+	return &ReceiveResult{
+		ID:              transfer.ID,
+		StellarAccount:  tm.withdrawAnchorAccount(transfer),
+		StellarMemo:     transfer.Memo,
+		StellarMemoType: string(transfer.MemoType),
+	}, nil
+}
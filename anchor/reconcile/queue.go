@@ -0,0 +1,145 @@
+package reconcile
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+)
+
+// ReviewStatus is the state of a statement line queued for review.
+type ReviewStatus string
+
+const (
+	// ReviewPending means an operator has yet to decide.
+	ReviewPending ReviewStatus = "pending"
+
+	// ReviewApproved means the line was applied to a deposit.
+	ReviewApproved ReviewStatus = "approved"
+
+	// ReviewDismissed means the line does not fund any deposit, e.g. an
+	// unrelated payment.
+	ReviewDismissed ReviewStatus = "dismissed"
+)
+
+// Review is a statement line that could not be matched with confidence.
+type Review struct {
+	ID         string // Statement line ID
+	Line       StatementLine
+	Reason     string   // Why the line was not matched automatically
+	Candidates []string // IDs of deposits the line may fund, best first
+	Status     ReviewStatus
+	TransferID string // Deposit the line was applied to, once approved
+	Note       string // Operator's note, once resolved
+	CreatedAt  time.Time
+	ResolvedAt time.Time
+}
+
+// ReviewQueue persists statement lines awaiting an operator.
+type ReviewQueue interface {
+	// Add queues a review. It returns false, without changing anything, if
+	// a review with the same ID already exists, resolved or not.
+	Add(ctx context.Context, review Review) (bool, error)
+
+	// Get returns a review, or (nil, nil) if it does not exist.
+	Get(ctx context.Context, id string) (*Review, error)
+
+	// List returns the reviews in the given status, oldest first; an empty
+	// status returns all of them.
+	List(ctx context.Context, status ReviewStatus) ([]Review, error)
+
+	// Resolve records an operator's decision on a pending review. Returns a
+	// TRANSITION_INVALID error if the review is already resolved.
+	Resolve(ctx context.Context, id string, status ReviewStatus, transferID, note string) error
+}
+
+// MemoryQueue is an in-memory ReviewQueue.
+// Access is protected by sync.Mutex for thread safety.
+type MemoryQueue struct {
+	reviews map[string]Review
+	mu      sync.Mutex
+}
+
+// NewMemoryQueue creates an empty in-memory review queue.
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{reviews: make(map[string]Review)}
+}
+
+// Add queues a review unless one with the same ID exists.
+func (q *MemoryQueue) Add(ctx context.Context, review Review) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, exists := q.reviews[review.ID]; exists {
+		return false, nil
+	}
+	if review.Status == "" {
+		review.Status = ReviewPending
+	}
+	if review.CreatedAt.IsZero() {
+		review.CreatedAt = time.Now()
+	}
+	review.Candidates = append([]string(nil), review.Candidates...)
+	q.reviews[review.ID] = review
+	return true, nil
+}
+
+// Get returns a copy of a review, or nil if it does not exist.
+func (q *MemoryQueue) Get(ctx context.Context, id string) (*Review, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	review, ok := q.reviews[id]
+	if !ok {
+		return nil, nil
+	}
+	review.Candidates = append([]string(nil), review.Candidates...)
+	return &review, nil
+}
+
+// List returns copies of the reviews in status, oldest first.
+func (q *MemoryQueue) List(ctx context.Context, status ReviewStatus) ([]Review, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var reviews []Review
+	for _, review := range q.reviews {
+		if status != "" && review.Status != status {
+			continue
+		}
+		review.Candidates = append([]string(nil), review.Candidates...)
+		reviews = append(reviews, review)
+	}
+	sort.Slice(reviews, func(i, j int) bool {
+		if !reviews[i].CreatedAt.Equal(reviews[j].CreatedAt) {
+			return reviews[i].CreatedAt.Before(reviews[j].CreatedAt)
+		}
+		return reviews[i].ID < reviews[j].ID
+	})
+	return reviews, nil
+}
+
+// Resolve records a decision on a pending review.
+func (q *MemoryQueue) Resolve(ctx context.Context, id string, status ReviewStatus, transferID, note string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	review, ok := q.reviews[id]
+	if !ok {
+		return errors.NewAnchorError(errors.REVIEW_NOT_FOUND, "review not found", nil)
+	}
+	if review.Status != ReviewPending {
+		return errors.NewAnchorError(errors.TRANSITION_INVALID, "review is already "+string(review.Status), nil)
+	}
+	review.Status = status
+	review.TransferID = transferID
+	review.Note = note
+	review.ResolvedAt = time.Now()
+	q.reviews[id] = review
+	return nil
+}
+
+// Verify that MemoryQueue implements ReviewQueue
+var _ ReviewQueue = (*MemoryQueue)(nil)
@@ -0,0 +1,322 @@
+// Package reconcile matches bank statements against pending deposits.
+//
+// Users funding a deposit by manual bank transfer quote a reference in the
+// payment's remittance field. A Reconciler reads the statement lines
+// (ParseCSV, ParseCAMT053), matches each credit to a deposit in
+// pending_user_transfer_start by reference and amount, and calls
+// NotifyFundsReceived for confident matches. Lines it cannot match with
+// confidence are queued for an operator, who approves them against a
+// deposit or dismisses them.
+//
+// Applied lines are recorded as the deposit's ExternalRef, so importing an
+// overlapping statement again does not apply or queue the same line twice.
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/anchor"
+	"github.com/marwen-abid/anchor-sdk-go/core/amount"
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+)
+
+// Config configures a Reconciler.
+type Config struct {
+	// Optional: where unmatched lines wait for an operator (default: NewMemoryQueue())
+	Queue ReviewQueue
+
+	// Optional: the reference a user quotes when paying a deposit, found in
+	// the line's remittance information ignoring case, spaces, and
+	// punctuation (default: the transfer ID)
+	Reference func(transfer *stellarconnect.Transfer) string
+
+	// Optional: only match deposits of this asset code (default: all)
+	AssetCode string
+
+	// Optional: the ISO 4217 currency deposits are paid in; lines in another
+	// currency are queued for review instead of applied (default: not
+	// checked). Lines without a currency are not checked.
+	Currency string
+}
+
+// Reconciler applies bank statements to deposits.
+type Reconciler struct {
+	tm        *anchor.TransferManager
+	store     stellarconnect.TransferStore
+	queue     ReviewQueue
+	reference func(*stellarconnect.Transfer) string
+	assetCode string
+	currency  string
+}
+
+// New creates a Reconciler for the deposits in store, moving them with tm.
+// Returns a CONFIG_INVALID error if either is missing.
+func New(tm *anchor.TransferManager, store stellarconnect.TransferStore, cfg Config) (*Reconciler, error) {
+	if tm == nil || store == nil {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "transfer manager and store are required", nil)
+	}
+	if cfg.Queue == nil {
+		cfg.Queue = NewMemoryQueue()
+	}
+	if cfg.Reference == nil {
+		cfg.Reference = func(transfer *stellarconnect.Transfer) string { return transfer.ID }
+	}
+	return &Reconciler{
+		tm:        tm,
+		store:     store,
+		queue:     cfg.Queue,
+		reference: cfg.Reference,
+		assetCode: cfg.AssetCode,
+		currency:  strings.TrimSpace(cfg.Currency),
+	}, nil
+}
+
+// Queue returns the review queue.
+func (r *Reconciler) Queue() ReviewQueue {
+	return r.queue
+}
+
+// Match is a statement line applied to a deposit.
+type Match struct {
+	Line       StatementLine
+	TransferID string
+}
+
+// Report summarizes an import.
+type Report struct {
+	Matched []Match         // Lines applied with NotifyFundsReceived
+	Queued  []Review        // Lines newly queued for review
+	Skipped []StatementLine // Debits, and lines already applied or queued
+}
+
+// Import matches statement lines to deposits waiting for funds. A credit
+// whose remittance information contains the reference of exactly one
+// waiting deposit, and whose amount equals the deposit's (or the deposit
+// has no amount yet), funds that deposit if it is in Config.Currency. Every
+// other credit is queued for review with the deposits it may fund.
+// Processing continues past failures and the first error is returned; lines
+// that failed are neither applied nor queued, so a later import retries them.
+func (r *Reconciler) Import(ctx context.Context, lines []StatementLine) (*Report, error) {
+	deposits, err := r.deposits(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[string]bool)
+	var waiting []*stellarconnect.Transfer
+	for _, transfer := range deposits {
+		if transfer.ExternalRef != "" {
+			applied[transfer.ExternalRef] = true
+		}
+		if transfer.Status == stellarconnect.StatusPendingUserTransferStart {
+			waiting = append(waiting, transfer)
+		}
+	}
+
+	report := &Report{}
+	var firstErr error
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, line := range lines {
+		if line.Debit || applied[line.ID] {
+			report.Skipped = append(report.Skipped, line)
+			continue
+		}
+		existing, err := r.queue.Get(ctx, line.ID)
+		if err != nil {
+			fail(errors.NewAnchorError(errors.STORE_ERROR, "failed to read review queue", err))
+			continue
+		}
+		if existing != nil {
+			report.Skipped = append(report.Skipped, line)
+			continue
+		}
+
+		transfer, review := r.match(line, waiting)
+		if transfer != nil && r.currency != "" && line.Currency != "" && !strings.EqualFold(line.Currency, r.currency) {
+			review = &Review{
+				Reason:     fmt.Sprintf("currency %s differs from the expected %s", line.Currency, r.currency),
+				Candidates: []string{transfer.ID},
+			}
+			transfer = nil
+		}
+		if transfer != nil {
+			err := r.tm.NotifyFundsReceived(ctx, transfer.ID, anchor.FundsReceivedDetails{
+				ExternalRef: line.ID,
+				Amount:      line.Amount,
+			})
+			if err == nil {
+				report.Matched = append(report.Matched, Match{Line: line, TransferID: transfer.ID})
+				applied[line.ID] = true
+				waiting = remove(waiting, transfer.ID)
+				continue
+			}
+			var sdkErr *errors.StellarConnectError
+			if !errors.As(err, &sdkErr) || sdkErr.Code != errors.TRANSITION_INVALID {
+				fail(err)
+				continue
+			}
+			// The deposit moved on since it was listed; let an operator decide.
+			review = &Review{
+				Reason:     fmt.Sprintf("deposit %s is no longer waiting for funds", transfer.ID),
+				Candidates: []string{transfer.ID},
+			}
+		}
+
+		review.ID = line.ID
+		review.Line = line
+		added, err := r.queue.Add(ctx, *review)
+		if err != nil {
+			fail(errors.NewAnchorError(errors.STORE_ERROR, "failed to queue statement line for review", err))
+			continue
+		}
+		if added {
+			report.Queued = append(report.Queued, *review)
+		} else {
+			report.Skipped = append(report.Skipped, line)
+		}
+	}
+	return report, firstErr
+}
+
+// match returns the deposit a line funds, or the review to queue if no
+// deposit matches with confidence.
+func (r *Reconciler) match(line StatementLine, waiting []*stellarconnect.Transfer) (*stellarconnect.Transfer, *Review) {
+	remittance := normalize(line.Reference)
+	var byReference, byAmount []*stellarconnect.Transfer
+	for _, transfer := range waiting {
+		if ref := normalize(r.reference(transfer)); ref != "" && strings.Contains(remittance, ref) {
+			byReference = append(byReference, transfer)
+		} else if !transfer.Amount.IsZero() && sameAmount(transfer.Amount, line.Amount) {
+			byAmount = append(byAmount, transfer)
+		}
+	}
+
+	switch {
+	case len(byReference) == 1:
+		transfer := byReference[0]
+		if transfer.Amount.IsZero() || sameAmount(transfer.Amount, line.Amount) {
+			return transfer, nil
+		}
+		return nil, &Review{
+			Reason:     fmt.Sprintf("amount %s differs from the %s expected by deposit %s", line.Amount, transfer.Amount, transfer.ID),
+			Candidates: []string{transfer.ID},
+		}
+	case len(byReference) > 1:
+		return nil, &Review{
+			Reason:     fmt.Sprintf("reference matches %d deposits", len(byReference)),
+			Candidates: ids(byReference),
+		}
+	case len(byAmount) > 0:
+		return nil, &Review{
+			Reason:     "no deposit reference found; deposits with the same amount are listed",
+			Candidates: ids(byAmount),
+		}
+	default:
+		return nil, &Review{Reason: "no matching deposit"}
+	}
+}
+
+// Approve applies a queued line to a deposit chosen by the operator and
+// resolves its review. Attribute the change with anchor.WithActor.
+func (r *Reconciler) Approve(ctx context.Context, reviewID, transferID string) error {
+	review, err := r.pending(ctx, reviewID)
+	if err != nil {
+		return err
+	}
+	transfer, err := r.store.FindByID(ctx, transferID)
+	if err != nil {
+		return errors.NewAnchorError(errors.TRANSFER_NOT_FOUND, "transfer not found", err)
+	}
+	if transfer.Kind != stellarconnect.KindDeposit {
+		return errors.NewAnchorError(errors.TRANSITION_INVALID, fmt.Sprintf("transfer %s is not a deposit", transferID), nil)
+	}
+	if err := r.tm.NotifyFundsReceived(ctx, transferID, anchor.FundsReceivedDetails{
+		ExternalRef: review.Line.ID,
+		Amount:      review.Line.Amount,
+	}); err != nil {
+		return err
+	}
+	return r.queue.Resolve(ctx, reviewID, ReviewApproved, transferID, "")
+}
+
+// Dismiss resolves a queued line without applying it, e.g. because it is
+// unrelated to any deposit or was refunded to the payer.
+func (r *Reconciler) Dismiss(ctx context.Context, reviewID, note string) error {
+	if _, err := r.pending(ctx, reviewID); err != nil {
+		return err
+	}
+	return r.queue.Resolve(ctx, reviewID, ReviewDismissed, "", note)
+}
+
+// pending returns a review waiting for an operator.
+func (r *Reconciler) pending(ctx context.Context, reviewID string) (*Review, error) {
+	review, err := r.queue.Get(ctx, reviewID)
+	if err != nil {
+		return nil, errors.NewAnchorError(errors.STORE_ERROR, "failed to read review queue", err)
+	}
+	if review == nil {
+		return nil, errors.NewAnchorError(errors.REVIEW_NOT_FOUND, "review not found", nil)
+	}
+	if review.Status != ReviewPending {
+		return nil, errors.NewAnchorError(errors.TRANSITION_INVALID, "review is already "+string(review.Status), nil)
+	}
+	return review, nil
+}
+
+// deposits lists the deposits the reconciler considers.
+func (r *Reconciler) deposits(ctx context.Context) ([]*stellarconnect.Transfer, error) {
+	kind := stellarconnect.KindDeposit
+	transfers, err := r.store.List(ctx, stellarconnect.TransferFilters{
+		AssetCode: r.assetCode,
+		Kind:      &kind,
+	})
+	if err != nil {
+		return nil, errors.NewAnchorError(errors.STORE_ERROR, "failed to list deposits", err)
+	}
+	return transfers, nil
+}
+
+// normalize uppercases s and drops everything but letters and digits, as
+// banks often reformat remittance text.
+func normalize(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			b.WriteRune(unicode.ToUpper(c))
+		}
+	}
+	return b.String()
+}
+
+func sameAmount(expected amount.Amount, s string) bool {
+	got, err := amount.Parse(s)
+	if err != nil {
+		return false
+	}
+	return got.Equal(expected)
+}
+
+func ids(transfers []*stellarconnect.Transfer) []string {
+	out := make([]string, len(transfers))
+	for i, transfer := range transfers {
+		out[i] = transfer.ID
+	}
+	return out
+}
+
+func remove(transfers []*stellarconnect.Transfer, id string) []*stellarconnect.Transfer {
+	out := transfers[:0:0]
+	for _, transfer := range transfers {
+		if transfer.ID != id {
+			out = append(out, transfer)
+		}
+	}
+	return out
+}
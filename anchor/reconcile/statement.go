@@ -0,0 +1,323 @@
+package reconcile
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/marwen-abid/anchor-sdk-go/core/amount"
+)
+
+// StatementLine is one booked movement on the anchor's bank account.
+type StatementLine struct {
+	ID           string    // Bank's reference for the movement; derived from the line if absent
+	BookingDate  time.Time // Zero if the statement has none
+	Amount       string    // Positive decimal amount
+	Currency     string    // Optional: ISO 4217 code
+	Debit        bool      // true for money leaving the account; debits are never matched
+	Reference    string    // Remittance information entered by the payer
+	Counterparty string    // Optional: payer's name
+}
+
+// CSVFormat describes the columns of a CSV statement. Columns are found by
+// their header, compared case-insensitively.
+type CSVFormat struct {
+	Comma        rune   // Optional: field separator (default: ',')
+	ID           string // Optional: bank reference column (default: "id")
+	Date         string // Optional: booking date column (default: "date")
+	DateLayout   string // Optional: time.Parse layout of Date (default: "2006-01-02")
+	Amount       string // Optional: signed amount column; negative is a debit (default: "amount")
+	Currency     string // Optional: currency column (default: "currency")
+	Reference    string // Optional: remittance column (default: "reference")
+	Counterparty string // Optional: payer column (default: "counterparty")
+}
+
+// ParseCSV reads a CSV statement with a header row. The amount and reference
+// columns are required; the others are read when present. Lines without an
+// ID get one derived from their content, so importing the same file twice
+// yields the same IDs.
+func ParseCSV(r io.Reader, format CSVFormat) ([]StatementLine, error) {
+	format = format.withDefaults()
+	reader := csv.NewReader(r)
+	reader.Comma = format.Comma
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	column := func(name string) int {
+		if i, ok := columns[strings.ToLower(name)]; ok {
+			return i
+		}
+		return -1
+	}
+	idCol, dateCol, amountCol := column(format.ID), column(format.Date), column(format.Amount)
+	currencyCol, referenceCol, counterpartyCol := column(format.Currency), column(format.Reference), column(format.Counterparty)
+	if amountCol < 0 {
+		return nil, fmt.Errorf("CSV has no %q column", format.Amount)
+	}
+	if referenceCol < 0 {
+		return nil, fmt.Errorf("CSV has no %q column", format.Reference)
+	}
+
+	var lines []StatementLine
+	seen := make(map[string]int)
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read CSV line %d: %w", row, err)
+		}
+		field := func(i int) string {
+			if i < 0 || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		if strings.Join(record, "") == "" {
+			continue
+		}
+
+		line := StatementLine{
+			ID:           field(idCol),
+			Currency:     strings.ToUpper(field(currencyCol)),
+			Reference:    field(referenceCol),
+			Counterparty: field(counterpartyCol),
+		}
+		line.Amount, line.Debit, err = parseSignedAmount(field(amountCol))
+		if err != nil {
+			return nil, fmt.Errorf("CSV line %d: %w", row, err)
+		}
+		if date := field(dateCol); date != "" {
+			if line.BookingDate, err = time.Parse(format.DateLayout, date); err != nil {
+				return nil, fmt.Errorf("CSV line %d: invalid date %q: %w", row, date, err)
+			}
+		}
+		if line.ID == "" {
+			line.ID = derivedID(line, seen)
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+func (f CSVFormat) withDefaults() CSVFormat {
+	if f.Comma == 0 {
+		f.Comma = ','
+	}
+	if f.ID == "" {
+		f.ID = "id"
+	}
+	if f.Date == "" {
+		f.Date = "date"
+	}
+	if f.DateLayout == "" {
+		f.DateLayout = "2006-01-02"
+	}
+	if f.Amount == "" {
+		f.Amount = "amount"
+	}
+	if f.Currency == "" {
+		f.Currency = "currency"
+	}
+	if f.Reference == "" {
+		f.Reference = "reference"
+	}
+	if f.Counterparty == "" {
+		f.Counterparty = "counterparty"
+	}
+	return f
+}
+
+// camtDocument is the subset of an ISO 20022 camt.053 (bank to customer
+// statement) document used for reconciliation. Element names match any
+// namespace, so versions 001.02 through 001.08 are read alike.
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	ID      string      `xml:"Id"`
+	Entries []camtEntry `xml:"Ntry"`
+}
+
+type camtEntry struct {
+	Reference       string          `xml:"NtryRef"`
+	Amount          camtAmount      `xml:"Amt"`
+	CreditDebit     string          `xml:"CdtDbtInd"`
+	Status          camtStatus      `xml:"Sts"`
+	BookingDate     string          `xml:"BookgDt>Dt"`
+	BookingDateTime string          `xml:"BookgDt>DtTm"`
+	ServicerRef     string          `xml:"AcctSvcrRef"`
+	Transactions    []camtTxDetails `xml:"NtryDtls>TxDtls"`
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+// camtStatus is "BOOK" in older versions and <Cd>BOOK</Cd> in newer ones.
+type camtStatus struct {
+	Text string `xml:",chardata"`
+	Code string `xml:"Cd"`
+}
+
+type camtTxDetails struct {
+	ServicerRef   string     `xml:"Refs>AcctSvcrRef"`
+	EndToEndID    string     `xml:"Refs>EndToEndId"`
+	Amount        camtAmount `xml:"Amt"`
+	TxAmount      camtAmount `xml:"AmtDtls>TxAmt>Amt"`
+	CreditDebit   string     `xml:"CdtDbtInd"`
+	Unstructured  []string   `xml:"RmtInf>Ustrd"`
+	Structured    []string   `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	DebtorName    string     `xml:"RltdPties>Dbtr>Nm"`
+	DebtorPtyName string     `xml:"RltdPties>Dbtr>Pty>Nm"`
+}
+
+// ParseCAMT053 reads an ISO 20022 camt.053 statement. Only booked entries
+// are returned. An entry batching several transactions yields one line per
+// transaction; the remittance information of a line joins its structured
+// creditor references, unstructured text, and end-to-end ID.
+func ParseCAMT053(r io.Reader) ([]StatementLine, error) {
+	var doc camtDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse camt.053: %w", err)
+	}
+
+	var lines []StatementLine
+	seen := make(map[string]int)
+	for _, stmt := range doc.Statements {
+		for n, entry := range stmt.Entries {
+			status := strings.TrimSpace(entry.Status.Code)
+			if status == "" {
+				status = strings.TrimSpace(entry.Status.Text)
+			}
+			if status != "" && status != "BOOK" {
+				continue
+			}
+			date, err := camtDate(entry)
+			if err != nil {
+				return nil, fmt.Errorf("camt.053 statement %s entry %d: %w", stmt.ID, n+1, err)
+			}
+			entryRef := firstNonEmpty(entry.ServicerRef, entry.Reference)
+
+			// One line for the entry, or one per transaction of a batch.
+			txs := entry.Transactions
+			if len(txs) <= 1 {
+				var tx camtTxDetails
+				if len(txs) == 1 {
+					tx = txs[0]
+				}
+				tx.Amount, tx.TxAmount = entry.Amount, camtAmount{}
+				tx.CreditDebit = entry.CreditDebit
+				tx.ServicerRef = firstNonEmpty(entryRef, tx.ServicerRef)
+				txs = []camtTxDetails{tx}
+			}
+			for i, tx := range txs {
+				line, err := camtLine(tx, entry, date)
+				if err != nil {
+					return nil, fmt.Errorf("camt.053 statement %s entry %d: %w", stmt.ID, n+1, err)
+				}
+				line.ID = tx.ServicerRef
+				if line.ID == "" && entryRef != "" {
+					line.ID = entryRef
+					if len(txs) > 1 {
+						line.ID = fmt.Sprintf("%s/%d", entryRef, i+1)
+					}
+				}
+				if line.ID == "" {
+					line.ID = derivedID(line, seen)
+				}
+				lines = append(lines, line)
+			}
+		}
+	}
+	return lines, nil
+}
+
+func camtLine(tx camtTxDetails, entry camtEntry, date time.Time) (StatementLine, error) {
+	amt := tx.Amount
+	if strings.TrimSpace(amt.Value) == "" {
+		amt = tx.TxAmount
+	}
+	if strings.TrimSpace(amt.Value) == "" {
+		amt = entry.Amount
+	}
+	value, negative, err := parseSignedAmount(amt.Value)
+	if err != nil {
+		return StatementLine{}, err
+	}
+	indicator := firstNonEmpty(tx.CreditDebit, entry.CreditDebit)
+	references := append(append([]string{}, tx.Structured...), tx.Unstructured...)
+	if id := strings.TrimSpace(tx.EndToEndID); id != "" && id != "NOTPROVIDED" {
+		references = append(references, id)
+	}
+	return StatementLine{
+		BookingDate:  date,
+		Amount:       value,
+		Currency:     strings.ToUpper(firstNonEmpty(amt.Currency, entry.Amount.Currency)),
+		Debit:        negative || strings.TrimSpace(indicator) == "DBIT",
+		Reference:    strings.TrimSpace(strings.Join(references, " ")),
+		Counterparty: strings.TrimSpace(firstNonEmpty(tx.DebtorPtyName, tx.DebtorName)),
+	}, nil
+}
+
+func camtDate(entry camtEntry) (time.Time, error) {
+	if d := strings.TrimSpace(entry.BookingDate); d != "" {
+		return time.Parse("2006-01-02", d)
+	}
+	if d := strings.TrimSpace(entry.BookingDateTime); d != "" {
+		return time.Parse(time.RFC3339, d)
+	}
+	return time.Time{}, nil
+}
+
+// parseSignedAmount parses a decimal amount, returning its absolute value
+// and whether it was negative.
+func parseSignedAmount(s string) (string, bool, error) {
+	s = strings.TrimPrefix(strings.ReplaceAll(strings.TrimSpace(s), " ", ""), "+")
+	negative := strings.HasPrefix(s, "-")
+	a, err := amount.Parse(strings.TrimPrefix(s, "-"))
+	if err != nil {
+		return "", false, fmt.Errorf("invalid amount %q: %w", s, err)
+	}
+	return a.String(), negative, nil
+}
+
+// derivedID returns a stable ID for a line without a bank reference, made
+// from its content. seen counts identical lines so each gets its own ID.
+func derivedID(line StatementLine, seen map[string]int) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		line.BookingDate.Format("2006-01-02"), line.Amount, line.Currency,
+		fmt.Sprint(line.Debit), line.Reference, line.Counterparty,
+	}, "|")))
+	id := "line-" + hex.EncodeToString(sum[:8])
+	seen[id]++
+	if n := seen[id]; n > 1 {
+		id = fmt.Sprintf("%s-%d", id, n)
+	}
+	return id
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
@@ -3,17 +3,31 @@ package anchor
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/core/amount"
 	corecrypto "github.com/marwen-abid/anchor-sdk-go/core/crypto"
 	"github.com/marwen-abid/anchor-sdk-go/errors"
+	"github.com/marwen-abid/anchor-sdk-go/store/memory"
 )
 
 const (
 	interactiveTokenLength = 32
+
+	// memoGenerationAttempts bounds retries when a generated memo collides
+	// with one already assigned to another transfer.
+	memoGenerationAttempts = 5
+
+	// defaultLockTTL bounds how long a crashed holder can block a transfer.
+	defaultLockTTL = 30 * time.Second
+
+	// maxConflictRetries bounds how often a mutation is re-read and retried
+	// after a version conflict before giving up.
+	maxConflictRetries = 5
 )
 
 type Config struct {
@@ -21,49 +35,95 @@ type Config struct {
 	InteractiveBaseURL  string
 	DistributionAccount string
 	BaseURL             string
+	PaymentPolicy       PaymentPolicy // Optional: handling of mismatched incoming payments (default: hold)
+	MemoStrategy        MemoStrategy  // Optional: memo assignment for withdrawal payments (default: TextMemo)
+	MuxedWithdrawals    bool          // Optional: assign each withdrawal an M-address instead of a memo
+
+	// InsecureCallbacks accepts http on_change_callback URLs and callbacks to
+	// loopback and private addresses. Only for local development: a wallet
+	// could otherwise make the anchor POST to its internal network.
+	InsecureCallbacks bool
+
+	IdempotencyStore stellarconnect.IdempotencyStore // Optional: enables idempotency keys on initiation
+	IdempotencyTTL   time.Duration                   // Optional: how long completed keys are remembered (default: 24h)
+	IdempotencyLease time.Duration                   // Optional: how long a key stays in progress before it can be reclaimed (default: 1m)
+
+	Locker  stellarconnect.Locker // Optional: per-transfer locks; use a shared locker across replicas (default: in-process)
+	LockTTL time.Duration         // Optional: maximum time a transfer lock is held (default: 30s)
+
+	// Outbox persists hook events atomically with the status change that
+	// produced them instead of firing hooks inline. Requires a store that
+	// implements stellarconnect.OutboxStore; deliver events with an
+	// OutboxDispatcher. Ignored if the store does not support it.
+	Outbox bool
 }
 
 type TransferManager struct {
-	store         stellarconnect.TransferStore
-	config        Config
-	hooks         *HookRegistry
-	tokenMu       sync.Mutex
-	tokenToID     map[string]string
-	transferMu    sync.Mutex
-	transferLocks map[string]*sync.Mutex
+	store     stellarconnect.TransferStore
+	outbox    stellarconnect.OutboxStore        // nil unless Config.Outbox is enabled and supported
+	history   stellarconnect.AtomicHistoryStore // nil unless the store commits history with changes
+	config    Config
+	hooks     *HookRegistry
+	tokenMu   sync.Mutex
+	tokenToID map[string]string
 }
 
 func NewTransferManager(store stellarconnect.TransferStore, config Config, hooks *HookRegistry) *TransferManager {
 	if hooks == nil {
 		hooks = NewHookRegistry()
 	}
-	return &TransferManager{
-		store:         store,
-		config:        config,
-		hooks:         hooks,
-		tokenToID:     make(map[string]string),
-		transferLocks: make(map[string]*sync.Mutex),
+	if config.MemoStrategy == nil {
+		config.MemoStrategy = TextMemo()
+	}
+	if config.Locker == nil {
+		config.Locker = memory.NewLocker()
+	}
+	if config.LockTTL <= 0 {
+		config.LockTTL = defaultLockTTL
+	}
+	tm := &TransferManager{
+		store:     store,
+		config:    config,
+		hooks:     hooks,
+		tokenToID: make(map[string]string),
 	}
+	if history, ok := store.(stellarconnect.AtomicHistoryStore); ok {
+		tm.history = history
+	}
+	if outbox, ok := store.(stellarconnect.OutboxStore); ok && config.Outbox {
+		tm.outbox = outbox
+	}
+	return tm
 }
 
-// lockForTransfer returns a per-transfer mutex, creating one if needed.
-func (tm *TransferManager) lockForTransfer(id string) *sync.Mutex {
-	tm.transferMu.Lock()
-	defer tm.transferMu.Unlock()
-	mu, ok := tm.transferLocks[id]
-	if !ok {
-		mu = &sync.Mutex{}
-		tm.transferLocks[id] = mu
+// lockTransfer acquires the per-transfer lock from the configured Locker.
+func (tm *TransferManager) lockTransfer(ctx context.Context, id string) (stellarconnect.Lease, error) {
+	lease, err := tm.config.Locker.Acquire(ctx, "transfer:"+id, tm.config.LockTTL)
+	if err != nil {
+		return nil, errors.NewAnchorError(errors.LOCK_FAILED, "failed to lock transfer", err)
 	}
-	return mu
+	return lease, nil
 }
 
 type DepositRequest struct {
-	Account   string
-	AssetCode string
-	Amount    string
-	Mode      stellarconnect.TransferMode
-	Metadata  map[string]any
+	Account        string
+	AssetCode      string
+	Amount         string
+	Mode           stellarconnect.TransferMode
+	Metadata       map[string]any
+	IdempotencyKey string                  // Optional: retries with the same key return the original transfer
+	Memo           string                  // Optional: memo to attach to the Stellar payment to Account
+	MemoType       stellarconnect.MemoType // Required with Memo
+
+	// ClaimableBalanceSupported reports the wallet's claimable_balance_supported
+	// flag: the deposit may be paid as a claimable balance if Account has no
+	// trustline for the asset.
+	ClaimableBalanceSupported bool
+
+	// OnChangeCallback is the wallet's on_change_callback URL, notified of
+	// status changes by a CallbackNotifier. "postMessage" is stored but not
+	// called.
+	OnChangeCallback string
 }
 
 type DepositResult struct {
@@ -74,13 +134,19 @@ type DepositResult struct {
 }
 
 type WithdrawalRequest struct {
-	Account   string
-	AssetCode string
-	Amount    string
-	Mode      stellarconnect.TransferMode
-	Dest      string
-	DestExtra string
-	Metadata  map[string]any
+	Account        string
+	AssetCode      string
+	Amount         string
+	Mode           stellarconnect.TransferMode
+	Dest           string
+	DestExtra      string
+	Metadata       map[string]any
+	IdempotencyKey string // Optional: retries with the same key return the original transfer
+
+	// OnChangeCallback is the wallet's on_change_callback URL, notified of
+	// status changes by a CallbackNotifier. "postMessage" is stored but not
+	// called.
+	OnChangeCallback string
 }
 
 type WithdrawalResult struct {
@@ -98,7 +164,8 @@ type FundsReceivedDetails struct {
 }
 
 type PaymentSentDetails struct {
-	StellarTxHash string
+	StellarTxHash      string
+	ClaimableBalanceID string // Optional: set if the deposit was paid as a claimable balance
 }
 
 type PaymentReceivedDetails struct {
@@ -111,21 +178,32 @@ type DisbursementDetails struct {
 	ExternalRef string
 }
 
+type RefundDetails struct {
+	StellarTxHash string
+	Reason        string
+}
+
 type TransferStatusResponse struct {
-	ID           string     `json:"id"`
-	Kind         string     `json:"kind"`
-	Status       string     `json:"status"`
-	StatusETA    int        `json:"status_eta,omitempty"`
-	MoreInfoURL  string     `json:"more_info_url"`
-	AmountIn     string     `json:"amount_in,omitempty"`
-	AmountOut    string     `json:"amount_out,omitempty"`
-	To           string     `json:"to,omitempty"`
-	From         string     `json:"from,omitempty"`
-	StartedAt    time.Time  `json:"started_at"`
-	CompletedAt  *time.Time `json:"completed_at,omitempty"`
-	TxHash       string     `json:"stellar_transaction_id,omitempty"`
-	ExternalTxID string     `json:"external_transaction_id,omitempty"`
-	Message      string     `json:"message,omitempty"`
+	ID                    string        `json:"id"`
+	Kind                  string        `json:"kind"`
+	Status                string        `json:"status"`
+	StatusETA             int           `json:"status_eta,omitempty"`
+	MoreInfoURL           string        `json:"more_info_url"`
+	AmountIn              amount.Amount `json:"amount_in,omitzero"`
+	AmountOut             amount.Amount `json:"amount_out,omitzero"`
+	To                    string        `json:"to,omitempty"`
+	From                  string        `json:"from,omitempty"`
+	StartedAt             time.Time     `json:"started_at"`
+	CompletedAt           *time.Time    `json:"completed_at,omitempty"`
+	TxHash                string        `json:"stellar_transaction_id,omitempty"`
+	ExternalTxID          string        `json:"external_transaction_id,omitempty"`
+	Message               string        `json:"message,omitempty"`
+	WithdrawAnchorAccount string        `json:"withdraw_anchor_account,omitempty"`
+	WithdrawMemo          string        `json:"withdraw_memo,omitempty"`
+	WithdrawMemoType      string        `json:"withdraw_memo_type,omitempty"`
+	DepositMemo           string        `json:"deposit_memo,omitempty"`
+	DepositMemoType       string        `json:"deposit_memo_type,omitempty"`
+	ClaimableBalanceID    string        `json:"claimable_balance_id,omitempty"`
 }
 
 func (tm *TransferManager) InitiateDeposit(ctx context.Context, req DepositRequest) (*DepositResult, error) {
@@ -135,7 +213,37 @@ func (tm *TransferManager) InitiateDeposit(ctx context.Context, req DepositReque
 	if strings.TrimSpace(req.Account) == "" || strings.TrimSpace(req.AssetCode) == "" || strings.TrimSpace(req.Amount) == "" {
 		return nil, errors.NewAnchorError(errors.TRANSFER_INIT_FAILED, "account, asset_code, and amount are required", nil)
 	}
+	amt, err := parseTransferAmount(req.Amount)
+	if err != nil {
+		return nil, errors.NewAnchorError(errors.TRANSFER_INIT_FAILED, "invalid amount", err)
+	}
+	if req.Memo != "" {
+		if err := validateMemo(req.Memo, req.MemoType); err != nil {
+			return nil, errors.NewAnchorError(errors.TRANSFER_INIT_FAILED, "invalid deposit memo", err)
+		}
+	}
+	if err := validateCallbackURL(req.OnChangeCallback, tm.config.InsecureCallbacks); err != nil {
+		return nil, errors.NewAnchorError(errors.TRANSFER_INIT_FAILED, "invalid on_change_callback", err)
+	}
+
+	existing, reservation, err := tm.reserveIdempotencyKey(ctx, stellarconnect.KindDeposit, req.Account, req.IdempotencyKey, req.fingerprint(amt))
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return depositResult(existing), nil
+	}
 
+	result, err := tm.initiateDeposit(ctx, req, amt)
+	if err != nil {
+		reservation.release(ctx)
+		return nil, err
+	}
+	reservation.complete(ctx, result.ID)
+	return result, nil
+}
+
+func (tm *TransferManager) initiateDeposit(ctx context.Context, req DepositRequest, amt amount.Amount) (*DepositResult, error) {
 	id, err := corecrypto.GenerateNonce(16)
 	if err != nil {
 		return nil, errors.NewAnchorError(errors.TRANSFER_INIT_FAILED, "failed to generate transfer ID", err)
@@ -149,11 +257,17 @@ func (tm *TransferManager) InitiateDeposit(ctx context.Context, req DepositReque
 		Status:    stellarconnect.StatusInitiating,
 		AssetCode: req.AssetCode,
 		Account:   req.Account,
-		Amount:    req.Amount,
+		Amount:    amt,
 		Metadata:  req.Metadata,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
+	if req.Memo != "" {
+		transfer.DepositMemo = req.Memo
+		transfer.DepositMemoType = req.MemoType
+	}
+	transfer.ClaimableBalanceSupported = req.ClaimableBalanceSupported
+	transfer.OnChangeCallback = req.OnChangeCallback
 
 	if req.Mode == stellarconnect.ModeInteractive {
 		token, url, err := tm.generateInteractiveURL(id)
@@ -165,20 +279,28 @@ func (tm *TransferManager) InitiateDeposit(ctx context.Context, req DepositReque
 		transfer.Status = stellarconnect.StatusInteractive
 	}
 
-	if err := tm.store.Save(ctx, transfer); err != nil {
-		return nil, errors.NewAnchorError(errors.STORE_ERROR, "failed to save transfer", err)
-	}
-
 	if transfer.Mode == stellarconnect.ModeInteractive {
-		tm.hooks.Trigger(HookDepositInitiated, transfer)
-		return &DepositResult{ID: transfer.ID, InteractiveURL: transfer.InteractiveURL}, nil
+		if err := tm.save(ctx, transfer, HookDepositInitiated); err != nil {
+			return nil, err
+		}
+		return depositResult(transfer), nil
 	}
 
-	if err := tm.transition(ctx, transfer.ID, stellarconnect.StatusPendingExternal, ""); err != nil {
+	if err := tm.save(ctx, transfer); err != nil {
+		return nil, err
+	}
+	update := &stellarconnect.TransferUpdate{}
+	if err := tm.updateAndTransition(ctx, transfer.ID, update, stellarconnect.StatusPendingExternal, stageInitiated); err != nil {
 		return nil, err
 	}
-	tm.hooks.Trigger(HookDepositInitiated, transfer)
-	return &DepositResult{ID: transfer.ID, Instructions: "deposit initiated", ETA: 0}, nil
+	return depositResult(transfer), nil
+}
+
+func depositResult(transfer *stellarconnect.Transfer) *DepositResult {
+	if transfer.Mode == stellarconnect.ModeInteractive {
+		return &DepositResult{ID: transfer.ID, InteractiveURL: transfer.InteractiveURL}
+	}
+	return &DepositResult{ID: transfer.ID, Instructions: "deposit initiated", ETA: 0}
 }
 
 func (tm *TransferManager) InitiateWithdrawal(ctx context.Context, req WithdrawalRequest) (*WithdrawalResult, error) {
@@ -188,7 +310,32 @@ func (tm *TransferManager) InitiateWithdrawal(ctx context.Context, req Withdrawa
 	if strings.TrimSpace(req.Account) == "" || strings.TrimSpace(req.AssetCode) == "" || strings.TrimSpace(req.Amount) == "" {
 		return nil, errors.NewAnchorError(errors.TRANSFER_INIT_FAILED, "account, asset_code, and amount are required", nil)
 	}
+	amt, err := parseTransferAmount(req.Amount)
+	if err != nil {
+		return nil, errors.NewAnchorError(errors.TRANSFER_INIT_FAILED, "invalid amount", err)
+	}
+	if err := validateCallbackURL(req.OnChangeCallback, tm.config.InsecureCallbacks); err != nil {
+		return nil, errors.NewAnchorError(errors.TRANSFER_INIT_FAILED, "invalid on_change_callback", err)
+	}
 
+	existing, reservation, err := tm.reserveIdempotencyKey(ctx, stellarconnect.KindWithdrawal, req.Account, req.IdempotencyKey, req.fingerprint(amt))
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return tm.withdrawalResult(existing), nil
+	}
+
+	result, err := tm.initiateWithdrawal(ctx, req, amt)
+	if err != nil {
+		reservation.release(ctx)
+		return nil, err
+	}
+	reservation.complete(ctx, result.ID)
+	return result, nil
+}
+
+func (tm *TransferManager) initiateWithdrawal(ctx context.Context, req WithdrawalRequest, amt amount.Amount) (*WithdrawalResult, error) {
 	id, err := corecrypto.GenerateNonce(16)
 	if err != nil {
 		return nil, errors.NewAnchorError(errors.TRANSFER_INIT_FAILED, "failed to generate transfer ID", err)
@@ -202,11 +349,12 @@ func (tm *TransferManager) InitiateWithdrawal(ctx context.Context, req Withdrawa
 		Status:    stellarconnect.StatusInitiating,
 		AssetCode: req.AssetCode,
 		Account:   req.Account,
-		Amount:    req.Amount,
+		Amount:    amt,
 		Metadata:  req.Metadata,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
+	transfer.OnChangeCallback = req.OnChangeCallback
 
 	if req.Mode == stellarconnect.ModeInteractive {
 		token, url, err := tm.generateInteractiveURL(id)
@@ -220,36 +368,45 @@ func (tm *TransferManager) InitiateWithdrawal(ctx context.Context, req Withdrawa
 		transfer.Status = stellarconnect.StatusPaymentRequired
 	}
 
-	if err := tm.store.Save(ctx, transfer); err != nil {
-		return nil, errors.NewAnchorError(errors.STORE_ERROR, "failed to save transfer", err)
+	if tm.config.MuxedWithdrawals {
+		if err := tm.assignMuxID(ctx, transfer); err != nil {
+			return nil, err
+		}
+	} else if err := tm.assignMemo(ctx, transfer); err != nil {
+		return nil, err
 	}
 
-	tm.hooks.Trigger(HookWithdrawalInitiated, transfer)
+	if err := tm.save(ctx, transfer, HookWithdrawalInitiated); err != nil {
+		return nil, err
+	}
 
-	result := &WithdrawalResult{
+	return tm.withdrawalResult(transfer), nil
+}
+
+func (tm *TransferManager) withdrawalResult(transfer *stellarconnect.Transfer) *WithdrawalResult {
+	return &WithdrawalResult{
 		ID:              transfer.ID,
 		InteractiveURL:  transfer.InteractiveURL,
-		StellarAccount:  tm.config.DistributionAccount,
-		StellarMemo:     transfer.ID,
-		StellarMemoType: "text",
+		StellarAccount:  tm.withdrawAnchorAccount(transfer),
+		StellarMemo:     transfer.Memo,
+		StellarMemoType: string(transfer.MemoType),
 	}
-	return result, nil
 }
 
 func (tm *TransferManager) CompleteInteractive(ctx context.Context, transferID string, data map[string]any) error {
-	transfer, err := tm.store.FindByID(ctx, transferID)
-	if err != nil {
-		return errors.NewAnchorError(errors.STORE_ERROR, "failed to load transfer", err)
-	}
-	if transfer.Mode != stellarconnect.ModeInteractive {
-		return errors.NewAnchorError(errors.TRANSITION_INVALID, "transfer not in interactive mode", nil)
-	}
-
-	next := stellarconnect.StatusPendingExternal
-	if transfer.Kind == stellarconnect.KindDeposit {
-		next = stellarconnect.StatusPendingUserTransferStart
-	}
-	return tm.transition(ctx, transferID, next, "")
+	return tm.mutate(ctx, transferID, func(transfer *stellarconnect.Transfer) (*stellarconnect.TransferUpdate, []HookEvent, error) {
+		if transfer.Mode != stellarconnect.ModeInteractive {
+			return nil, nil, errors.NewAnchorError(errors.TRANSITION_INVALID, "transfer not in interactive mode", nil)
+		}
+		next := stellarconnect.StatusPendingExternal
+		if transfer.Kind == stellarconnect.KindDeposit {
+			next = stellarconnect.StatusPendingUserTransferStart
+		}
+		if err := ValidateTransition(transfer.Status, next); err != nil {
+			return nil, nil, err
+		}
+		return &stellarconnect.TransferUpdate{Status: &next}, []HookEvent{stageHook(transfer.Kind, stageInteractiveCompleted)}, nil
+	})
 }
 
 // PeekInteractiveToken validates the token without consuming it.
@@ -295,28 +452,129 @@ func (tm *TransferManager) VerifyInteractiveToken(ctx context.Context, token str
 func (tm *TransferManager) NotifyFundsReceived(ctx context.Context, transferID string, details FundsReceivedDetails) error {
 	update := &stellarconnect.TransferUpdate{ExternalRef: &details.ExternalRef}
 	if strings.TrimSpace(details.Amount) != "" {
-		update.Amount = &details.Amount
+		amt, err := parseTransferAmount(details.Amount)
+		if err != nil {
+			return errors.NewAnchorError(errors.PAYMENT_MISMATCH, "invalid received amount", err)
+		}
+		update.Amount = &amt
 	}
-	return tm.updateAndTransition(ctx, transferID, update, stellarconnect.StatusPendingStellar, HookDepositFundsReceived)
+	return tm.updateAndTransition(ctx, transferID, update, stellarconnect.StatusPendingStellar, stageFundsReceived)
 }
 
 func (tm *TransferManager) NotifyPaymentSent(ctx context.Context, transferID string, details PaymentSentDetails) error {
 	update := &stellarconnect.TransferUpdate{StellarTxHash: &details.StellarTxHash}
+	if details.ClaimableBalanceID != "" {
+		update.ClaimableBalanceID = &details.ClaimableBalanceID
+	}
 	completedAt := time.Now()
 	update.CompletedAt = &completedAt
-	return tm.updateAndTransition(ctx, transferID, update, stellarconnect.StatusCompleted, HookTransferStatusChanged)
+	return tm.updateAndTransition(ctx, transferID, update, stellarconnect.StatusCompleted, stagePaymentSent)
 }
 
+// NotifyPaymentReceived records an incoming Stellar payment for a transfer and
+// moves it to pending_stellar. Payments are summed in Transfer.AmountReceived,
+// so a top-up after a held underpayment is judged by the total received; the
+// hashes of the payments counted are listed in Metadata["received_tx_hashes"]
+// and a payment reported again is not counted twice. The
+// payment's asset and the total are validated against the transfer;
+// mismatches are handled according to Config.PaymentPolicy and fire
+// HookPaymentMismatch. Held and refunded payments leave the status and
+// StellarTxHash unchanged, record the payment in the mismatch metadata, and
+// return a PAYMENT_MISMATCH error.
 func (tm *TransferManager) NotifyPaymentReceived(ctx context.Context, transferID string, details PaymentReceivedDetails) error {
-	update := &stellarconnect.TransferUpdate{StellarTxHash: &details.StellarTxHash}
-	return tm.updateAndTransition(ctx, transferID, update, stellarconnect.StatusPendingStellar, HookWithdrawalStellarPaymentSent)
+	next := stellarconnect.StatusPendingStellar
+	var mismatch *PaymentMismatch
+	err := tm.mutate(ctx, transferID, func(transfer *stellarconnect.Transfer) (*stellarconnect.TransferUpdate, []HookEvent, error) {
+		if err := ValidateTransition(transfer.Status, next); err != nil {
+			return nil, nil, err
+		}
+		received, err := receivedTotal(transfer, details)
+		if err != nil {
+			return nil, nil, err
+		}
+		mismatch = checkPayment(transfer, details, received, tm.config.PaymentPolicy)
+
+		update := &stellarconnect.TransferUpdate{}
+		metadata := map[string]any{}
+		// count adds the payment to AmountReceived and lists its hash, so a
+		// replay is not counted twice.
+		count := func() {
+			update.AmountReceived = received
+			if hash := strings.TrimSpace(details.StellarTxHash); received != nil && hash != "" && !reported(transfer, hash) {
+				metadata[receivedHashesKey] = append(slices.Clone(receivedHashes(transfer)), hash)
+			}
+		}
+		finish := func(hooks ...HookEvent) (*stellarconnect.TransferUpdate, []HookEvent, error) {
+			if len(metadata) > 0 {
+				update.Metadata = mergeMetadata(transfer.Metadata, metadata)
+			}
+			return update, hooks, nil
+		}
+
+		if mismatch == nil || mismatch.Action == MismatchAccept {
+			if strings.TrimSpace(details.StellarTxHash) != "" {
+				update.StellarTxHash = &details.StellarTxHash
+			}
+			count()
+		}
+		if mismatch == nil {
+			update.Status = &next
+			return finish(stageHook(transfer.Kind, stageFundsReceived))
+		}
+
+		message := mismatch.message()
+		update.Message = &message
+		record := mismatch.metadata()
+		record["stellar_tx_hash"] = details.StellarTxHash
+		metadata["payment_mismatch"] = record
+		switch mismatch.Action {
+		case MismatchAccept:
+			if mismatch.Kind == MismatchWrongAsset {
+				code, issuer, _ := strings.Cut(details.AssetCode, ":")
+				update.AssetCode = &code
+				if issuer != "" || isNativeAsset(code) {
+					update.AssetIssuer = &issuer
+				}
+			} else {
+				update.Amount = received
+			}
+			update.Status = &next
+			return finish(HookPaymentMismatch, stageHook(transfer.Kind, stageFundsReceived))
+		case MismatchHold:
+			// The funds stay with the anchor; count them toward a top-up.
+			if mismatch.Kind != MismatchWrongAsset {
+				count()
+			}
+		}
+		return finish(HookPaymentMismatch)
+	})
+	if err != nil {
+		return err
+	}
+	if mismatch != nil && mismatch.Action != MismatchAccept {
+		return mismatch.error(transferID)
+	}
+	return nil
+}
+
+// NotifyRefunded marks a transfer as refunded after the anchor has returned the
+// user's funds, typically following a MismatchRefund payment.
+func (tm *TransferManager) NotifyRefunded(ctx context.Context, transferID string, details RefundDetails) error {
+	update := &stellarconnect.TransferUpdate{}
+	if strings.TrimSpace(details.StellarTxHash) != "" {
+		update.StellarTxHash = &details.StellarTxHash
+	}
+	if strings.TrimSpace(details.Reason) != "" {
+		update.Message = &details.Reason
+	}
+	return tm.updateAndTransition(ctx, transferID, update, stellarconnect.StatusRefunded, "")
 }
 
 func (tm *TransferManager) NotifyDisbursementSent(ctx context.Context, transferID string, details DisbursementDetails) error {
 	update := &stellarconnect.TransferUpdate{ExternalRef: &details.ExternalRef}
 	completedAt := time.Now()
 	update.CompletedAt = &completedAt
-	return tm.updateAndTransition(ctx, transferID, update, stellarconnect.StatusCompleted, HookTransferStatusChanged)
+	return tm.updateAndTransition(ctx, transferID, update, stellarconnect.StatusCompleted, stagePaymentSent)
 }
 
 func (tm *TransferManager) Deny(ctx context.Context, transferID string, reason string) error {
@@ -327,11 +585,36 @@ func (tm *TransferManager) Cancel(ctx context.Context, transferID string, reason
 	return tm.transition(ctx, transferID, stellarconnect.StatusCancelled, reason)
 }
 
+// Expire marks a transfer as expired, for example an interactive flow the
+// user abandoned or a deposit waiting too long for a trustline.
+func (tm *TransferManager) Expire(ctx context.Context, transferID string, reason string) error {
+	return tm.transition(ctx, transferID, stellarconnect.StatusExpired, reason)
+}
+
+// Transition moves a transfer to any status the state machine allows from its
+// current one, recording message as its status message. It is meant for
+// operator tooling; flows should use the Notify methods, which also record the
+// references that came with the change.
+func (tm *TransferManager) Transition(ctx context.Context, transferID string, next stellarconnect.TransferStatus, message string) error {
+	return tm.transition(ctx, transferID, next, message)
+}
+
+// Fail marks a transfer as failed after an unrecoverable error, such as a
+// rejected off-chain order.
+func (tm *TransferManager) Fail(ctx context.Context, transferID string, reason string) error {
+	return tm.transition(ctx, transferID, stellarconnect.StatusFailed, reason)
+}
+
 func (tm *TransferManager) GetStatus(ctx context.Context, transferID string) (*TransferStatusResponse, error) {
 	transfer, err := tm.store.FindByID(ctx, transferID)
 	if err != nil {
 		return nil, errors.NewAnchorError(errors.STORE_ERROR, "failed to load transfer", err)
 	}
+	return tm.statusResponse(transfer), nil
+}
+
+// statusResponse renders a transfer as returned by GetStatus.
+func (tm *TransferManager) statusResponse(transfer *stellarconnect.Transfer) *TransferStatusResponse {
 	baseURL := tm.config.BaseURL
 	if baseURL == "" {
 		baseURL = "http://localhost:8000"
@@ -353,49 +636,216 @@ func (tm *TransferManager) GetStatus(ctx context.Context, transferID string) (*T
 	// SEP-24: deposits require "to" (user's Stellar account), withdrawals require "from"
 	if transfer.Kind == stellarconnect.KindDeposit {
 		resp.To = transfer.Account
+		resp.DepositMemo = transfer.DepositMemo
+		resp.DepositMemoType = string(transfer.DepositMemoType)
+		resp.ClaimableBalanceID = transfer.ClaimableBalanceID
 	} else if transfer.Kind == stellarconnect.KindWithdrawal {
 		resp.From = transfer.Account
+		if transfer.Memo != "" || transfer.MuxID != 0 {
+			resp.WithdrawAnchorAccount = tm.withdrawAnchorAccount(transfer)
+			resp.WithdrawMemo = transfer.Memo
+			resp.WithdrawMemoType = string(transfer.MemoType)
+		}
 	}
-	return resp, nil
+	return resp
 }
 
-func (tm *TransferManager) updateAndTransition(ctx context.Context, transferID string, update *stellarconnect.TransferUpdate, next stellarconnect.TransferStatus, hook HookEvent) error {
-	mu := tm.lockForTransfer(transferID)
-	mu.Lock()
-	defer mu.Unlock()
+// FindByMemo returns the transfer that was assigned the given memo.
+// It uses the store's memo index when the store implements
+// stellarconnect.MemoTransferStore and falls back to scanning withdrawals
+// and receives otherwise. An empty memoType matches any memo type.
+func (tm *TransferManager) FindByMemo(ctx context.Context, memo string, memoType stellarconnect.MemoType) (*stellarconnect.Transfer, error) {
+	if tm.store == nil {
+		return nil, errors.NewAnchorError(errors.STORE_ERROR, "transfer store not configured", nil)
+	}
+	if memo == "" {
+		return nil, errors.NewAnchorError(errors.TRANSFER_NOT_FOUND, "memo is empty", nil)
+	}
+	if ms, ok := tm.store.(stellarconnect.MemoTransferStore); ok {
+		transfer, err := ms.FindByMemo(ctx, memo, memoType)
+		if err != nil {
+			return nil, errors.NewAnchorError(errors.TRANSFER_NOT_FOUND, "no transfer for memo", err)
+		}
+		return transfer, nil
+	}
 
-	transfer, err := tm.store.FindByID(ctx, transferID)
+	transfers, err := tm.payableTransfers(ctx)
 	if err != nil {
-		return errors.NewAnchorError(errors.STORE_ERROR, "failed to load transfer", err)
+		return nil, errors.NewAnchorError(errors.STORE_ERROR, "failed to list transfers", err)
 	}
-	if err := ValidateTransition(transfer.Status, next); err != nil {
-		return err
+	for _, transfer := range transfers {
+		if memoMatches(transfer, memo, memoType) {
+			return transfer, nil
+		}
 	}
-	update.Status = &next
-	if err := tm.store.Update(ctx, transferID, update); err != nil {
-		return errors.NewAnchorError(errors.STORE_ERROR, "failed to update transfer", err)
+	return nil, errors.NewAnchorError(errors.TRANSFER_NOT_FOUND, "no transfer for memo", nil)
+}
+
+// payableTransfers lists the transfers the anchor is paid for on Stellar:
+// withdrawals and SEP-31 receives.
+func (tm *TransferManager) payableTransfers(ctx context.Context) ([]*stellarconnect.Transfer, error) {
+	var result []*stellarconnect.Transfer
+	for _, kind := range []stellarconnect.TransferKind{stellarconnect.KindWithdrawal, stellarconnect.KindReceive} {
+		transfers, err := tm.store.List(ctx, stellarconnect.TransferFilters{Kind: &kind})
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, transfers...)
 	}
-	updated, err := tm.store.FindByID(ctx, transferID)
-	if err == nil {
-		tm.hooks.Trigger(hook, updated)
-		tm.hooks.Trigger(HookTransferStatusChanged, updated)
+	return result, nil
+}
+
+// assignMemo generates a memo for the transfer using the configured strategy,
+// retrying when the generated memo is already assigned to another transfer.
+func (tm *TransferManager) assignMemo(ctx context.Context, transfer *stellarconnect.Transfer) error {
+	for attempt := 0; attempt < memoGenerationAttempts; attempt++ {
+		memo, memoType, err := tm.config.MemoStrategy.GenerateMemo(ctx, transfer)
+		if err != nil {
+			return errors.NewAnchorError(errors.TRANSFER_INIT_FAILED, "failed to generate memo", err)
+		}
+		if err := validateMemo(memo, memoType); err != nil {
+			return errors.NewAnchorError(errors.TRANSFER_INIT_FAILED, "memo strategy returned an invalid memo", err)
+		}
+		if existing, err := tm.FindByMemo(ctx, memo, memoType); err == nil && existing != nil {
+			continue
+		}
+		transfer.Memo = memo
+		transfer.MemoType = memoType
+		return nil
+	}
+	return errors.NewAnchorError(errors.TRANSFER_INIT_FAILED, "failed to generate a unique memo", nil)
+}
+
+// save persists a new transfer with its history entry and delivers the given
+// hooks. With the outbox enabled the hook events are stored in the same write
+// instead of fired.
+func (tm *TransferManager) save(ctx context.Context, transfer *stellarconnect.Transfer, hooks ...HookEvent) error {
+	batch := newHookBatch(ctx, hooks, "", nil)
+	entry := createdEntry(ctx, transfer)
+	var err error
+	switch {
+	case tm.history != nil:
+		err = tm.history.SaveWithHistory(ctx, transfer, entry, tm.outboxEvents(batch))
+	case tm.outbox != nil:
+		err = tm.outbox.SaveWithEvents(ctx, transfer, batch.outboxEvents())
+	default:
+		err = tm.store.Save(ctx, transfer)
+	}
+	if err != nil {
+		return errors.NewAnchorError(errors.STORE_ERROR, "failed to save transfer", err)
+	}
+	if tm.history == nil {
+		tm.appendHistory(ctx, entry)
+	}
+	if tm.outbox == nil {
+		tm.fire(ctx, transfer, batch)
 	}
 	return nil
 }
 
-func (tm *TransferManager) transition(ctx context.Context, transferID string, next stellarconnect.TransferStatus, message string) error {
-	mu := tm.lockForTransfer(transferID)
-	mu.Lock()
-	defer mu.Unlock()
+// outboxEvents returns the batch's events to store with a change, or nil
+// when the outbox is disabled.
+func (tm *TransferManager) outboxEvents(batch *hookBatch) []stellarconnect.OutboxEvent {
+	if tm.outbox == nil {
+		return nil
+	}
+	return batch.outboxEvents()
+}
 
-	transfer, err := tm.store.FindByID(ctx, transferID)
+// mutate loads the transfer, asks fn for the update to apply and the hooks it
+// produces, and writes it, all while holding the transfer's lock. If the store
+// implements stellarconnect.VersionedTransferStore, the write is a
+// compare-and-swap on the loaded version; on conflict the transfer is re-read
+// and fn is called again, so fn must be free of side effects. The version
+// check also guards against a lease that expired mid-update. A nil update from
+// fn leaves the transfer unchanged.
+//
+// fn returns only the stage hooks of the change: the kind-specific event for a
+// terminal status and HookTransferStatusChanged are added for every status
+// change (see transitionHooks), so each fires once whichever method made it.
+//
+// Every committed write is recorded in the transfer history, in the same
+// store operation if the store implements stellarconnect.AtomicHistoryStore.
+// With the outbox enabled the hook events are committed with the update;
+// otherwise the hooks fire after the lock is released.
+func (tm *TransferManager) mutate(ctx context.Context, transferID string, fn func(*stellarconnect.Transfer) (*stellarconnect.TransferUpdate, []HookEvent, error)) error {
+	batch, err := tm.mutateLocked(ctx, transferID, fn)
+	if batch != nil && tm.outbox == nil {
+		tm.triggerUpdated(ctx, transferID, batch)
+	}
+	return err
+}
+
+// mutateLocked performs the locked read-modify-write for mutate. It returns
+// the change's hook batch once the update is committed, and nil otherwise.
+func (tm *TransferManager) mutateLocked(ctx context.Context, transferID string, fn func(*stellarconnect.Transfer) (*stellarconnect.TransferUpdate, []HookEvent, error)) (*hookBatch, error) {
+	lease, err := tm.lockTransfer(ctx, transferID)
 	if err != nil {
-		return errors.NewAnchorError(errors.STORE_ERROR, "failed to load transfer", err)
+		return nil, err
 	}
-	if err := ValidateTransition(transfer.Status, next); err != nil {
-		return err
+	defer lease.Release(ctx)
+
+	versioned, isVersioned := tm.store.(stellarconnect.VersionedTransferStore)
+	var conflict error
+	for attempt := 0; attempt < maxConflictRetries; attempt++ {
+		transfer, err := tm.store.FindByID(ctx, transferID)
+		if err != nil {
+			return nil, errors.NewAnchorError(errors.STORE_ERROR, "failed to load transfer", err)
+		}
+		update, hooks, err := fn(transfer)
+		if err != nil {
+			return nil, err
+		}
+		if update == nil {
+			return nil, nil
+		}
+		hooks = transitionHooks(transfer, update, hooks)
+		changes := diffUpdate(transfer, update)
+		batch := newHookBatch(ctx, hooks, transfer.Status, changes)
+		entry := changeEntry(ctx, transfer, update, changes)
+
+		switch {
+		case tm.history != nil:
+			err = tm.history.UpdateWithHistory(ctx, transferID, transfer.Version, update, entry, tm.outboxEvents(batch))
+		case tm.outbox != nil:
+			err = tm.outbox.UpdateWithEvents(ctx, transferID, transfer.Version, update, batch.outboxEvents())
+		case isVersioned:
+			err = versioned.CompareAndUpdate(ctx, transferID, transfer.Version, update)
+		default:
+			err = tm.store.Update(ctx, transferID, update)
+		}
+		if err == nil {
+			if tm.history == nil {
+				tm.appendHistory(ctx, entry)
+			}
+			return batch, nil
+		}
+		if !stellarconnect.IsVersionConflict(err) {
+			return nil, errors.NewAnchorError(errors.STORE_ERROR, "failed to update transfer", err)
+		}
+		conflict = err
 	}
-	update := &stellarconnect.TransferUpdate{Status: &next}
+	return nil, errors.NewAnchorError(errors.VERSION_CONFLICT, "transfer was modified concurrently", conflict)
+}
+
+// updateAndTransition applies update and moves the transfer to next, firing
+// the kind-specific event for stage, if any, before the status events.
+func (tm *TransferManager) updateAndTransition(ctx context.Context, transferID string, update *stellarconnect.TransferUpdate, next stellarconnect.TransferStatus, stage hookStage) error {
+	return tm.mutate(ctx, transferID, func(transfer *stellarconnect.Transfer) (*stellarconnect.TransferUpdate, []HookEvent, error) {
+		if err := ValidateTransition(transfer.Status, next); err != nil {
+			return nil, nil, err
+		}
+		update.Status = &next
+		var hooks []HookEvent
+		if stage != "" {
+			hooks = append(hooks, stageHook(transfer.Kind, stage))
+		}
+		return update, hooks, nil
+	})
+}
+
+func (tm *TransferManager) transition(ctx context.Context, transferID string, next stellarconnect.TransferStatus, message string) error {
+	update := &stellarconnect.TransferUpdate{}
 	if strings.TrimSpace(message) != "" {
 		update.Message = &message
 	}
@@ -403,14 +853,29 @@ func (tm *TransferManager) transition(ctx context.Context, transferID string, ne
 		completedAt := time.Now()
 		update.CompletedAt = &completedAt
 	}
-	if err := tm.store.Update(ctx, transferID, update); err != nil {
-		return errors.NewAnchorError(errors.STORE_ERROR, "failed to update transfer", err)
+	return tm.updateAndTransition(ctx, transferID, update, next, "")
+}
+
+// triggerUpdated reloads the transfer and fires the batch's hooks in order.
+// Hooks are skipped if the transfer cannot be reloaded.
+func (tm *TransferManager) triggerUpdated(ctx context.Context, transferID string, batch *hookBatch) {
+	if len(batch.events) == 0 {
+		return
 	}
 	updated, err := tm.store.FindByID(ctx, transferID)
-	if err == nil {
-		tm.hooks.Trigger(HookTransferStatusChanged, updated)
+	if err != nil {
+		return
+	}
+	tm.fire(ctx, updated, batch)
+}
+
+// fire triggers hooks for a change that is already committed. Handler errors
+// cannot undo it, so they go to the registry's error handler.
+func (tm *TransferManager) fire(ctx context.Context, transfer *stellarconnect.Transfer, batch *hookBatch) {
+	for _, hook := range batch.events {
+		event := batch.envelope(hook, transfer)
+		tm.hooks.report(event, tm.hooks.Trigger(ctx, event))
 	}
-	return nil
 }
 
 func (tm *TransferManager) generateInteractiveURL(transferID string) (string, string, error) {
@@ -433,13 +898,27 @@ func (tm *TransferManager) generateInteractiveURL(transferID string) (string, st
 	return token, url, nil
 }
 
+// parseTransferAmount parses the amount of a transfer request. Zero is
+// allowed for interactive flows where the user enters the amount later.
+func parseTransferAmount(s string) (amount.Amount, error) {
+	amt, err := amount.Parse(s)
+	if err != nil {
+		return amount.Zero, err
+	}
+	if amt.IsNegative() {
+		return amount.Zero, fmt.Errorf("amount %s is negative", amt)
+	}
+	return amt, nil
+}
+
 func isTerminal(status stellarconnect.TransferStatus) bool {
 	switch status {
 	case stellarconnect.StatusCompleted,
 		stellarconnect.StatusFailed,
 		stellarconnect.StatusDenied,
 		stellarconnect.StatusCancelled,
-		stellarconnect.StatusExpired:
+		stellarconnect.StatusExpired,
+		stellarconnect.StatusRefunded:
 		return true
 	default:
 		return false
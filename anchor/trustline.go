@@ -0,0 +1,164 @@
+package anchor
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+)
+
+// NotifyTrustlineRequired moves a deposit from pending_stellar to
+// pending_trust because the user's account cannot yet receive the asset.
+// The deposit waits there until NotifyTrustlineAdded or ResumeTrustline.
+func (tm *TransferManager) NotifyTrustlineRequired(ctx context.Context, transferID string) error {
+	return tm.mutate(ctx, transferID, func(transfer *stellarconnect.Transfer) (*stellarconnect.TransferUpdate, []HookEvent, error) {
+		next := stellarconnect.StatusPendingTrust
+		if err := ValidateTransition(transfer.Status, next); err != nil {
+			return nil, nil, err
+		}
+		message := fmt.Sprintf("waiting for the user to add a trustline for %s", formatTransferAsset(transfer))
+		return &stellarconnect.TransferUpdate{Status: &next, Message: &message}, []HookEvent{HookTransferStatusChanged}, nil
+	})
+}
+
+// NotifyTrustlineAdded moves a deposit waiting in pending_trust back to
+// pending_stellar so that it is paid out.
+func (tm *TransferManager) NotifyTrustlineAdded(ctx context.Context, transferID string) error {
+	return tm.mutate(ctx, transferID, func(transfer *stellarconnect.Transfer) (*stellarconnect.TransferUpdate, []HookEvent, error) {
+		next := stellarconnect.StatusPendingStellar
+		if transfer.Status != stellarconnect.StatusPendingTrust {
+			return nil, nil, errors.NewAnchorError(errors.TRANSITION_INVALID,
+				fmt.Sprintf("transfer is %s, not waiting for a trustline", transfer.Status), nil)
+		}
+		message := ""
+		return &stellarconnect.TransferUpdate{Status: &next, Message: &message}, []HookEvent{HookTransferStatusChanged}, nil
+	})
+}
+
+// ResumeTrustline resumes every deposit waiting in pending_trust for account,
+// a G... address, to receive asset ("CODE:ISSUER"). Deposits to muxed
+// addresses of the account are included. Returns how many were resumed;
+// processing continues past failures and the first error is returned.
+func (tm *TransferManager) ResumeTrustline(ctx context.Context, account, asset string) (int, error) {
+	waiting, err := tm.waitingForTrust(ctx, account, asset)
+	if err != nil {
+		return 0, err
+	}
+	resumed := 0
+	var firstErr error
+	for _, transfer := range waiting {
+		if err := tm.NotifyTrustlineAdded(ctx, transfer.ID); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		resumed++
+	}
+	return resumed, firstErr
+}
+
+// TrustlineAccounts returns the accounts (G... addresses) that have deposits
+// waiting in pending_trust, each once.
+func (tm *TransferManager) TrustlineAccounts(ctx context.Context) ([]string, error) {
+	transfers, err := tm.pendingTrust(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var accounts []string
+	for _, transfer := range transfers {
+		owner, err := baseAccount(transfer.Account)
+		if err != nil || slices.Contains(accounts, owner) {
+			continue
+		}
+		accounts = append(accounts, owner)
+	}
+	return accounts, nil
+}
+
+// CheckTrustline looks up account, a G... address, with accounts and resumes
+// its deposits waiting in pending_trust for any asset it now holds an
+// authorized trustline for. Returns how many were resumed; processing
+// continues past failures and the first error is returned.
+func (tm *TransferManager) CheckTrustline(ctx context.Context, accounts stellarconnect.AccountInfoFetcher, account string) (int, error) {
+	waiting, err := tm.waitingForTrust(ctx, account, "")
+	if err != nil || len(waiting) == 0 {
+		return 0, err
+	}
+	info, err := accounts.FetchAccountInfo(ctx, account)
+	if err != nil {
+		return 0, errors.NewAnchorError(errors.NETWORK_ERROR, "failed to look up account "+account, err)
+	}
+	if info == nil {
+		return 0, nil
+	}
+
+	resumed := 0
+	var firstErr error
+	for _, transfer := range waiting {
+		if !trusts(info, transfer) {
+			continue
+		}
+		if err := tm.NotifyTrustlineAdded(ctx, transfer.ID); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		resumed++
+	}
+	return resumed, firstErr
+}
+
+// trusts reports whether the account holds an authorized trustline for the
+// transfer's asset.
+func trusts(info *stellarconnect.AccountInfo, transfer *stellarconnect.Transfer) bool {
+	for _, b := range info.Balances {
+		if b.Asset != "native" && b.Authorized && assetMatches(transfer, b.Asset) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitingForTrust returns the deposits in pending_trust for account and
+// asset, or for any asset when asset is empty.
+func (tm *TransferManager) waitingForTrust(ctx context.Context, account, asset string) ([]*stellarconnect.Transfer, error) {
+	code, _, _ := strings.Cut(asset, ":")
+	transfers, err := tm.pendingTrust(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	var waiting []*stellarconnect.Transfer
+	for _, transfer := range transfers {
+		owner, err := baseAccount(transfer.Account)
+		if err != nil || owner != account || (asset != "" && !assetMatches(transfer, asset)) {
+			continue
+		}
+		waiting = append(waiting, transfer)
+	}
+	return waiting, nil
+}
+
+// pendingTrust lists the deposits in pending_trust, optionally only those of
+// one asset code.
+func (tm *TransferManager) pendingTrust(ctx context.Context, code string) ([]*stellarconnect.Transfer, error) {
+	if tm.store == nil {
+		return nil, errors.NewAnchorError(errors.STORE_ERROR, "transfer store not configured", nil)
+	}
+	status := stellarconnect.StatusPendingTrust
+	kind := stellarconnect.KindDeposit
+	transfers, err := tm.store.List(ctx, stellarconnect.TransferFilters{
+		AssetCode: code,
+		Status:    &status,
+		Kind:      &kind,
+	})
+	if err != nil {
+		return nil, errors.NewAnchorError(errors.STORE_ERROR, "failed to list deposits waiting for a trustline", err)
+	}
+	return transfers, nil
+}
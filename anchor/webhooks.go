@@ -0,0 +1,610 @@
+package anchor
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/core/amount"
+	corecrypto "github.com/marwen-abid/anchor-sdk-go/core/crypto"
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+)
+
+// WebhookPayloadVersion is the version of the webhook JSON format, sent in
+// every payload. It changes only when fields are removed or change meaning.
+const WebhookPayloadVersion = "1"
+
+// Headers of outgoing webhook requests.
+const (
+	WebhookIDHeader        = "X-Webhook-Id"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+const (
+	defaultWebhookTimeout        = 10 * time.Second
+	defaultWebhookMaxAttempts    = 8
+	defaultWebhookInitialBackoff = 5 * time.Second
+	defaultWebhookMaxBackoff     = 10 * time.Minute
+	defaultWebhookPollInterval   = time.Second
+	defaultWebhookConcurrency    = 4
+	defaultWebhookRetention      = 1000
+	defaultWebhookDeadRetention  = 7 * 24 * time.Hour
+)
+
+// WebhookState is the delivery state of a webhook event to one endpoint.
+type WebhookState string
+
+const (
+	// WebhookPending means the event has not been accepted by the endpoint
+	// yet and will be attempted again.
+	WebhookPending WebhookState = "pending"
+
+	// WebhookDelivered means the endpoint answered with a 2xx status.
+	WebhookDelivered WebhookState = "delivered"
+
+	// WebhookDead means every attempt failed; the event is kept for
+	// inspection and Redeliver.
+	WebhookDead WebhookState = "dead"
+)
+
+// WebhookEndpoint subscribes an HTTP endpoint to hook events.
+type WebhookEndpoint struct {
+	ID     string      // Optional: assigned by Subscribe if empty
+	URL    string      // Required: absolute http(s) URL receiving POST requests
+	Secret []byte      // Required: HMAC-SHA256 key shared with the endpoint
+	Events []HookEvent // Required: events delivered to the endpoint
+}
+
+// WebhookConfig configures a WebhookDispatcher.
+type WebhookConfig struct {
+	HTTPClient     *http.Client  // Optional: client for webhook requests (default: 10s timeout)
+	MaxAttempts    int           // Optional: failed attempts before an event is dead-lettered (default: 8)
+	InitialBackoff time.Duration // Optional: wait before the first retry, doubled on each retry (default: 5s)
+	MaxBackoff     time.Duration // Optional: upper bound of the wait between retries (default: 10m)
+	PollInterval   time.Duration // Optional: how often Run looks for due deliveries (default: 1s)
+	Concurrency    int           // Optional: requests in flight at once (default: 4)
+	Retention      int           // Optional: delivered events kept for Deliveries (default: 1000)
+	DeadRetention  time.Duration // Optional: how long dead-lettered events are kept for Redeliver (default: 7d)
+}
+
+// WebhookPayload is the JSON body of a webhook request. Its id, type, and
+// data fields match webhook.JSONEnvelope's defaults, so a webhook.Receiver
+// can consume it directly.
+type WebhookPayload struct {
+	ID        string      `json:"id"` // Same on every attempt; receivers should deduplicate on it
+	Type      string      `json:"type"`
+	Version   string      `json:"version"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      WebhookData `json:"data"`
+}
+
+// WebhookData is the data of a webhook payload.
+type WebhookData struct {
+	Transfer       WebhookTransfer `json:"transfer"`
+	PreviousStatus string          `json:"previous_status,omitempty"` // Empty when the transfer was created
+	CorrelationID  string          `json:"correlation_id,omitempty"`  // Shared by the events of one transfer change
+}
+
+// WebhookTransfer is the JSON form of a transfer in webhook payloads. The
+// interactive token is omitted: it is a credential for the user's session.
+type WebhookTransfer struct {
+	ID                 string         `json:"id"`
+	Kind               string         `json:"kind"`
+	Mode               string         `json:"mode"`
+	Status             string         `json:"status"`
+	AssetCode          string         `json:"asset_code"`
+	AssetIssuer        string         `json:"asset_issuer,omitempty"`
+	Account            string         `json:"account"`
+	Amount             amount.Amount  `json:"amount,omitzero"`
+	AmountReceived     amount.Amount  `json:"amount_received,omitzero"`
+	ExternalRef        string         `json:"external_ref,omitempty"`
+	StellarTxHash      string         `json:"stellar_tx_hash,omitempty"`
+	Memo               string         `json:"memo,omitempty"`
+	MemoType           string         `json:"memo_type,omitempty"`
+	MuxID              uint64         `json:"mux_id,omitempty"`
+	DepositMemo        string         `json:"deposit_memo,omitempty"`
+	DepositMemoType    string         `json:"deposit_memo_type,omitempty"`
+	ClaimableBalanceID string         `json:"claimable_balance_id,omitempty"`
+	Message            string         `json:"message,omitempty"`
+	Metadata           map[string]any `json:"metadata,omitempty"`
+	Version            int64          `json:"version"` // Orders events of one transfer
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	CompletedAt        *time.Time     `json:"completed_at,omitempty"`
+}
+
+// NewWebhookTransfer converts a transfer to its webhook JSON form.
+func NewWebhookTransfer(t *stellarconnect.Transfer) WebhookTransfer {
+	return WebhookTransfer{
+		ID:                 t.ID,
+		Kind:               string(t.Kind),
+		Mode:               string(t.Mode),
+		Status:             string(t.Status),
+		AssetCode:          t.AssetCode,
+		AssetIssuer:        t.AssetIssuer,
+		Account:            t.Account,
+		Amount:             t.Amount,
+		AmountReceived:     t.AmountReceived,
+		ExternalRef:        t.ExternalRef,
+		StellarTxHash:      t.StellarTxHash,
+		Memo:               t.Memo,
+		MemoType:           string(t.MemoType),
+		MuxID:              t.MuxID,
+		DepositMemo:        t.DepositMemo,
+		DepositMemoType:    string(t.DepositMemoType),
+		ClaimableBalanceID: t.ClaimableBalanceID,
+		Message:            t.Message,
+		Metadata:           t.Metadata,
+		Version:            t.Version,
+		CreatedAt:          t.CreatedAt,
+		UpdatedAt:          t.UpdatedAt,
+		CompletedAt:        t.CompletedAt,
+	}
+}
+
+// WebhookDelivery is the delivery status of one event to one endpoint.
+type WebhookDelivery struct {
+	ID             string // Payload ID, shared by all attempts and by redeliveries of the same hook event
+	EndpointID     string
+	URL            string
+	Event          HookEvent
+	TransferID     string
+	State          WebhookState
+	Attempts       int
+	LastStatusCode int    // HTTP status of the last response; 0 if none was received
+	LastError      string // Why the last attempt failed
+	CreatedAt      time.Time
+	NextAttemptAt  time.Time // When a pending event is attempted next
+	DeliveredAt    *time.Time
+	DeadAt         *time.Time // Set when the event was dead-lettered
+	Payload        []byte     // JSON body sent to the endpoint
+}
+
+// WebhookDeliveryFilter selects deliveries; zero fields match everything.
+type WebhookDeliveryFilter struct {
+	EndpointID string
+	TransferID string
+	State      WebhookState
+}
+
+// WebhookDispatcher delivers HookRegistry events to subscribed HTTP
+// endpoints, such as the anchor's own backend services.
+//
+// Each event is rendered as a WebhookPayload when the hook fires and POSTed
+// to every endpoint subscribed to it. Requests carry:
+//
+//	X-Webhook-Id         the payload ID
+//	X-Webhook-Timestamp  Unix seconds when the request was signed
+//	X-Webhook-Signature  "sha256=" + hex HMAC-SHA256 of "<timestamp>.<body>"
+//
+// so a webhook.Receiver configured with webhook.HMACSHA256{Header:
+// WebhookSignatureHeader, Prefix: "sha256="} and TimestampHeader:
+// WebhookTimestampHeader verifies them.
+//
+// The payload ID is derived from the change that fired the hook, so a hook
+// event fired again, e.g. when the outbox replays it, is not queued twice
+// and keeps its X-Webhook-Id.
+//
+// Deliveries are made by Run (or DeliverPending). Any answer other than a
+// 2xx status is retried with exponential backoff; after MaxAttempts failed
+// attempts the delivery is dead-lettered and kept for DeadRetention.
+// Deliveries are kept in memory, so
+// pending events are lost if the process exits; enable Config.Outbox to
+// make the hooks themselves durable. Events to one endpoint may arrive out
+// of order while earlier ones are retried; use the transfer version to
+// order them.
+type WebhookDispatcher struct {
+	hooks          *HookRegistry
+	client         *http.Client
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	pollInterval   time.Duration
+	concurrency    int
+	retention      int
+	deadRetention  time.Duration
+
+	mu         sync.Mutex
+	endpoints  map[string]*WebhookEndpoint
+	registered map[HookEvent]bool
+	deliveries map[string]*webhookDelivery
+	order      []string // delivery keys, oldest first
+}
+
+// webhookDelivery is the dispatcher's record of a delivery.
+type webhookDelivery struct {
+	WebhookDelivery
+	secret   []byte
+	inFlight bool
+}
+
+// NewWebhookDispatcher creates a dispatcher for events fired by hooks.
+func NewWebhookDispatcher(hooks *HookRegistry, config WebhookConfig) (*WebhookDispatcher, error) {
+	if hooks == nil {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "hook registry is required", nil)
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: defaultWebhookTimeout}
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultWebhookMaxAttempts
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = defaultWebhookInitialBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaultWebhookMaxBackoff
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaultWebhookPollInterval
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaultWebhookConcurrency
+	}
+	if config.Retention <= 0 {
+		config.Retention = defaultWebhookRetention
+	}
+	if config.DeadRetention <= 0 {
+		config.DeadRetention = defaultWebhookDeadRetention
+	}
+	return &WebhookDispatcher{
+		hooks:          hooks,
+		client:         config.HTTPClient,
+		maxAttempts:    config.MaxAttempts,
+		initialBackoff: config.InitialBackoff,
+		maxBackoff:     config.MaxBackoff,
+		pollInterval:   config.PollInterval,
+		concurrency:    config.Concurrency,
+		retention:      config.Retention,
+		deadRetention:  config.DeadRetention,
+		endpoints:      make(map[string]*WebhookEndpoint),
+		registered:     make(map[HookEvent]bool),
+		deliveries:     make(map[string]*webhookDelivery),
+	}, nil
+}
+
+// Subscribe adds an endpoint, or replaces the one with the same ID, and
+// returns its ID. Only events fired after Subscribe are delivered to it.
+func (d *WebhookDispatcher) Subscribe(endpoint WebhookEndpoint) (string, error) {
+	u, err := url.Parse(endpoint.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.NewAnchorError(errors.CONFIG_INVALID, "webhook URL must be an absolute http(s) URL", err)
+	}
+	if len(endpoint.Secret) == 0 {
+		return "", errors.NewAnchorError(errors.CONFIG_INVALID, "webhook secret is required", nil)
+	}
+	if len(endpoint.Events) == 0 {
+		return "", errors.NewAnchorError(errors.CONFIG_INVALID, "webhook endpoint must subscribe to at least one event", nil)
+	}
+	if endpoint.ID == "" {
+		id, err := corecrypto.GenerateNonce(12)
+		if err != nil {
+			return "", errors.NewAnchorError(errors.CONFIG_INVALID, "failed to generate endpoint ID", err)
+		}
+		endpoint.ID = "whe_" + id
+	}
+	endpoint.Secret = append([]byte(nil), endpoint.Secret...)
+	endpoint.Events = append([]HookEvent(nil), endpoint.Events...)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.endpoints[endpoint.ID] = &endpoint
+	for _, event := range endpoint.Events {
+		if d.registered[event] {
+			continue
+		}
+		d.registered[event] = true
+		d.hooks.On(event, func(_ context.Context, e *HookEnvelope) error {
+			return d.enqueue(e)
+		})
+	}
+	return endpoint.ID, nil
+}
+
+// Unsubscribe removes an endpoint. Its pending deliveries are still
+// attempted. Reports whether the endpoint existed.
+func (d *WebhookDispatcher) Unsubscribe(endpointID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.endpoints[endpointID]
+	delete(d.endpoints, endpointID)
+	return ok
+}
+
+// Endpoints returns the subscribed endpoints, sorted by ID, without their
+// secrets.
+func (d *WebhookDispatcher) Endpoints() []WebhookEndpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	result := make([]WebhookEndpoint, 0, len(d.endpoints))
+	for _, endpoint := range d.endpoints {
+		result = append(result, WebhookEndpoint{
+			ID:     endpoint.ID,
+			URL:    endpoint.URL,
+			Events: append([]HookEvent(nil), endpoint.Events...),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// enqueue renders the event once and queues it for every subscribed
+// endpoint that does not have it yet.
+func (d *WebhookDispatcher) enqueue(e *HookEnvelope) error {
+	event, transfer := e.Event, e.Transfer
+	if transfer == nil {
+		return nil
+	}
+	id := webhookDeliveryID(e)
+	now := time.Now()
+	body, err := json.Marshal(WebhookPayload{
+		ID:        id,
+		Type:      string(event),
+		Version:   WebhookPayloadVersion,
+		CreatedAt: now,
+		Data: WebhookData{
+			Transfer:       NewWebhookTransfer(transfer),
+			PreviousStatus: string(e.PreviousStatus),
+			CorrelationID:  e.CorrelationID,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, endpoint := range d.endpoints {
+		if !subscribed(endpoint, event) {
+			continue
+		}
+		key := deliveryKey(id, endpoint.ID)
+		if _, exists := d.deliveries[key]; exists {
+			// The same hook event fired again; it is already queued or sent.
+			continue
+		}
+		delivery := &webhookDelivery{
+			WebhookDelivery: WebhookDelivery{
+				ID:            id,
+				EndpointID:    endpoint.ID,
+				URL:           endpoint.URL,
+				Event:         event,
+				TransferID:    transfer.ID,
+				State:         WebhookPending,
+				CreatedAt:     now,
+				NextAttemptAt: now,
+				Payload:       body,
+			},
+			secret: endpoint.Secret,
+		}
+		d.deliveries[key] = delivery
+		d.order = append(d.order, key)
+	}
+	return nil
+}
+
+// Run delivers due events until ctx is cancelled, polling every
+// PollInterval.
+func (d *WebhookDispatcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+	for {
+		// Failures stay pending and are retried once their backoff elapses.
+		_, _ = d.DeliverPending(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverPending attempts every pending delivery that is due, up to
+// Concurrency at a time, and returns how many were delivered.
+func (d *WebhookDispatcher) DeliverPending(ctx context.Context) (int, error) {
+	now := time.Now()
+	d.mu.Lock()
+	var due []*webhookDelivery
+	for _, key := range d.order {
+		delivery := d.deliveries[key]
+		if delivery.State == WebhookPending && !delivery.inFlight && !delivery.NextAttemptAt.After(now) {
+			delivery.inFlight = true
+			due = append(due, delivery)
+		}
+	}
+	d.mu.Unlock()
+
+	var (
+		wg        sync.WaitGroup
+		delivered int
+		countMu   sync.Mutex
+		slots     = make(chan struct{}, d.concurrency)
+	)
+	for _, delivery := range due {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(delivery *webhookDelivery) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if d.attempt(ctx, delivery) {
+				countMu.Lock()
+				delivered++
+				countMu.Unlock()
+			}
+		}(delivery)
+	}
+	wg.Wait()
+	d.prune()
+	return delivered, ctx.Err()
+}
+
+// attempt sends a delivery once and records the outcome. Reports whether it
+// was delivered.
+func (d *WebhookDispatcher) attempt(ctx context.Context, delivery *webhookDelivery) bool {
+	code, err := d.send(ctx, delivery)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delivery.inFlight = false
+	if ctx.Err() != nil {
+		// Shutting down: leave the delivery for the next run.
+		return false
+	}
+	delivery.Attempts++
+	delivery.LastStatusCode = code
+	if err == nil {
+		now := time.Now()
+		delivery.State = WebhookDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		return true
+	}
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.maxAttempts {
+		now := time.Now()
+		delivery.State = WebhookDead
+		delivery.DeadAt = &now
+		return false
+	}
+	backoff := d.initialBackoff << (delivery.Attempts - 1)
+	if backoff <= 0 || backoff > d.maxBackoff {
+		backoff = d.maxBackoff
+	}
+	delivery.NextAttemptAt = time.Now().Add(backoff)
+	return false
+}
+
+// send makes one signed request and returns the HTTP status code.
+func (d *WebhookDispatcher) send(ctx context.Context, delivery *webhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIDHeader, delivery.ID)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+signWebhook(delivery.secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Deliveries returns the deliveries matching filter, oldest first.
+func (d *WebhookDispatcher) Deliveries(filter WebhookDeliveryFilter) []WebhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var result []WebhookDelivery
+	for _, key := range d.order {
+		delivery := d.deliveries[key]
+		if (filter.EndpointID != "" && delivery.EndpointID != filter.EndpointID) ||
+			(filter.TransferID != "" && delivery.TransferID != filter.TransferID) ||
+			(filter.State != "" && delivery.State != filter.State) {
+			continue
+		}
+		result = append(result, delivery.WebhookDelivery)
+	}
+	return result
+}
+
+// Redeliver queues a dead-lettered or delivered event for another round of
+// attempts to the endpoint, with the same payload and ID.
+func (d *WebhookDispatcher) Redeliver(deliveryID, endpointID string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delivery, ok := d.deliveries[deliveryKey(deliveryID, endpointID)]
+	if !ok {
+		return errors.NewAnchorError(errors.DELIVERY_NOT_FOUND, "webhook delivery not found: "+deliveryID, nil)
+	}
+	if delivery.State == WebhookPending {
+		return nil
+	}
+	delivery.State = WebhookPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	delivery.DeliveredAt = nil
+	delivery.DeadAt = nil
+	return nil
+}
+
+// prune drops the oldest delivered events beyond the retention limit and
+// dead-lettered events older than DeadRetention. Pending events are kept.
+func (d *WebhookDispatcher) prune() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	deadBefore := time.Now().Add(-d.deadRetention)
+	delivered := 0
+	for _, key := range d.order {
+		if d.deliveries[key].State == WebhookDelivered {
+			delivered++
+		}
+	}
+	excess := delivered - d.retention
+	kept := d.order[:0]
+	for _, key := range d.order {
+		delivery := d.deliveries[key]
+		expired := delivery.State == WebhookDead && delivery.DeadAt != nil && delivery.DeadAt.Before(deadBefore)
+		if expired || (excess > 0 && delivery.State == WebhookDelivered) {
+			if !expired {
+				excess--
+			}
+			delete(d.deliveries, key)
+			continue
+		}
+		kept = append(kept, key)
+	}
+	clear(d.order[len(kept):])
+	d.order = kept
+}
+
+func subscribed(endpoint *WebhookEndpoint, event HookEvent) bool {
+	for _, e := range endpoint.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookDeliveryID derives the payload ID from the change that fired the
+// hook: its correlation ID, the event, and the transfer version it produced.
+// Firing the same hook event again yields the same ID.
+func webhookDeliveryID(e *HookEnvelope) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%d", e.CorrelationID, e.Event, e.Transfer.ID, e.Transfer.Version)
+	return "whd_" + hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+func deliveryKey(deliveryID, endpointID string) string {
+	return deliveryID + "/" + endpointID
+}
+
+// signWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>".
+func signWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/anchor"
+	"github.com/marwen-abid/anchor-sdk-go/anchor/admin"
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+)
+
+const defaultPageSize = 50
+
+// list prints transfers matching the filters, newest first.
+func (c *cli) list(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	status := flags.String("status", "", "only transfers in this status")
+	kind := flags.String("kind", "", "deposit, withdrawal, or receive")
+	account := flags.String("account", "", "only transfers of this Stellar account")
+	asset := flags.String("asset", "", "only transfers of this asset code")
+	after := flags.String("after", "", "created at or after (RFC 3339 or YYYY-MM-DD)")
+	before := flags.String("before", "", "created before (RFC 3339 or YYYY-MM-DD)")
+	search := flags.String("q", "", "substring of the ID, account, external reference, transaction hash, or memo")
+	limit := flags.Int("limit", defaultPageSize, "maximum number of transfers")
+	offset := flags.Int("offset", 0, "number of transfers to skip")
+	if _, err := parseFlags(flags, args, 0, 0); err != nil {
+		return err
+	}
+	if *limit <= 0 || *offset < 0 {
+		return usagef("list: invalid limit or offset")
+	}
+
+	filters := stellarconnect.TransferFilters{Account: *account, AssetCode: *asset}
+	if *status != "" {
+		s := stellarconnect.TransferStatus(*status)
+		filters.Status = &s
+	}
+	if *kind != "" {
+		k := stellarconnect.TransferKind(*kind)
+		filters.Kind = &k
+	}
+	var err error
+	if filters.CreatedAfter, err = admin.ParseTime(*after); err != nil {
+		return usagef("list: invalid -after: %v", err)
+	}
+	if filters.CreatedBefore, err = admin.ParseTime(*before); err != nil {
+		return usagef("list: invalid -before: %v", err)
+	}
+
+	transfers, err := c.store.List(ctx, filters)
+	if err != nil {
+		return errors.NewAnchorError(errors.STORE_ERROR, "failed to list transfers", err)
+	}
+	transfers = admin.Search(transfers, *search)
+
+	total := len(transfers)
+	page := transfers[min(*offset, total):min(*offset+*limit, total)]
+	views := make([]admin.TransferView, len(page))
+	for i, t := range page {
+		views[i] = admin.NewTransferView(t)
+	}
+	return c.print(map[string]any{
+		"transfers": views,
+		"total":     total,
+		"limit":     *limit,
+		"offset":    *offset,
+	})
+}
+
+// get prints a transfer with whatever history, notes, and events the store
+// keeps.
+func (c *cli) get(ctx context.Context, args []string) error {
+	positional, err := parseFlags(flag.NewFlagSet("get", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	transfer, err := c.load(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+
+	response := map[string]any{"transfer": admin.NewTransferView(transfer)}
+	if history, err := c.tm.History(ctx, transfer.ID); err == nil {
+		response["history"] = admin.NewHistoryViews(history)
+	}
+	if notes, ok := c.store.(stellarconnect.NoteStore); ok {
+		if list, err := notes.Notes(ctx, transfer.ID); err == nil {
+			response["notes"] = admin.NewNoteViews(list)
+		}
+	}
+	if outbox, ok := c.store.(stellarconnect.OutboxStore); ok {
+		if events, err := outbox.ListEvents(ctx, transfer.ID); err == nil {
+			response["events"] = newEventViews(events)
+		}
+	}
+	return c.print(response)
+}
+
+// history prints a transfer's audit trail.
+func (c *cli) history(ctx context.Context, args []string) error {
+	positional, err := parseFlags(flag.NewFlagSet("history", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	transfer, err := c.load(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	history, err := c.tm.History(ctx, transfer.ID)
+	if err != nil {
+		return err
+	}
+	return c.print(map[string]any{"history": admin.NewHistoryViews(history)})
+}
+
+// transition moves a transfer to a new status through the state machine.
+// With -dry-run the transition is only validated.
+func (c *cli) transition(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("transition", flag.ContinueOnError)
+	reason := flags.String("reason", "", "status message recorded on the transfer")
+	dryRun := flags.Bool("dry-run", false, "validate the transition without applying it")
+	positional, err := parseFlags(flags, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	transfer, err := c.load(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	next := stellarconnect.TransferStatus(positional[1])
+	if err := anchor.ValidateTransition(transfer.Status, next); err != nil {
+		return err
+	}
+	if *dryRun {
+		return c.print(map[string]any{
+			"transfer_id": transfer.ID,
+			"from":        transfer.Status,
+			"to":          next,
+			"valid":       true,
+		})
+	}
+
+	if err := c.tm.Transition(c.actorContext(ctx), transfer.ID, next, *reason); err != nil {
+		return err
+	}
+	updated, err := c.load(ctx, transfer.ID)
+	if err != nil {
+		return err
+	}
+	return c.print(map[string]any{"transfer": admin.NewTransferView(updated)})
+}
+
+// events prints a transfer's outbox events.
+func (c *cli) events(ctx context.Context, args []string) error {
+	positional, err := parseFlags(flag.NewFlagSet("events", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	outbox, err := c.outbox()
+	if err != nil {
+		return err
+	}
+	transfer, err := c.load(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	events, err := outbox.ListEvents(ctx, transfer.ID)
+	if err != nil {
+		return errors.NewAnchorError(errors.STORE_ERROR, "failed to list events", err)
+	}
+	return c.print(map[string]any{"events": newEventViews(events)})
+}
+
+// replay appends hook events for a transfer to the outbox, from where the
+// anchor's OutboxDispatcher delivers them again. The events carry the
+// transfer as it is now. Replaying counts as an update of the transfer, so
+// its version is bumped.
+func (c *cli) replay(ctx context.Context, args []string) error {
+	positional, err := parseFlags(flag.NewFlagSet("replay", flag.ContinueOnError), args, 1, -1)
+	if err != nil {
+		return err
+	}
+	outbox, err := c.outbox()
+	if err != nil {
+		return err
+	}
+	names := positional[1:]
+	if len(names) == 0 {
+		names = []string{string(anchor.HookTransferStatusChanged)}
+	}
+	var events []stellarconnect.OutboxEvent
+	for _, name := range names {
+		if !knownHook(name) {
+			return usagef("replay: unknown hook event %q", name)
+		}
+		events = append(events, stellarconnect.OutboxEvent{Event: name})
+	}
+
+	transfer, err := c.load(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	if err := outbox.UpdateWithEvents(ctx, transfer.ID, transfer.Version, &stellarconnect.TransferUpdate{}, events); err != nil {
+		if stellarconnect.IsVersionConflict(err) {
+			return errors.NewAnchorError(errors.VERSION_CONFLICT, "transfer was modified concurrently; retry", err)
+		}
+		return errors.NewAnchorError(errors.STORE_ERROR, "failed to enqueue events", err)
+	}
+	all, err := outbox.ListEvents(ctx, transfer.ID)
+	if err != nil {
+		return errors.NewAnchorError(errors.STORE_ERROR, "failed to list events", err)
+	}
+	return c.print(map[string]any{"events": newEventViews(all[max(len(all)-len(events), 0):])})
+}
+
+// fsm prints the statuses of the transfer state machine with their legal
+// next statuses, or those of a single status.
+func (c *cli) fsm(args []string) error {
+	positional, err := parseFlags(flag.NewFlagSet("fsm", flag.ContinueOnError), args, 0, 1)
+	if err != nil {
+		return err
+	}
+	statuses := anchor.Statuses()
+	if len(positional) == 1 {
+		status := stellarconnect.TransferStatus(positional[0])
+		if !containsStatus(statuses, status) {
+			return errors.NewAnchorError(errors.TRANSITION_INVALID, "unknown status: "+positional[0], nil)
+		}
+		return c.print(newStatusView(status))
+	}
+	views := make([]statusView, len(statuses))
+	for i, status := range statuses {
+		views[i] = newStatusView(status)
+	}
+	return c.print(map[string]any{"statuses": views})
+}
+
+// load finds a transfer, returning a TRANSFER_NOT_FOUND error if it does
+// not exist.
+func (c *cli) load(ctx context.Context, id string) (*stellarconnect.Transfer, error) {
+	transfer, err := c.store.FindByID(ctx, id)
+	if err != nil || transfer == nil {
+		return nil, errors.NewAnchorError(errors.TRANSFER_NOT_FOUND, "transfer not found: "+id, err)
+	}
+	return transfer, nil
+}
+
+// outbox returns the store's outbox, or a CONFIG_INVALID error if it has
+// none.
+func (c *cli) outbox() (stellarconnect.OutboxStore, error) {
+	outbox, ok := c.store.(stellarconnect.OutboxStore)
+	if !ok {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "store does not keep outbox events", nil)
+	}
+	return outbox, nil
+}
+
+func knownHook(name string) bool {
+	for _, hook := range anchor.HookEvents() {
+		if string(hook) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsStatus(statuses []stellarconnect.TransferStatus, status stellarconnect.TransferStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+)
+
+// decode prints the content of a challenge or payment transaction envelope.
+func (c *cli) decode(args []string) error {
+	if len(args) == 0 {
+		return usagef("decode: expected challenge or payment")
+	}
+	kind := args[0]
+	if kind != "challenge" && kind != "payment" {
+		return usagef("decode: unknown kind %q", kind)
+	}
+
+	flags := flag.NewFlagSet("decode "+kind, flag.ContinueOnError)
+	networkName := flags.String("network", "testnet", "testnet, public, or a network passphrase")
+	positional, err := parseFlags(flags, args[1:], 1, 1)
+	if err != nil {
+		return err
+	}
+	passphrase := networkPassphrase(*networkName)
+	envelope, err := c.readEnvelope(positional[0])
+	if err != nil {
+		return err
+	}
+
+	parsed, err := txnbuild.TransactionFromXDR(envelope)
+	if err != nil {
+		return errors.NewAnchorError(errors.CONFIG_INVALID, "failed to parse transaction XDR", err)
+	}
+	if kind == "challenge" {
+		return c.decodeChallenge(parsed, passphrase)
+	}
+	return c.decodePayment(parsed, passphrase)
+}
+
+// decodeChallenge prints a SEP-10 challenge: the server and client accounts,
+// the home and web auth domains, the validity window, and which of the two
+// accounts' master keys signed it. It does not check the nonce or the
+// client account's other signers.
+func (c *cli) decodeChallenge(parsed *txnbuild.GenericTransaction, passphrase string) error {
+	tx, ok := parsed.Transaction()
+	if !ok {
+		return errors.NewAnchorError(errors.CHALLENGE_INVALID, "challenge transaction must not be fee bump", nil)
+	}
+	operations := tx.Operations()
+	first, ok := firstManageData(operations)
+	if !ok {
+		return errors.NewAnchorError(errors.CHALLENGE_INVALID, "first operation must be manage_data", nil)
+	}
+
+	server := tx.SourceAccount().AccountID
+	response := map[string]any{
+		"server_account":  server,
+		"client_account":  first.SourceAccount,
+		"home_domain":     strings.TrimSuffix(first.Name, " auth"),
+		"nonce":           string(first.Value),
+		"sequence_number": tx.SequenceNumber(),
+		"operations":      operationViews(operations),
+	}
+	for _, op := range operations[1:] {
+		if data, ok := op.(*txnbuild.ManageData); ok && data.Name == "web_auth_domain" {
+			response["web_auth_domain"] = string(data.Value)
+		}
+	}
+	addTimeBounds(response, tx.Timebounds())
+
+	signatures, hash, err := signatureViews(tx, passphrase, server, first.SourceAccount)
+	if err != nil {
+		return err
+	}
+	response["hash"] = hash
+	response["signatures"] = signatures
+	return c.print(response)
+}
+
+// decodePayment prints a transaction's memo, fee, and payment-like
+// operations. Muxed destinations are split into their account and mux ID,
+// which is what the anchor matches withdrawals by.
+func (c *cli) decodePayment(parsed *txnbuild.GenericTransaction, passphrase string) error {
+	response := map[string]any{}
+	tx, ok := parsed.Transaction()
+	if feeBump, isFeeBump := parsed.FeeBump(); isFeeBump {
+		hash, err := feeBump.HashHex(passphrase)
+		if err != nil {
+			return errors.NewAnchorError(errors.CONFIG_INVALID, "failed to hash transaction", err)
+		}
+		response["fee_bump"] = map[string]any{
+			"hash":        hash,
+			"fee_account": feeBump.FeeAccount(),
+			"max_fee":     feeBump.MaxFee(),
+		}
+		tx, ok = feeBump.InnerTransaction(), true
+	}
+	if !ok {
+		return errors.NewAnchorError(errors.CONFIG_INVALID, "unsupported transaction envelope", nil)
+	}
+
+	source := tx.SourceAccount().AccountID
+	memoType, memo := memoView(tx.Memo())
+	response["source_account"] = source
+	response["sequence_number"] = tx.SequenceNumber()
+	response["max_fee"] = tx.MaxFee()
+	response["memo_type"] = memoType
+	if memo != "" {
+		response["memo"] = memo
+	}
+	addTimeBounds(response, tx.Timebounds())
+
+	signers := []string{source}
+	operations := make([]map[string]any, len(tx.Operations()))
+	for i, op := range tx.Operations() {
+		operations[i] = operationView(op)
+		if opSource := op.GetSourceAccount(); opSource != "" {
+			signers = append(signers, opSource)
+		}
+	}
+	response["operations"] = operations
+
+	signatures, hash, err := signatureViews(tx, passphrase, signers...)
+	if err != nil {
+		return err
+	}
+	response["hash"] = hash
+	response["signatures"] = signatures
+	return c.print(response)
+}
+
+// readEnvelope returns the envelope given as an argument, or read from
+// standard input if the argument is "-".
+func (c *cli) readEnvelope(arg string) (string, error) {
+	if arg != "-" {
+		return strings.TrimSpace(arg), nil
+	}
+	raw, err := io.ReadAll(c.stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read standard input: %w", err)
+	}
+	return strings.TrimSpace(string(raw)), nil
+}
+
+// networkPassphrase resolves a network name; anything else is taken as a
+// passphrase.
+func networkPassphrase(name string) string {
+	switch name {
+	case "testnet", "test":
+		return network.TestNetworkPassphrase
+	case "public", "pubnet", "mainnet":
+		return network.PublicNetworkPassphrase
+	default:
+		return name
+	}
+}
+
+func firstManageData(operations []txnbuild.Operation) (*txnbuild.ManageData, bool) {
+	if len(operations) == 0 {
+		return nil, false
+	}
+	op, ok := operations[0].(*txnbuild.ManageData)
+	return op, ok
+}
+
+func operationViews(operations []txnbuild.Operation) []map[string]any {
+	views := make([]map[string]any, len(operations))
+	for i, op := range operations {
+		views[i] = operationView(op)
+	}
+	return views
+}
+
+// operationView describes the operations anchors deal with; others are
+// reported by type only.
+func operationView(op txnbuild.Operation) map[string]any {
+	view := map[string]any{}
+	if source := op.GetSourceAccount(); source != "" {
+		view["source_account"] = source
+	}
+	switch o := op.(type) {
+	case *txnbuild.Payment:
+		view["type"] = "payment"
+		view["amount"] = o.Amount
+		addAsset(view, "asset", o.Asset)
+		addDestination(view, o.Destination)
+	case *txnbuild.PathPaymentStrictReceive:
+		view["type"] = "path_payment_strict_receive"
+		view["amount"] = o.DestAmount
+		view["send_max"] = o.SendMax
+		addAsset(view, "asset", o.DestAsset)
+		addAsset(view, "send_asset", o.SendAsset)
+		addDestination(view, o.Destination)
+	case *txnbuild.PathPaymentStrictSend:
+		view["type"] = "path_payment_strict_send"
+		view["send_amount"] = o.SendAmount
+		view["dest_min"] = o.DestMin
+		addAsset(view, "asset", o.DestAsset)
+		addAsset(view, "send_asset", o.SendAsset)
+		addDestination(view, o.Destination)
+	case *txnbuild.CreateClaimableBalance:
+		view["type"] = "create_claimable_balance"
+		view["amount"] = o.Amount
+		addAsset(view, "asset", o.Asset)
+		claimants := make([]string, len(o.Destinations))
+		for i, claimant := range o.Destinations {
+			claimants[i] = claimant.Destination
+		}
+		view["claimants"] = claimants
+	case *txnbuild.CreateAccount:
+		view["type"] = "create_account"
+		view["amount"] = o.Amount
+		view["destination"] = o.Destination
+	case *txnbuild.ManageData:
+		view["type"] = "manage_data"
+		view["name"] = o.Name
+		view["value"] = string(o.Value)
+	default:
+		view["type"] = strings.TrimPrefix(fmt.Sprintf("%T", op), "*txnbuild.")
+	}
+	return view
+}
+
+// addAsset sets key to the asset as CODE:ISSUER, or "native".
+func addAsset(view map[string]any, key string, asset txnbuild.Asset) {
+	if asset == nil || asset.IsNative() {
+		view[key] = "native"
+		return
+	}
+	view[key] = asset.GetCode() + ":" + asset.GetIssuer()
+}
+
+// addDestination sets the destination and, for muxed addresses, its
+// account and mux ID.
+func addDestination(view map[string]any, destination string) {
+	view["destination"] = destination
+	if !strings.HasPrefix(destination, "M") {
+		return
+	}
+	muxed, err := xdr.AddressToMuxedAccount(destination)
+	if err != nil {
+		return
+	}
+	accountID := muxed.ToAccountId()
+	view["destination_account"] = accountID.Address()
+	if id, err := muxed.GetId(); err == nil {
+		view["mux_id"] = id
+	}
+}
+
+// memoView returns the memo type and value in the form transfers record
+// them, with hash memos in hex.
+func memoView(memo txnbuild.Memo) (string, string) {
+	switch m := memo.(type) {
+	case txnbuild.MemoText:
+		return "text", string(m)
+	case txnbuild.MemoID:
+		return "id", fmt.Sprintf("%d", uint64(m))
+	case txnbuild.MemoHash:
+		return "hash", hex.EncodeToString(m[:])
+	case txnbuild.MemoReturn:
+		return "return", hex.EncodeToString(m[:])
+	default:
+		return "none", ""
+	}
+}
+
+func addTimeBounds(view map[string]any, bounds txnbuild.TimeBounds) {
+	if bounds.MinTime > 0 {
+		view["valid_after"] = time.Unix(bounds.MinTime, 0).UTC()
+	}
+	if bounds.MaxTime > 0 {
+		view["valid_before"] = time.Unix(bounds.MaxTime, 0).UTC()
+	}
+}
+
+type signatureView struct {
+	Hint      string `json:"hint"`
+	Signature string `json:"signature"`
+	Signer    string `json:"signer,omitempty"` // Candidate key whose signature verified
+}
+
+// signatureViews returns the transaction hash and its signatures, each
+// attributed to the first candidate key that verifies it. Candidates that are
+// not G-addresses, such as muxed accounts, are tried as their base account.
+func signatureViews(tx *txnbuild.Transaction, passphrase string, candidates ...string) ([]signatureView, string, error) {
+	hash, err := tx.Hash(passphrase)
+	if err != nil {
+		return nil, "", errors.NewAnchorError(errors.CONFIG_INVALID, "failed to hash transaction", err)
+	}
+
+	var keys []keypair.KP
+	for _, candidate := range candidates {
+		if muxed, err := xdr.AddressToMuxedAccount(candidate); err == nil {
+			accountID := muxed.ToAccountId()
+			candidate = accountID.Address()
+		}
+		if kp, err := keypair.ParseAddress(candidate); err == nil {
+			keys = append(keys, kp)
+		}
+	}
+
+	views := make([]signatureView, len(tx.Signatures()))
+	for i, sig := range tx.Signatures() {
+		views[i] = signatureView{
+			Hint:      hex.EncodeToString(sig.Hint[:]),
+			Signature: base64.StdEncoding.EncodeToString(sig.Signature),
+		}
+		for _, kp := range keys {
+			hint := kp.Hint()
+			if bytes.Equal(hint[:], sig.Hint[:]) && kp.Verify(hash[:], sig.Signature) == nil {
+				views[i].Signer = kp.Address()
+				break
+			}
+		}
+	}
+	return views, hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,221 @@
+// Command anchorctl inspects and operates on an anchor's transfers from the
+// command line, against the same store the anchor uses.
+//
+// Usage:
+//
+//	anchorctl [-store file:DIR] [-operator NAME] <command> [flags] [args]
+//
+// Commands:
+//
+//	list                       list transfers, newest first
+//	get <id>                   transfer with its history, notes, and events
+//	history <id>               audit trail
+//	transition <id> <status>   move a transfer to a status the FSM allows
+//	events <id>                outbox events of a transfer
+//	replay <id> [event...]     enqueue hook events for redelivery
+//	decode challenge <xdr>     decode a SEP-10 challenge transaction
+//	decode payment <xdr>       decode a payment transaction
+//	fsm [status]               legal transitions of the transfer FSM
+//
+// Every command writes JSON to standard output. Errors are written to
+// standard error as {"error": "...", "code": "..."} with exit status 1;
+// usage errors exit with status 2.
+//
+// The store is given by -store or the ANCHORCTL_STORE environment variable.
+// Transitions and replays are written to the store's outbox, so a running
+// anchor with Config.Outbox enabled delivers their hooks through its
+// OutboxDispatcher.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/anchor"
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+	"github.com/marwen-abid/anchor-sdk-go/store/file"
+)
+
+// usageError is returned for invalid command lines.
+type usageError struct {
+	message string
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+func usagef(format string, args ...any) error {
+	return &usageError{message: fmt.Sprintf(format, args...)}
+}
+
+// cli holds the state shared by commands.
+type cli struct {
+	storeSpec string
+	operator  string
+	stdin     io.Reader
+	stdout    io.Writer
+
+	store stellarconnect.TransferStore
+	tm    *anchor.TransferManager
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c := &cli{stdin: os.Stdin, stdout: os.Stdout}
+	err := c.run(ctx, os.Args[1:])
+	if err == nil {
+		return
+	}
+
+	if usage, ok := err.(*usageError); ok {
+		fmt.Fprintf(os.Stderr, "anchorctl: %s\nRun 'anchorctl help' for usage.\n", usage.message)
+		os.Exit(2)
+	}
+	body := map[string]string{"error": err.Error()}
+	var sdkErr *errors.StellarConnectError
+	if errors.As(err, &sdkErr) {
+		body = map[string]string{"error": sdkErr.Message, "code": string(sdkErr.Code)}
+		if sdkErr.Cause != nil {
+			body["cause"] = sdkErr.Cause.Error()
+		}
+	}
+	json.NewEncoder(os.Stderr).Encode(body)
+	os.Exit(1)
+}
+
+// run parses the global flags and dispatches to a command.
+func (c *cli) run(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("anchorctl", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&c.storeSpec, "store", os.Getenv("ANCHORCTL_STORE"), "transfer store, e.g. file:/var/lib/anchor")
+	flags.StringVar(&c.operator, "operator", os.Getenv("USER"), "operator recorded as the actor of changes")
+	if err := flags.Parse(args); err != nil {
+		return usagef("%v", err)
+	}
+	if flags.NArg() == 0 {
+		return usagef("no command given")
+	}
+
+	command, rest := flags.Arg(0), flags.Args()[1:]
+	switch command {
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(c.stdout, usageText)
+		return nil
+	case "fsm":
+		return c.fsm(rest)
+	case "decode":
+		return c.decode(rest)
+	}
+
+	if err := c.open(); err != nil {
+		return err
+	}
+	switch command {
+	case "list":
+		return c.list(ctx, rest)
+	case "get":
+		return c.get(ctx, rest)
+	case "history":
+		return c.history(ctx, rest)
+	case "transition":
+		return c.transition(ctx, rest)
+	case "events":
+		return c.events(ctx, rest)
+	case "replay":
+		return c.replay(ctx, rest)
+	default:
+		return usagef("unknown command %q", command)
+	}
+}
+
+// open connects to the store named by -store. A spec is "<kind>:<location>";
+// a bare path is a file store.
+func (c *cli) open() error {
+	if c.storeSpec == "" {
+		return usagef("no store given; set -store or ANCHORCTL_STORE")
+	}
+	kind, location, found := strings.Cut(c.storeSpec, ":")
+	if !found {
+		kind, location = "file", c.storeSpec
+	}
+	switch kind {
+	case "file":
+		store, err := file.NewTransferStore(location)
+		if err != nil {
+			return errors.NewAnchorError(errors.STORE_ERROR, "failed to open file store", err)
+		}
+		c.store = store
+	default:
+		return usagef("unsupported store %q (supported: file)", kind)
+	}
+	c.tm = anchor.NewTransferManager(c.store, anchor.Config{Outbox: true}, nil)
+	return nil
+}
+
+// actorContext attributes changes made by a command to the operator.
+func (c *cli) actorContext(ctx context.Context) context.Context {
+	return anchor.WithActor(ctx, stellarconnect.Actor{Type: stellarconnect.ActorOperator, ID: c.operator})
+}
+
+// print writes v as indented JSON.
+func (c *cli) print(v any) error {
+	encoder := json.NewEncoder(c.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// parseFlags parses a command's flags, which may appear before or between
+// its positional arguments, and checks the number of arguments.
+func parseFlags(flags *flag.FlagSet, args []string, minArgs, maxArgs int) ([]string, error) {
+	flags.SetOutput(io.Discard)
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, usagef("%s: %v", flags.Name(), err)
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) < minArgs || (maxArgs >= 0 && len(positional) > maxArgs) {
+		return nil, usagef("%s: wrong number of arguments", flags.Name())
+	}
+	return positional, nil
+}
+
+const usageText = `Usage: anchorctl [-store file:DIR] [-operator NAME] <command> [flags] [args]
+
+Commands:
+  list [-status S] [-kind K] [-account A] [-asset C] [-after T] [-before T]
+       [-q TEXT] [-limit N] [-offset N]
+                             list transfers, newest first
+  get <id>                   transfer with its history, notes, and events
+  history <id>               audit trail of a transfer
+  transition <id> <status> [-reason TEXT] [-dry-run]
+                             move a transfer to a status the FSM allows
+  events <id>                outbox events of a transfer
+  replay <id> [event...]     enqueue hook events for redelivery
+                             (default: transfer:status_changed)
+  decode challenge [-network N] <xdr|->
+                             decode a SEP-10 challenge transaction
+  decode payment [-network N] <xdr|->
+                             decode a payment transaction
+  fsm [status]               legal transitions of the transfer FSM
+
+The store is -store or $ANCHORCTL_STORE; the operator defaults to $USER.
+-network is testnet (default), public, or a network passphrase.
+Output is JSON.
+`
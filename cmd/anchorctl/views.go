@@ -0,0 +1,65 @@
+package main
+
+import (
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/anchor"
+)
+
+// Transfers, history, and notes are printed with the admin package's views,
+// so scripts can consume the CLI and the admin API alike.
+
+type eventView struct {
+	ID            string     `json:"id"`
+	Event         string     `json:"event"`
+	TransferID    string     `json:"transfer_id"`
+	Status        string     `json:"status"` // Transfer status in the event's snapshot
+	Version       int64      `json:"version"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	DeadAt        *time.Time `json:"dead_at,omitempty"`
+	Pending       bool       `json:"pending"`
+}
+
+func newEventViews(events []stellarconnect.OutboxEvent) []eventView {
+	views := make([]eventView, len(events))
+	for i, e := range events {
+		views[i] = eventView{
+			ID:          e.ID,
+			Event:       e.Event,
+			TransferID:  e.TransferID,
+			Status:      string(e.Transfer.Status),
+			Version:     e.Transfer.Version,
+			CreatedAt:   e.CreatedAt,
+			Attempts:    e.Attempts,
+			LastError:   e.LastError,
+			DeliveredAt: e.DeliveredAt,
+			DeadAt:      e.DeadAt,
+			Pending:     e.DeliveredAt == nil && e.DeadAt == nil,
+		}
+		if views[i].Pending && !e.NextAttemptAt.IsZero() {
+			next := e.NextAttemptAt
+			views[i].NextAttemptAt = &next
+		}
+	}
+	return views
+}
+
+type statusView struct {
+	Status   string   `json:"status"`
+	Terminal bool     `json:"terminal"`
+	Next     []string `json:"next"`
+}
+
+func newStatusView(status stellarconnect.TransferStatus) statusView {
+	next := anchor.NextStatuses(status)
+	view := statusView{Status: string(status), Terminal: len(next) == 0, Next: make([]string, len(next))}
+	for i, s := range next {
+		view.Next[i] = string(s)
+	}
+	return view
+}
@@ -45,3 +45,49 @@ func (f *HorizonAccountFetcher) FetchSigners(_ context.Context, accountID string
 
 	return signers, thresholds, nil
 }
+
+// FetchAccountInfo returns the sequence number and balances of a Stellar
+// account, or (nil, nil) if it does not exist.
+func (f *HorizonAccountFetcher) FetchAccountInfo(_ context.Context, accountID string) (*stellarconnect.AccountInfo, error) {
+	account, err := f.client.AccountDetail(horizonclient.AccountRequest{
+		AccountID: accountID,
+	})
+	if horizonclient.IsNotFoundError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch account %s: %w", accountID, err)
+	}
+
+	info := &stellarconnect.AccountInfo{
+		AccountID: account.AccountID,
+		Sequence:  account.Sequence,
+		Balances:  make([]stellarconnect.AccountBalance, 0, len(account.Balances)),
+	}
+	for _, b := range account.Balances {
+		switch b.Asset.Type {
+		case "native":
+			info.Balances = append(info.Balances, stellarconnect.AccountBalance{
+				Asset:      "native",
+				Balance:    b.Balance,
+				Authorized: true,
+			})
+		case "liquidity_pool_shares":
+			// Pool shares cannot be paid out.
+		default:
+			info.Balances = append(info.Balances, stellarconnect.AccountBalance{
+				Asset:      b.Asset.Code + ":" + b.Asset.Issuer,
+				Balance:    b.Balance,
+				Limit:      b.Limit,
+				Authorized: b.IsAuthorized != nil && *b.IsAuthorized,
+			})
+		}
+	}
+	return info, nil
+}
+
+// Verify that HorizonAccountFetcher implements both fetcher interfaces.
+var (
+	_ stellarconnect.AccountFetcher     = (*HorizonAccountFetcher)(nil)
+	_ stellarconnect.AccountInfoFetcher = (*HorizonAccountFetcher)(nil)
+)
@@ -0,0 +1,307 @@
+// Package amount provides an exact decimal representation of Stellar asset amounts.
+//
+// Stellar represents amounts on-chain as signed 64-bit integers of stroops,
+// where one whole unit is 10,000,000 stroops (7 decimal places). Amount stores
+// that integer directly, so parsing, arithmetic, and comparison never lose
+// precision and never depend on the textual form of the input ("9" vs "9.0").
+//
+// Example usage:
+//
+//	a, err := amount.Parse("100.5")
+//	if err != nil {
+//	    // Handle malformed amount
+//	}
+//	fee := a.MulBps(20)          // 0.20% fee
+//	net, err := a.Sub(fee)       // 100.2990000
+//	if net.LessThan(amount.MustParse("1")) {
+//	    // Below minimum
+//	}
+package amount
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Decimals is the number of fractional digits supported by Stellar amounts.
+	Decimals = 7
+
+	// StroopsPerUnit is the number of stroops in one whole unit of an asset.
+	StroopsPerUnit = 10_000_000
+
+	// maxIntegerDigits is the number of digits in the integer part of the
+	// largest representable amount (922337203685.4775807).
+	maxIntegerDigits = 12
+)
+
+// Zero is the zero amount.
+var Zero = Amount{}
+
+// Amount is an exact decimal amount with 7 digits of fractional precision,
+// stored as an integer number of stroops. The zero value is a valid zero amount.
+//
+// Amount marshals to and from JSON as a decimal string (e.g. "100.0000000"),
+// matching the representation used by Horizon and the SEP transfer protocols.
+type Amount struct {
+	stroops int64
+}
+
+// FromStroops returns the Amount for the given number of stroops.
+func FromStroops(stroops int64) Amount {
+	return Amount{stroops: stroops}
+}
+
+// Parse parses a decimal string such as "100", "0.5" or "-12.0000001".
+// It rejects exponents, more than 7 fractional digits, and values outside
+// the int64 stroop range.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Zero, fmt.Errorf("amount is empty")
+	}
+
+	negative := false
+	digits := s
+	switch digits[0] {
+	case '-':
+		negative = true
+		digits = digits[1:]
+	case '+':
+		digits = digits[1:]
+	}
+
+	intPart, fracPart, _ := strings.Cut(digits, ".")
+	if intPart == "" && fracPart == "" {
+		return Zero, fmt.Errorf("invalid amount %q", s)
+	}
+	if !isDigits(intPart) || !isDigits(fracPart) {
+		return Zero, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(fracPart) > Decimals {
+		return Zero, fmt.Errorf("amount %q has more than %d decimal places", s, Decimals)
+	}
+
+	intPart = strings.TrimLeft(intPart, "0")
+	if len(intPart) > maxIntegerDigits {
+		return Zero, fmt.Errorf("amount %q out of range", s)
+	}
+
+	raw := intPart + fracPart + strings.Repeat("0", Decimals-len(fracPart))
+	if raw == "" {
+		raw = "0"
+	}
+	if negative {
+		raw = "-" + raw
+	}
+	stroops, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return Zero, fmt.Errorf("amount %q out of range", s)
+	}
+	return Amount{stroops: stroops}, nil
+}
+
+// MustParse is like Parse but panics if the string cannot be parsed.
+// It is intended for constants and tests.
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// Stroops returns the amount as an integer number of stroops.
+func (a Amount) Stroops() int64 {
+	return a.stroops
+}
+
+// String returns the canonical 7-decimal representation (e.g. "100.0000000").
+func (a Amount) String() string {
+	n := a.stroops
+	sign := ""
+	var abs uint64
+	if n < 0 {
+		sign = "-"
+		abs = uint64(-(n + 1)) + 1 // avoids overflow for math.MinInt64
+	} else {
+		abs = uint64(n)
+	}
+	return fmt.Sprintf("%s%d.%07d", sign, abs/StroopsPerUnit, abs%StroopsPerUnit)
+}
+
+// IsZero reports whether the amount is zero.
+func (a Amount) IsZero() bool {
+	return a.stroops == 0
+}
+
+// IsNegative reports whether the amount is less than zero.
+func (a Amount) IsNegative() bool {
+	return a.stroops < 0
+}
+
+// IsPositive reports whether the amount is greater than zero.
+func (a Amount) IsPositive() bool {
+	return a.stroops > 0
+}
+
+// Cmp compares a and b and returns -1, 0, or +1.
+func (a Amount) Cmp(b Amount) int {
+	switch {
+	case a.stroops < b.stroops:
+		return -1
+	case a.stroops > b.stroops:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Equal reports whether a and b represent the same amount.
+func (a Amount) Equal(b Amount) bool {
+	return a.stroops == b.stroops
+}
+
+// LessThan reports whether a < b.
+func (a Amount) LessThan(b Amount) bool {
+	return a.stroops < b.stroops
+}
+
+// GreaterThan reports whether a > b.
+func (a Amount) GreaterThan(b Amount) bool {
+	return a.stroops > b.stroops
+}
+
+// Add returns a + b. It returns an error if the result overflows.
+func (a Amount) Add(b Amount) (Amount, error) {
+	sum := a.stroops + b.stroops
+	if (b.stroops > 0 && sum < a.stroops) || (b.stroops < 0 && sum > a.stroops) {
+		return Zero, fmt.Errorf("amount overflow: %s + %s", a, b)
+	}
+	return Amount{stroops: sum}, nil
+}
+
+// Sub returns a - b. It returns an error if the result overflows.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if b.stroops == math.MinInt64 {
+		return Zero, fmt.Errorf("amount overflow: %s - %s", a, b)
+	}
+	return a.Add(Amount{stroops: -b.stroops})
+}
+
+// Neg returns -a. It returns an error if a is the smallest representable
+// amount, whose negation overflows.
+func (a Amount) Neg() (Amount, error) {
+	if a.stroops == math.MinInt64 {
+		return Zero, fmt.Errorf("amount overflow: -(%s)", a)
+	}
+	return Amount{stroops: -a.stroops}, nil
+}
+
+// MulBps returns a multiplied by the given number of basis points
+// (1 bps = 0.01%), rounded half away from zero to the nearest stroop.
+// It is the building block for percentage fee computation.
+func (a Amount) MulBps(bps int64) Amount {
+	return a.MulRat(big.NewRat(bps, 10_000))
+}
+
+// MulRat returns a multiplied by r, rounded half away from zero to the
+// nearest stroop. Results outside the int64 range are clamped.
+func (a Amount) MulRat(r *big.Rat) Amount {
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(a.stroops), r)
+	num := new(big.Int).Abs(product.Num())
+	den := product.Denom()
+
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Lsh(rem, 1).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if product.Sign() < 0 {
+		q.Neg(q)
+	}
+	if !q.IsInt64() {
+		if q.Sign() < 0 {
+			return Amount{stroops: math.MinInt64}
+		}
+		return Amount{stroops: math.MaxInt64}
+	}
+	return Amount{stroops: q.Int64()}
+}
+
+// Fee computes a fixed-plus-percentage fee on a, where percentBps is the
+// percentage component in basis points. The result is never negative.
+func (a Amount) Fee(fixed Amount, percentBps int64) (Amount, error) {
+	fee, err := a.MulBps(percentBps).Add(fixed)
+	if err != nil {
+		return Zero, err
+	}
+	if fee.IsNegative() {
+		return Zero, nil
+	}
+	return fee, nil
+}
+
+// Min returns the smaller of a and b.
+func Min(a, b Amount) Amount {
+	if a.LessThan(b) {
+		return a
+	}
+	return b
+}
+
+// Max returns the larger of a and b.
+func Max(a, b Amount) Amount {
+	if a.GreaterThan(b) {
+		return a
+	}
+	return b
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (a *Amount) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// MarshalJSON encodes the amount as a JSON string.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON decodes the amount from a JSON string. Bare JSON numbers are
+// rejected because they may already have lost precision in transit. An empty
+// string decodes as Zero, so records that stored an unset amount as "" still
+// load.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("amount must be a JSON string: %w", err)
+	}
+	if s == "" {
+		*a = Zero
+		return nil
+	}
+	return a.UnmarshalText([]byte(s))
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
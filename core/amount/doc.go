@@ -0,0 +1,2 @@
+// Package amount provides a fixed-precision decimal type for Stellar asset amounts.
+package amount
@@ -0,0 +1,6 @@
+// Package submit provides implementations of stellarconnect.TransactionSubmitter.
+//
+// HorizonSubmitter submits transactions through a Horizon server. FakeSubmitter
+// keeps accounts and ledgers in memory and can inject failures, so payout flows
+// can be exercised without a network.
+package submit
@@ -0,0 +1,339 @@
+package submit
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/stellar/go/txnbuild"
+)
+
+// FakeSubmitter is an in-memory stellarconnect.TransactionSubmitter for tests
+// and local development. It tracks account sequence numbers, enforces time
+// bounds, and applies each transaction to a simulated ledger. Signatures and
+// balances are not checked.
+//
+// Failures can be injected with FailNext and LoseNextResponse to exercise
+// rejection and timeout handling, SetMinFee simulates surge pricing, and
+// SetTrustline simulates accounts that cannot receive an issued asset.
+type FakeSubmitter struct {
+	networkPassphrase string
+	sequences         map[string]int64
+	results           map[string]*stellarconnect.SubmitResult // tx hash and inner tx hash -> result
+	envelopes         []string
+	faults            []fakeFault
+	trustlines        map[string]map[string]bool // account -> "CODE:ISSUER" -> trusted, for simulated accounts
+	minFee            int64
+	feeStats          stellarconnect.FeeStats
+	ledger            int32
+	mu                sync.Mutex
+}
+
+// fakeFault is an injected outcome for the next submission.
+type fakeFault struct {
+	err   error
+	apply bool // apply the transaction before returning err
+}
+
+// NewFakeSubmitter creates a FakeSubmitter that hashes transactions with the
+// given network passphrase.
+func NewFakeSubmitter(networkPassphrase string) *FakeSubmitter {
+	return &FakeSubmitter{
+		networkPassphrase: networkPassphrase,
+		sequences:         make(map[string]int64),
+		results:           make(map[string]*stellarconnect.SubmitResult),
+		trustlines:        make(map[string]map[string]bool),
+		minFee:            txnbuild.MinBaseFee,
+		feeStats:          fakeFeeStats(txnbuild.MinBaseFee),
+	}
+}
+
+// fakeFeeStats returns fee stats in which every percentile bids fee.
+func fakeFeeStats(fee int64) stellarconnect.FeeStats {
+	stats := stellarconnect.FeeStats{LastLedgerBaseFee: txnbuild.MinBaseFee, MaxFee: make(map[int]int64)}
+	for _, p := range []int{10, 20, 30, 40, 50, 60, 70, 80, 90, 95, 99} {
+		stats.MaxFee[p] = fee
+	}
+	return stats
+}
+
+// SetSequence creates or updates an account with the given sequence number.
+func (f *FakeSubmitter) SetSequence(accountID string, seq int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sequences[accountID] = seq
+}
+
+// FailNext makes the next submission return err without applying the
+// transaction. Use a *stellarconnect.SubmitError to simulate a rejection and
+// any other error to simulate a network failure. Calls queue up in order.
+func (f *FakeSubmitter) FailNext(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.faults = append(f.faults, fakeFault{err: err})
+}
+
+// LoseNextResponse makes the next submission apply the transaction but return
+// a timeout error, as when Horizon times out after forwarding it to the network.
+func (f *FakeSubmitter) LoseNextResponse() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.faults = append(f.faults, fakeFault{err: context.DeadlineExceeded, apply: true})
+}
+
+// SetTrustline adds or removes an account's trustline for an issued asset,
+// given as "CODE:ISSUER". Once an account has been given a trustline setting,
+// payments of other issued assets to it fail with op_no_trust, consuming the
+// sequence number as on the network; other accounts accept every asset.
+// Trustlines are reported by FetchAccountInfo.
+func (f *FakeSubmitter) SetTrustline(accountID, asset string, trusted bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.trustlines[accountID] == nil {
+		f.trustlines[accountID] = make(map[string]bool)
+	}
+	f.trustlines[accountID][asset] = trusted
+}
+
+// SetMinFee rejects transactions bidding less than fee stroops per operation
+// with tx_insufficient_fee, and reports fee as every fee-stats percentile.
+func (f *FakeSubmitter) SetMinFee(fee int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.minFee = fee
+	f.feeStats = fakeFeeStats(fee)
+}
+
+// SetFeeStats sets the fee stats returned by FeeStats.
+func (f *FakeSubmitter) SetFeeStats(stats stellarconnect.FeeStats) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.feeStats = stats
+}
+
+// FeeStats returns the configured fee stats.
+func (f *FakeSubmitter) FeeStats(ctx context.Context) (*stellarconnect.FeeStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stats := f.feeStats
+	stats.MaxFee = make(map[int]int64, len(f.feeStats.MaxFee))
+	for p, fee := range f.feeStats.MaxFee {
+		stats.MaxFee[p] = fee
+	}
+	return &stats, nil
+}
+
+// Envelopes returns the envelopes applied to the ledger, in order.
+func (f *FakeSubmitter) Envelopes() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.envelopes...)
+}
+
+// SubmitTransaction applies a transaction or fee-bump envelope to the fake
+// ledger. Resubmitting an applied transaction returns its original result.
+func (f *FakeSubmitter) SubmitTransaction(ctx context.Context, envelopeXDR string) (*stellarconnect.SubmitResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	parsed, err := txnbuild.TransactionFromXDR(envelopeXDR)
+	if err != nil {
+		return nil, &stellarconnect.SubmitError{TransactionCode: "tx_malformed", Err: err}
+	}
+	tx, hash, innerHash, baseFee, err := f.unwrap(parsed)
+	if err != nil {
+		return nil, err
+	}
+	applied := fakeTx{tx: tx, hash: hash, innerHash: innerHash, baseFee: baseFee, envelope: envelopeXDR}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.faults) > 0 {
+		fault := f.faults[0]
+		f.faults = f.faults[1:]
+		if !fault.apply {
+			return nil, fault.err
+		}
+		if _, err := f.applyLocked(applied); err != nil {
+			return nil, err
+		}
+		return nil, fault.err
+	}
+	return f.applyLocked(applied)
+}
+
+// fakeTx is a parsed submission.
+type fakeTx struct {
+	tx        *txnbuild.Transaction // transaction whose sequence number is consumed
+	hash      string                // hash of the envelope
+	innerHash string                // hash of tx; equals hash unless fee-bumped
+	baseFee   int64                 // fee bid per operation
+	envelope  string
+}
+
+// applyLocked validates and applies a submission. The caller must hold the lock.
+func (f *FakeSubmitter) applyLocked(sub fakeTx) (*stellarconnect.SubmitResult, error) {
+	if result, ok := f.results[sub.innerHash]; ok {
+		c := *result
+		return &c, nil
+	}
+	tx := sub.tx
+	source := tx.SourceAccount().AccountID
+	current, ok := f.sequences[source]
+	if !ok {
+		return nil, &stellarconnect.SubmitError{TransactionCode: "tx_no_source_account"}
+	}
+	if maxTime := tx.Timebounds().MaxTime; maxTime != 0 && time.Now().Unix() > maxTime {
+		return nil, &stellarconnect.SubmitError{TransactionCode: "tx_too_late"}
+	}
+	if tx.SequenceNumber() != current+1 {
+		return nil, &stellarconnect.SubmitError{TransactionCode: "tx_bad_seq"}
+	}
+	if sub.baseFee < f.minFee {
+		return nil, &stellarconnect.SubmitError{TransactionCode: "tx_insufficient_fee"}
+	}
+
+	f.sequences[source] = tx.SequenceNumber()
+	if codes := f.operationCodesLocked(tx); codes != nil {
+		return nil, &stellarconnect.SubmitError{TransactionCode: "tx_failed", OperationCodes: codes}
+	}
+	f.ledger++
+	result := &stellarconnect.SubmitResult{Hash: sub.hash, Ledger: f.ledger, Successful: true}
+	f.results[sub.hash] = result
+	f.results[sub.innerHash] = result
+	f.envelopes = append(f.envelopes, sub.envelope)
+	c := *result
+	return &c, nil
+}
+
+// operationCodesLocked returns the result codes of tx's operations if any
+// operation fails, or nil. The caller must hold the lock.
+func (f *FakeSubmitter) operationCodesLocked(tx *txnbuild.Transaction) []string {
+	codes := make([]string, len(tx.Operations()))
+	failed := false
+	for i, op := range tx.Operations() {
+		codes[i] = "op_success"
+		payment, ok := op.(*txnbuild.Payment)
+		if !ok || payment.Asset.IsNative() {
+			continue
+		}
+		trustlines, simulated := f.trustlines[payment.Destination]
+		if simulated && !trustlines[payment.Asset.GetCode()+":"+payment.Asset.GetIssuer()] {
+			codes[i] = "op_no_trust"
+			failed = true
+		}
+	}
+	if !failed {
+		return nil
+	}
+	return codes
+}
+
+// unwrap returns the transaction whose sequence number is consumed, the
+// hashes of the envelope and of that transaction, and the fee bid.
+func (f *FakeSubmitter) unwrap(parsed *txnbuild.GenericTransaction) (tx *txnbuild.Transaction, hash, innerHash string, baseFee int64, err error) {
+	if feeBump, ok := parsed.FeeBump(); ok {
+		tx = feeBump.InnerTransaction()
+		if hash, err = feeBump.HashHex(f.networkPassphrase); err != nil {
+			return nil, "", "", 0, fmt.Errorf("failed to hash transaction: %w", err)
+		}
+		if innerHash, err = tx.HashHex(f.networkPassphrase); err != nil {
+			return nil, "", "", 0, fmt.Errorf("failed to hash transaction: %w", err)
+		}
+		return tx, hash, innerHash, feeBump.BaseFee(), nil
+	}
+	tx, ok := parsed.Transaction()
+	if !ok {
+		return nil, "", "", 0, &stellarconnect.SubmitError{TransactionCode: "tx_malformed"}
+	}
+	if hash, err = tx.HashHex(f.networkPassphrase); err != nil {
+		return nil, "", "", 0, fmt.Errorf("failed to hash transaction: %w", err)
+	}
+	return tx, hash, hash, tx.BaseFee(), nil
+}
+
+// TransactionStatus returns the result of an applied transaction, or (nil, nil)
+// if the hash is unknown. A fee-bumped transaction is also found by the hash
+// of its inner transaction, as on Horizon.
+func (f *FakeSubmitter) TransactionStatus(ctx context.Context, hash string) (*stellarconnect.SubmitResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result, ok := f.results[hash]
+	if !ok {
+		return nil, nil
+	}
+	c := *result
+	return &c, nil
+}
+
+// SequenceNumber returns the current sequence number of an account.
+func (f *FakeSubmitter) SequenceNumber(ctx context.Context, accountID string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	seq, ok := f.sequences[accountID]
+	if !ok {
+		return 0, fmt.Errorf("account %s not found", accountID)
+	}
+	return seq, nil
+}
+
+// FetchAccountInfo returns an account's sequence number and the trustlines set
+// with SetTrustline, or (nil, nil) for an unknown account. Balances are not
+// tracked and are reported as zero.
+func (f *FakeSubmitter) FetchAccountInfo(ctx context.Context, accountID string) (*stellarconnect.AccountInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	seq, known := f.sequences[accountID]
+	trustlines, simulated := f.trustlines[accountID]
+	if !known && !simulated {
+		return nil, nil
+	}
+	info := &stellarconnect.AccountInfo{
+		AccountID: accountID,
+		Sequence:  seq,
+		Balances:  []stellarconnect.AccountBalance{{Asset: "native", Balance: "0.0000000", Authorized: true}},
+	}
+	assets := make([]string, 0, len(trustlines))
+	for asset, trusted := range trustlines {
+		if trusted {
+			assets = append(assets, asset)
+		}
+	}
+	sort.Strings(assets)
+	for _, asset := range assets {
+		info.Balances = append(info.Balances, stellarconnect.AccountBalance{
+			Asset:      asset,
+			Balance:    "0.0000000",
+			Limit:      "922337203685.4775807",
+			Authorized: true,
+		})
+	}
+	return info, nil
+}
+
+// Verify that FakeSubmitter implements stellarconnect.TransactionSubmitter
+var _ stellarconnect.TransactionSubmitter = (*FakeSubmitter)(nil)
+
+// Verify that FakeSubmitter implements stellarconnect.FeeStatsSource
+var _ stellarconnect.FeeStatsSource = (*FakeSubmitter)(nil)
+
+// Verify that FakeSubmitter implements stellarconnect.AccountInfoFetcher
+var _ stellarconnect.AccountInfoFetcher = (*FakeSubmitter)(nil)
@@ -0,0 +1,127 @@
+package submit
+
+import (
+	"context"
+	"fmt"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/stellar/go-stellar-sdk/clients/horizonclient"
+)
+
+// feeBumpInnerFailed is the result code of a fee-bump transaction whose inner
+// transaction failed; the inner code carries the reason.
+const feeBumpInnerFailed = "tx_fee_bump_inner_failed"
+
+// HorizonSubmitter implements stellarconnect.TransactionSubmitter using a Horizon server.
+type HorizonSubmitter struct {
+	client *horizonclient.Client
+}
+
+// NewHorizonSubmitter creates a TransactionSubmitter backed by the given Horizon URL.
+func NewHorizonSubmitter(horizonURL string) *HorizonSubmitter {
+	return &HorizonSubmitter{
+		client: &horizonclient.Client{HorizonURL: horizonURL},
+	}
+}
+
+// SubmitTransaction submits a signed envelope and waits for Horizon to report
+// the outcome. Rejections carrying result codes are returned as
+// *stellarconnect.SubmitError; Horizon timeouts and network failures are
+// returned as plain errors because the transaction may still be applied.
+func (s *HorizonSubmitter) SubmitTransaction(ctx context.Context, envelopeXDR string) (*stellarconnect.SubmitResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	tx, err := s.client.SubmitTransactionXDR(envelopeXDR)
+	if err != nil {
+		if submitErr := submitError(err); submitErr != nil {
+			return nil, submitErr
+		}
+		return nil, fmt.Errorf("failed to submit transaction: %w", err)
+	}
+	return &stellarconnect.SubmitResult{
+		Hash:       tx.Hash,
+		Ledger:     tx.Ledger,
+		Successful: tx.Successful,
+	}, nil
+}
+
+// TransactionStatus looks up a transaction by hash.
+// Returns (nil, nil) if Horizon has no record of it.
+func (s *HorizonSubmitter) TransactionStatus(ctx context.Context, hash string) (*stellarconnect.SubmitResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	tx, err := s.client.TransactionDetail(hash)
+	if err != nil {
+		if horizonclient.IsNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to fetch transaction %s: %w", hash, err)
+	}
+	return &stellarconnect.SubmitResult{
+		Hash:       tx.Hash,
+		Ledger:     tx.Ledger,
+		Successful: tx.Successful,
+	}, nil
+}
+
+// SequenceNumber returns the current sequence number of an account.
+func (s *HorizonSubmitter) SequenceNumber(ctx context.Context, accountID string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	account, err := s.client.AccountDetail(horizonclient.AccountRequest{AccountID: accountID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch account %s: %w", accountID, err)
+	}
+	return account.Sequence, nil
+}
+
+// FeeStats returns the fee bids of recent ledgers as reported by Horizon.
+func (s *HorizonSubmitter) FeeStats(ctx context.Context) (*stellarconnect.FeeStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	stats, err := s.client.FeeStats()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch fee stats: %w", err)
+	}
+	d := stats.MaxFee
+	return &stellarconnect.FeeStats{
+		LastLedgerBaseFee:   stats.LastLedgerBaseFee,
+		LedgerCapacityUsage: stats.LedgerCapacityUsage,
+		MaxFee: map[int]int64{
+			10: d.P10, 20: d.P20, 30: d.P30, 40: d.P40, 50: d.P50,
+			60: d.P60, 70: d.P70, 80: d.P80, 90: d.P90, 95: d.P95, 99: d.P99,
+		},
+	}, nil
+}
+
+// submitError converts a Horizon rejection into a *stellarconnect.SubmitError.
+// Returns nil if err carries no result codes.
+func submitError(err error) *stellarconnect.SubmitError {
+	herr := horizonclient.GetError(err)
+	if herr == nil {
+		return nil
+	}
+	codes, codesErr := herr.ResultCodes()
+	if codesErr != nil || codes == nil {
+		return nil
+	}
+	txCode := codes.TransactionCode
+	if txCode == feeBumpInnerFailed && codes.InnerTransactionCode != "" {
+		txCode = codes.InnerTransactionCode
+	}
+	return &stellarconnect.SubmitError{
+		TransactionCode: txCode,
+		OperationCodes:  codes.OperationCodes,
+		Err:             err,
+	}
+}
+
+// Verify that HorizonSubmitter implements stellarconnect.TransactionSubmitter
+var _ stellarconnect.TransactionSubmitter = (*HorizonSubmitter)(nil)
+
+// Verify that HorizonSubmitter implements stellarconnect.FeeStatsSource
+var _ stellarconnect.FeeStatsSource = (*HorizonSubmitter)(nil)
@@ -38,6 +38,20 @@ const (
 	TRANSITION_INVALID        Code = "TRANSITION_INVALID"
 	INTERACTIVE_TOKEN_INVALID Code = "INTERACTIVE_TOKEN_INVALID"
 	PAYMENT_MISMATCH          Code = "PAYMENT_MISMATCH"
+	TRANSFER_NOT_FOUND        Code = "TRANSFER_NOT_FOUND"
+	IDEMPOTENCY_KEY_REUSED    Code = "IDEMPOTENCY_KEY_REUSED"
+	IDEMPOTENCY_IN_PROGRESS   Code = "IDEMPOTENCY_IN_PROGRESS"
+	VERSION_CONFLICT          Code = "VERSION_CONFLICT"
+	LOCK_FAILED               Code = "LOCK_FAILED"
+	PAYOUT_FAILED             Code = "PAYOUT_FAILED"
+	RAIL_ERROR                Code = "RAIL_ERROR"
+	RAIL_WEBHOOK_INVALID      Code = "RAIL_WEBHOOK_INVALID"
+	WEBHOOK_SIGNATURE_INVALID Code = "WEBHOOK_SIGNATURE_INVALID"
+	WEBHOOK_TIMESTAMP_INVALID Code = "WEBHOOK_TIMESTAMP_INVALID"
+	WEBHOOK_PAYLOAD_INVALID   Code = "WEBHOOK_PAYLOAD_INVALID"
+	REVIEW_NOT_FOUND          Code = "REVIEW_NOT_FOUND"
+	OPERATOR_AUTH_FAILED      Code = "OPERATOR_AUTH_FAILED"
+	DELIVERY_NOT_FOUND        Code = "DELIVERY_NOT_FOUND"
 )
 
 // Error codes - Client Layer
@@ -60,6 +74,7 @@ const (
 	STREAM_DISCONNECTED Code = "STREAM_DISCONNECTED"
 	CURSOR_SAVE_FAILED  Code = "CURSOR_SAVE_FAILED"
 	HANDLER_PANIC       Code = "HANDLER_PANIC"
+	HANDLER_TIMEOUT     Code = "HANDLER_TIMEOUT"
 )
 
 // StellarConnectError is the base error type for all SDK errors.
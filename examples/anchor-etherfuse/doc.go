@@ -5,7 +5,7 @@
 //   - SEP-10 Web Authentication with challenge/response flow
 //   - SEP-24 Interactive deposit (MXN -> USDC/CETES via Etherfuse onramp)
 //   - SEP-24 Interactive withdrawal (USDC/CETES -> MXN via Etherfuse offramp)
-//   - Etherfuse webhook processing for order status updates
+//   - Etherfuse as an anchor.RailProvider: orders and webhooks drive transfer status
 //
 // Configuration is loaded from a .env file or environment variables.
 // See .env.example for all available settings.
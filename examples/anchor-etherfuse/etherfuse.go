@@ -151,6 +151,16 @@ func (c *EtherfuseClient) CreateOfframpOrder(ctx context.Context, req OrderReque
 	return resp.Offramp, nil
 }
 
+// GetOrder fetches an order's current state. The response has the same
+// shape as the order_updated webhook payload.
+func (c *EtherfuseClient) GetOrder(ctx context.Context, orderID string) (*OrderUpdatedPayload, error) {
+	var resp OrderUpdatedPayload
+	if err := c.get(ctx, "/ramp/order/"+orderID, &resp); err != nil {
+		return nil, fmt.Errorf("get order: %w", err)
+	}
+	return &resp, nil
+}
+
 // --- KYC Status ---
 
 // KYCStatus from GET /ramp/customer/{id}/kyc/{pubkey}.
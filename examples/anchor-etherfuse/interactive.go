@@ -5,11 +5,12 @@ import (
 	"encoding/json"
 	"html/template"
 	"log"
-	"math/big"
 	"net/http"
+	"strings"
 
 	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
 	"github.com/marwen-abid/anchor-sdk-go/anchor"
+	"github.com/marwen-abid/anchor-sdk-go/core/amount"
 )
 
 //go:embed templates/interactive.html
@@ -20,7 +21,7 @@ type interactivePageData struct {
 	Token           string
 	Kind            string // "deposit" or "withdrawal"
 	Step            string // "onboard", "kyc-pending", "amount", "quote-confirm", "deposit-instructions", "withdrawal-pending", "kyc-rejected", "error"
-	Amount          string
+	Amount          amount.Amount
 	AssetCode       string
 	AvailableAssets []string // asset codes available from Etherfuse
 
@@ -211,12 +212,17 @@ func handlePostQuote(
 			return
 		}
 
-		amount := r.FormValue("amount")
+		rawAmount := strings.TrimSpace(r.FormValue("amount"))
 		assetCode := r.FormValue("asset_code")
-		if amount == "" || assetCode == "" {
+		if rawAmount == "" || assetCode == "" {
 			renderError(w, tmpl, token, transfer, "Amount and asset are required")
 			return
 		}
+		amt, err := amount.Parse(rawAmount)
+		if err != nil || !amt.IsPositive() {
+			renderError(w, tmpl, token, transfer, "Invalid amount: "+rawAmount)
+			return
+		}
 
 		assetID, ok := assetIdentifiers[assetCode]
 		if !ok {
@@ -238,7 +244,7 @@ func handlePostQuote(
 					SourceAsset: "MXN",
 					TargetAsset: assetID,
 				},
-				SourceAmount: amount,
+				SourceAmount: rawAmount,
 			}
 		} else {
 			// Offramp: crypto → MXN
@@ -250,7 +256,7 @@ func handlePostQuote(
 					SourceAsset: assetID,
 					TargetAsset: "MXN",
 				},
-				SourceAmount: amount,
+				SourceAmount: rawAmount,
 			}
 		}
 
@@ -273,7 +279,7 @@ func handlePostQuote(
 
 		// Update transfer amount
 		if err := store.Update(r.Context(), transfer.ID, &stellarconnect.TransferUpdate{
-			Amount: &amount,
+			Amount: &amt,
 		}); err != nil {
 			log.Printf("Failed to update transfer amount: %v", err)
 		}
@@ -303,12 +309,12 @@ func handlePostQuote(
 	}
 }
 
-// handlePostOrder creates the Etherfuse order, consumes the token, and completes
-// the interactive flow. This is the terminal step.
+// handlePostOrder creates the Etherfuse order through the rail adapter, which
+// records it on the transfer and completes the interactive flow, then
+// consumes the token. This is the terminal step.
 func handlePostOrder(
 	tm *anchor.TransferManager,
-	ef *EtherfuseClient,
-	store stellarconnect.TransferStore,
+	rail *anchor.RailAdapter,
 ) http.HandlerFunc {
 	tmpl := template.Must(template.ParseFS(interactiveTemplate, "templates/interactive.html"))
 
@@ -337,84 +343,39 @@ func handlePostOrder(
 			return
 		}
 
-		bankAccountID := DeterministicBankAccountID(transfer.Account)
-		orderID := DeterministicOrderID(transfer.ID)
-
-		orderReq := OrderRequest{
-			OrderID:       orderID,
-			BankAccountID: bankAccountID,
-			PublicKey:     transfer.Account,
-			QuoteID:       quoteID,
-		}
-
 		ctx := r.Context()
+		req := anchor.RailOrderRequest{QuoteID: quoteID}
 		data := interactivePageData{
 			Token:     token,
 			Kind:      string(transfer.Kind),
 			AssetCode: transfer.AssetCode,
 		}
 
+		var order *anchor.RailOrder
 		if transfer.Kind == stellarconnect.KindDeposit {
-			// Create onramp order
-			result, err := ef.CreateOnrampOrder(ctx, orderReq)
-			if err != nil {
-				log.Printf("Failed to create onramp order: %v", err)
-				renderError(w, tmpl, token, transfer, "Failed to create order. Please try again.")
-				return
-			}
-
-			// Order created successfully — now consume token and complete interactive
-			if _, err := tm.ConsumeInteractiveToken(ctx, token); err != nil {
-				log.Printf("Failed to consume token: %v", err)
-			}
-
-			// Store order details in metadata
-			if err := mergeMetadata(ctx, store, transfer.ID, map[string]any{
-				"etherfuse_order_id":       result.OrderID,
-				"etherfuse_deposit_clabe":  result.DepositClabe,
-				"etherfuse_deposit_amount": result.DepositAmount.String(),
-			}); err != nil {
-				log.Printf("Failed to store order metadata: %v", err)
-			}
+			// Onramp order: the user sends MXN to the returned CLABE
+			order, err = rail.CreateDeposit(ctx, transfer.ID, req)
+		} else {
+			// Offramp order: Etherfuse pays out MXN once it receives the crypto
+			order, err = rail.InitiateDisbursement(ctx, transfer.ID, req)
+		}
+		if err != nil {
+			log.Printf("Failed to create %s order: %v", transfer.Kind, err)
+			renderError(w, tmpl, token, transfer, "Failed to create order. Please try again.")
+			return
+		}
 
-			if err := tm.CompleteInteractive(ctx, transfer.ID, map[string]any{
-				"etherfuse_order_id": result.OrderID,
-			}); err != nil {
-				log.Printf("Failed to complete interactive: %v", err)
-			}
+		// Order created successfully — now consume the token
+		if _, err := tm.ConsumeInteractiveToken(ctx, token); err != nil {
+			log.Printf("Failed to consume token: %v", err)
+		}
 
+		if transfer.Kind == stellarconnect.KindDeposit {
 			data.Step = "deposit-instructions"
-			data.DepositClabe = result.DepositClabe
-			data.DepositAmount = result.DepositAmount.String()
-			data.OrderID = result.OrderID
-
+			data.DepositClabe = order.Instructions["deposit_clabe"]
+			data.DepositAmount = order.Instructions["deposit_amount"]
+			data.OrderID = order.ID
 		} else {
-			// Create offramp order
-			result, err := ef.CreateOfframpOrder(ctx, orderReq)
-			if err != nil {
-				log.Printf("Failed to create offramp order: %v", err)
-				renderError(w, tmpl, token, transfer, "Failed to create order. Please try again.")
-				return
-			}
-
-			// Order created successfully — now consume token and complete interactive
-			if _, err := tm.ConsumeInteractiveToken(ctx, token); err != nil {
-				log.Printf("Failed to consume token: %v", err)
-			}
-
-			// Store order details in metadata
-			if err := mergeMetadata(ctx, store, transfer.ID, map[string]any{
-				"etherfuse_order_id": result.OrderID,
-			}); err != nil {
-				log.Printf("Failed to store order metadata: %v", err)
-			}
-
-			if err := tm.CompleteInteractive(ctx, transfer.ID, map[string]any{
-				"etherfuse_order_id": result.OrderID,
-			}); err != nil {
-				log.Printf("Failed to complete interactive: %v", err)
-			}
-
 			data.Step = "withdrawal-pending"
 		}
 
@@ -438,16 +399,19 @@ func DeterministicOrderID(transferID string) string {
 // subtractDecimal computes a - b for decimal strings, returning a string.
 // Returns "0" if either input is invalid.
 func subtractDecimal(a, b string) string {
-	ra, ok := new(big.Rat).SetString(a)
-	if !ok {
+	ra, err := amount.Parse(a)
+	if err != nil {
+		return "0"
+	}
+	rb, err := amount.Parse(b)
+	if err != nil {
 		return "0"
 	}
-	rb, ok := new(big.Rat).SetString(b)
-	if !ok {
+	result, err := ra.Sub(rb)
+	if err != nil {
 		return "0"
 	}
-	result := new(big.Rat).Sub(ra, rb)
-	return result.FloatString(7)
+	return result.String()
 }
 
 // renderError renders the template with an error message.
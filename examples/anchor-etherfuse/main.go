@@ -21,9 +21,11 @@ import (
 	"strings"
 	"time"
 
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
 	"github.com/marwen-abid/anchor-sdk-go/anchor"
 	"github.com/marwen-abid/anchor-sdk-go/core/account"
 	"github.com/marwen-abid/anchor-sdk-go/core/toml"
+	sdkerrors "github.com/marwen-abid/anchor-sdk-go/errors"
 	"github.com/marwen-abid/anchor-sdk-go/observer"
 	"github.com/marwen-abid/anchor-sdk-go/signers"
 	"github.com/marwen-abid/anchor-sdk-go/store/memory"
@@ -91,12 +93,40 @@ func main() {
 		InteractiveBaseURL:  fmt.Sprintf("%s/interactive", baseURL),
 		DistributionAccount: signer.PublicKey(),
 		BaseURL:             baseURL,
+		IdempotencyStore:    memory.NewIdempotencyStore(),
 	}
 	transferManager := anchor.NewTransferManager(transferStore, transferConfig, nil)
 
+	// Notify wallets that passed on_change_callback of every status change.
+	callbackSigner, err := signers.CallbackSignerFromSecret(cfg.AnchorSecret)
+	if err != nil {
+		log.Fatalf("Failed to create callback signer: %v", err)
+	}
+	callbacks, err := anchor.NewCallbackNotifier(transferManager, anchor.CallbackConfig{
+		Signer: callbackSigner,
+		Payload: func(transfer *stellarconnect.Transfer, _ *anchor.TransferStatusResponse) any {
+			return sep24TransactionResponse{Transaction: buildTransactionResponse(transfer, baseURL)}
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to create callback notifier: %v", err)
+	}
+	defer callbacks.Close()
+
 	// Etherfuse client
 	etherfuseClient := NewEtherfuseClient(cfg.EtherfuseAPIKey, cfg.EtherfuseAPIURL)
 
+	// Etherfuse orders drive transfer status through the rail adapter
+	etherfuseRail := NewEtherfuseRail(etherfuseClient, cfg.EtherfuseWebhookSecret, cfg.NetworkPassphrase)
+	railAdapter, err := anchor.NewRailAdapter(transferManager, etherfuseRail)
+	if err != nil {
+		log.Fatalf("Failed to create rail adapter: %v", err)
+	}
+	webhookReceiver, err := newWebhookReceiver(etherfuseRail, railAdapter, memory.NewIdempotencyStore())
+	if err != nil {
+		log.Fatalf("Failed to create webhook receiver: %v", err)
+	}
+
 	// Fetch available asset identifiers from Etherfuse at startup.
 	// This ensures we use the exact identifiers Etherfuse expects for quotes.
 	assetIdentifiers := map[string]string{}
@@ -203,10 +233,10 @@ func main() {
 	mux.HandleFunc("POST /interactive/onboard", handlePostOnboard(transferManager, etherfuseClient, transferStore))
 	mux.HandleFunc("GET /interactive/kyc-poll", handleKYCPoll(transferManager, etherfuseClient))
 	mux.HandleFunc("POST /interactive/quote", handlePostQuote(transferManager, etherfuseClient, transferStore, assetIdentifiers))
-	mux.HandleFunc("POST /interactive/order", handlePostOrder(transferManager, etherfuseClient, transferStore))
+	mux.HandleFunc("POST /interactive/order", handlePostOrder(transferManager, railAdapter))
 
 	// Etherfuse webhooks
-	mux.HandleFunc("POST /webhooks/etherfuse", handleWebhook(transferManager, transferStore, cfg.EtherfuseWebhookSecret, cfg.NetworkPassphrase))
+	mux.Handle("POST /webhooks/etherfuse", webhookReceiver)
 
 	handler := corsMiddleware(mux)
 
@@ -246,6 +276,20 @@ func writeJSONError(w http.ResponseWriter, message string, statusCode int) {
 	json.NewEncoder(w).Encode(map[string]string{"error": message})
 }
 
+// writeInitiateError maps a transfer initiation error to an HTTP response.
+// Idempotency key conflicts are reported as 409 so clients stop retrying.
+func writeInitiateError(w http.ResponseWriter, err error, message string) {
+	var sdkErr *sdkerrors.StellarConnectError
+	if sdkerrors.As(err, &sdkErr) {
+		switch sdkErr.Code {
+		case sdkerrors.IDEMPOTENCY_KEY_REUSED, sdkerrors.IDEMPOTENCY_IN_PROGRESS:
+			writeJSONError(w, sdkErr.Message, http.StatusConflict)
+			return
+		}
+	}
+	writeJSONError(w, message, http.StatusInternalServerError)
+}
+
 // handleGetChallenge returns a SEP-10 challenge transaction for the given account.
 func handleGetChallenge(authIssuer *anchor.AuthIssuer, networkPassphrase string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
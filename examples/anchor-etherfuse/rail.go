@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/anchor"
+	"github.com/marwen-abid/anchor-sdk-go/webhook"
+)
+
+// EtherfuseRail implements anchor.RailProvider on top of the Etherfuse FX
+// Ramp API. Onramp orders fund deposits and offramp orders pay out
+// withdrawals; anchor.RailAdapter turns their updates into transfer
+// transitions.
+type EtherfuseRail struct {
+	client            *EtherfuseClient
+	verifier          webhook.Verifier
+	networkPassphrase string
+}
+
+// NewEtherfuseRail creates the Etherfuse rail. Webhooks carry an
+// HMAC-SHA256 of the body keyed with webhookSecret in X-Signature, as
+// "sha256={hex}". With an empty secret they are not verified, which is only
+// acceptable in local development.
+func NewEtherfuseRail(client *EtherfuseClient, webhookSecret, networkPassphrase string) *EtherfuseRail {
+	var verifier webhook.Verifier = webhook.HMACSHA256{
+		Secret: []byte(webhookSecret),
+		Header: "X-Signature",
+		Prefix: "sha256=",
+	}
+	if webhookSecret == "" {
+		log.Printf("WARNING: ETHERFUSE_WEBHOOK_SECRET is not set; webhook signatures are not verified")
+		verifier = webhook.Unverified
+	}
+	return &EtherfuseRail{
+		client:            client,
+		verifier:          verifier,
+		networkPassphrase: networkPassphrase,
+	}
+}
+
+// Name prefixes the transfer metadata keys written by the adapter, e.g.
+// "etherfuse_order_id".
+func (e *EtherfuseRail) Name() string {
+	return "etherfuse"
+}
+
+// CreateDepositInstructions creates an onramp order for the quote in req.
+// The instructions hold the CLABE and MXN amount to send via SPEI.
+func (e *EtherfuseRail) CreateDepositInstructions(ctx context.Context, req anchor.RailOrderRequest) (*anchor.RailOrder, error) {
+	result, err := e.client.CreateOnrampOrder(ctx, orderRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	return &anchor.RailOrder{
+		ID:     result.OrderID,
+		Kind:   stellarconnect.KindDeposit,
+		Status: anchor.RailOrderCreated,
+		Instructions: map[string]string{
+			"deposit_clabe":  result.DepositClabe,
+			"deposit_amount": result.DepositAmount.String(),
+		},
+	}, nil
+}
+
+// InitiateDisbursement creates an offramp order for the quote in req.
+func (e *EtherfuseRail) InitiateDisbursement(ctx context.Context, req anchor.RailOrderRequest) (*anchor.RailOrder, error) {
+	result, err := e.client.CreateOfframpOrder(ctx, orderRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	return &anchor.RailOrder{
+		ID:     result.OrderID,
+		Kind:   stellarconnect.KindWithdrawal,
+		Status: anchor.RailOrderCreated,
+	}, nil
+}
+
+// OrderStatus fetches an order from Etherfuse.
+func (e *EtherfuseRail) OrderStatus(ctx context.Context, orderID string) (*anchor.RailOrder, error) {
+	order, err := e.client.GetOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return e.railOrder(*order)
+}
+
+// WebhookConfig verifies the HMAC-SHA256 signature in X-Signature.
+// Etherfuse does not sign a timestamp.
+func (e *EtherfuseRail) WebhookConfig() webhook.Config {
+	return webhook.Config{Verifier: e.verifier}
+}
+
+// ParseWebhook parses order_updated events; other events do not concern
+// orders. The server itself receives webhooks through newWebhookReceiver,
+// which also handles the KYC and customer events.
+func (e *EtherfuseRail) ParseWebhook(header http.Header, body []byte) (*anchor.RailOrder, error) {
+	event, err := webhook.KeyedJSON()(header, body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if event == nil || event.Type != "order_updated" {
+		return nil, nil
+	}
+	var payload OrderUpdatedPayload
+	if err := json.Unmarshal(event.Data, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse order_updated: %w", err)
+	}
+	return e.railOrder(payload)
+}
+
+// railOrder converts an Etherfuse order to a rail order. For offramp
+// orders, the burnTransaction is decoded to provide the withdraw account and
+// memo the wallet must pay, stored as etherfuse_withdraw_anchor_account and
+// etherfuse_withdraw_memo.
+func (e *EtherfuseRail) railOrder(payload OrderUpdatedPayload) (*anchor.RailOrder, error) {
+	order := &anchor.RailOrder{
+		ID:            payload.OrderID,
+		Kind:          stellarconnect.KindDeposit,
+		StellarTxHash: payload.ConfirmedTxSignature,
+	}
+	if payload.OrderType == "offramp" {
+		order.Kind = stellarconnect.KindWithdrawal
+	}
+	if payload.AmountInTokens > 0 {
+		order.Amount = fmt.Sprintf("%.7f", payload.AmountInTokens)
+	}
+
+	switch payload.Status {
+	case "created":
+		order.Status = anchor.RailOrderCreated
+	case "funded":
+		order.Status = anchor.RailOrderFunded
+	case "completed":
+		order.Status = anchor.RailOrderCompleted
+	case "failed":
+		order.Status, order.Message = anchor.RailOrderFailed, "Etherfuse order failed"
+	case "refunded":
+		order.Status, order.Message = anchor.RailOrderRefunded, "Etherfuse order refunded"
+	case "canceled":
+		order.Status, order.Message = anchor.RailOrderCancelled, "Etherfuse order canceled"
+	default:
+		return nil, fmt.Errorf("unknown order status: %s", payload.Status)
+	}
+
+	if order.Kind == stellarconnect.KindWithdrawal && payload.BurnTransaction != "" {
+		account, memo, err := decodeBurnTransaction(payload.BurnTransaction, e.networkPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode burnTransaction: %w", err)
+		}
+		log.Printf("Webhook: decoded burnTransaction: account=%s memo=%s", account, memo)
+		order.Instructions = map[string]string{
+			"withdraw_anchor_account": account,
+			"withdraw_memo":           memo,
+			"burn_transaction":        payload.BurnTransaction,
+		}
+	}
+	return order, nil
+}
+
+// orderRequest builds the Etherfuse order for a transfer. Order and bank
+// account IDs are derived deterministically so retries reuse them.
+func orderRequest(req anchor.RailOrderRequest) OrderRequest {
+	return OrderRequest{
+		OrderID:       DeterministicOrderID(req.Transfer.ID),
+		BankAccountID: DeterministicBankAccountID(req.Transfer.Account),
+		PublicKey:     req.Transfer.Account,
+		QuoteID:       req.QuoteID,
+	}
+}
+
+// Verify that EtherfuseRail implements anchor.RailProvider
+var _ anchor.RailProvider = (*EtherfuseRail)(nil)
@@ -12,6 +12,7 @@ import (
 
 	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
 	"github.com/marwen-abid/anchor-sdk-go/anchor"
+	"github.com/marwen-abid/anchor-sdk-go/core/amount"
 	"github.com/stellar/go/keypair"
 )
 
@@ -57,24 +58,24 @@ type sep24TransactionsResponse struct {
 // etherfuseTransactionResponse extends TransferStatusResponse with SEP-24
 // withdrawal fields populated from Etherfuse burnTransaction data.
 type etherfuseTransactionResponse struct {
-	ID                    string     `json:"id"`
-	Kind                  string     `json:"kind"`
-	Status                string     `json:"status"`
-	StatusETA             int        `json:"status_eta,omitempty"`
-	MoreInfoURL           string     `json:"more_info_url"`
-	AmountIn              string     `json:"amount_in,omitempty"`
-	AmountOut             string     `json:"amount_out,omitempty"`
-	AmountFee             string     `json:"amount_fee,omitempty"`
-	To                    string     `json:"to,omitempty"`
-	From                  string     `json:"from,omitempty"`
-	StartedAt             time.Time  `json:"started_at"`
-	CompletedAt           *time.Time `json:"completed_at,omitempty"`
-	TxHash                string     `json:"stellar_transaction_id,omitempty"`
-	ExternalTxID          string     `json:"external_transaction_id,omitempty"`
-	Message               string     `json:"message,omitempty"`
-	WithdrawAnchorAccount string     `json:"withdraw_anchor_account,omitempty"`
-	WithdrawMemo          string     `json:"withdraw_memo,omitempty"`
-	WithdrawMemoType      string     `json:"withdraw_memo_type,omitempty"`
+	ID                    string        `json:"id"`
+	Kind                  string        `json:"kind"`
+	Status                string        `json:"status"`
+	StatusETA             int           `json:"status_eta,omitempty"`
+	MoreInfoURL           string        `json:"more_info_url"`
+	AmountIn              amount.Amount `json:"amount_in,omitzero"`
+	AmountOut             amount.Amount `json:"amount_out,omitzero"`
+	AmountFee             string        `json:"amount_fee,omitempty"`
+	To                    string        `json:"to,omitempty"`
+	From                  string        `json:"from,omitempty"`
+	StartedAt             time.Time     `json:"started_at"`
+	CompletedAt           *time.Time    `json:"completed_at,omitempty"`
+	TxHash                string        `json:"stellar_transaction_id,omitempty"`
+	ExternalTxID          string        `json:"external_transaction_id,omitempty"`
+	Message               string        `json:"message,omitempty"`
+	WithdrawAnchorAccount string        `json:"withdraw_anchor_account,omitempty"`
+	WithdrawMemo          string        `json:"withdraw_memo,omitempty"`
+	WithdrawMemoType      string        `json:"withdraw_memo_type,omitempty"`
 }
 
 // mapStatusToSEP24 maps internal SDK statuses to SEP-24 spec statuses.
@@ -181,7 +182,7 @@ func handleDepositInteractive(tm *anchor.TransferManager) http.HandlerFunc {
 			return
 		}
 
-		assetCode, account, amount, err := parseDepositRequest(r)
+		assetCode, account, amount, callback, err := parseDepositRequest(r)
 		if err != nil {
 			writeJSONError(w, "invalid request format", http.StatusBadRequest)
 			return
@@ -207,15 +208,17 @@ func handleDepositInteractive(tm *anchor.TransferManager) http.HandlerFunc {
 		}
 
 		req := anchor.DepositRequest{
-			Account:   account,
-			AssetCode: assetCode,
-			Amount:    amount,
-			Mode:      stellarconnect.ModeInteractive,
+			Account:          account,
+			AssetCode:        assetCode,
+			Amount:           amount,
+			Mode:             stellarconnect.ModeInteractive,
+			IdempotencyKey:   r.Header.Get("Idempotency-Key"),
+			OnChangeCallback: callback,
 		}
 
 		result, err := tm.InitiateDeposit(context.Background(), req)
 		if err != nil {
-			writeJSONError(w, "failed to initiate deposit", http.StatusInternalServerError)
+			writeInitiateError(w, err, "failed to initiate deposit")
 			return
 		}
 
@@ -240,7 +243,7 @@ func handleWithdrawInteractive(tm *anchor.TransferManager) http.HandlerFunc {
 			return
 		}
 
-		assetCode, account, amount, dest, err := parseWithdrawRequest(r)
+		assetCode, account, amount, dest, callback, err := parseWithdrawRequest(r)
 		if err != nil {
 			writeJSONError(w, "invalid request format", http.StatusBadRequest)
 			return
@@ -262,16 +265,18 @@ func handleWithdrawInteractive(tm *anchor.TransferManager) http.HandlerFunc {
 		}
 
 		req := anchor.WithdrawalRequest{
-			Account:   account,
-			AssetCode: assetCode,
-			Amount:    amount,
-			Dest:      dest,
-			Mode:      stellarconnect.ModeInteractive,
+			Account:          account,
+			AssetCode:        assetCode,
+			Amount:           amount,
+			Dest:             dest,
+			Mode:             stellarconnect.ModeInteractive,
+			IdempotencyKey:   r.Header.Get("Idempotency-Key"),
+			OnChangeCallback: callback,
 		}
 
 		result, err := tm.InitiateWithdrawal(context.Background(), req)
 		if err != nil {
-			writeJSONError(w, "failed to initiate withdrawal", http.StatusInternalServerError)
+			writeInitiateError(w, err, "failed to initiate withdrawal")
 			return
 		}
 
@@ -421,30 +426,31 @@ func handleMoreInfo(store stellarconnect.TransferStore) http.HandlerFunc {
 }
 
 // parseDepositRequest parses deposit request from JSON, form-urlencoded, or multipart/form-data.
-func parseDepositRequest(r *http.Request) (assetCode, account, amount string, err error) {
+func parseDepositRequest(r *http.Request) (assetCode, account, amount, callback string, err error) {
 	contentType := r.Header.Get("Content-Type")
 	if strings.Contains(contentType, "application/json") {
 		var req struct {
 			AssetCode string `json:"asset_code"`
 			Account   string `json:"account"`
 			Amount    string `json:"amount"`
+			Callback  string `json:"on_change_callback"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			return "", "", "", err
+			return "", "", "", "", err
 		}
-		return req.AssetCode, req.Account, req.Amount, nil
+		return req.AssetCode, req.Account, req.Amount, req.Callback, nil
 	}
 	// Handles both application/x-www-form-urlencoded and multipart/form-data
 	if err := r.ParseMultipartForm(1 << 20); err != nil {
 		if err := r.ParseForm(); err != nil {
-			return "", "", "", err
+			return "", "", "", "", err
 		}
 	}
-	return r.FormValue("asset_code"), r.FormValue("account"), r.FormValue("amount"), nil
+	return r.FormValue("asset_code"), r.FormValue("account"), r.FormValue("amount"), r.FormValue("on_change_callback"), nil
 }
 
 // parseWithdrawRequest parses withdrawal request from JSON, form-urlencoded, or multipart/form-data.
-func parseWithdrawRequest(r *http.Request) (assetCode, account, amount, dest string, err error) {
+func parseWithdrawRequest(r *http.Request) (assetCode, account, amount, dest, callback string, err error) {
 	contentType := r.Header.Get("Content-Type")
 	if strings.Contains(contentType, "application/json") {
 		var req struct {
@@ -452,17 +458,18 @@ func parseWithdrawRequest(r *http.Request) (assetCode, account, amount, dest str
 			Account   string `json:"account"`
 			Amount    string `json:"amount"`
 			Dest      string `json:"dest"`
+			Callback  string `json:"on_change_callback"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			return "", "", "", "", err
+			return "", "", "", "", "", err
 		}
-		return req.AssetCode, req.Account, req.Amount, req.Dest, nil
+		return req.AssetCode, req.Account, req.Amount, req.Dest, req.Callback, nil
 	}
 	// Handles both application/x-www-form-urlencoded and multipart/form-data
 	if err := r.ParseMultipartForm(1 << 20); err != nil {
 		if err := r.ParseForm(); err != nil {
-			return "", "", "", "", err
+			return "", "", "", "", "", err
 		}
 	}
-	return r.FormValue("asset_code"), r.FormValue("account"), r.FormValue("amount"), r.FormValue("dest"), nil
+	return r.FormValue("asset_code"), r.FormValue("account"), r.FormValue("amount"), r.FormValue("dest"), r.FormValue("on_change_callback"), nil
 }
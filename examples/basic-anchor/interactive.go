@@ -9,6 +9,7 @@ import (
 	"net/http"
 
 	"github.com/marwen-abid/anchor-sdk-go/anchor"
+	"github.com/marwen-abid/anchor-sdk-go/core/amount"
 )
 
 //go:embed templates/interactive.html
@@ -16,7 +17,7 @@ var interactiveTemplate embed.FS
 
 // interactiveData is the data passed to the HTML template
 type interactiveData struct {
-	Amount string
+	Amount amount.Amount
 }
 
 // successData is the success response data
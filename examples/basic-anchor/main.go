@@ -20,9 +20,11 @@ import (
 	"strings"
 	"time"
 
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
 	"github.com/marwen-abid/anchor-sdk-go/anchor"
 	"github.com/marwen-abid/anchor-sdk-go/core/account"
 	"github.com/marwen-abid/anchor-sdk-go/core/toml"
+	sdkerrors "github.com/marwen-abid/anchor-sdk-go/errors"
 	"github.com/marwen-abid/anchor-sdk-go/observer"
 	"github.com/marwen-abid/anchor-sdk-go/signers"
 	"github.com/marwen-abid/anchor-sdk-go/store/memory"
@@ -100,9 +102,27 @@ func main() {
 		InteractiveBaseURL:  fmt.Sprintf("http://%s/interactive", testDomain),
 		DistributionAccount: signer.PublicKey(),
 		BaseURL:             fmt.Sprintf("http://%s", testDomain),
+		IdempotencyStore:    memory.NewIdempotencyStore(),
 	}
 	transferManager := anchor.NewTransferManager(transferStore, transferConfig, nil)
 
+	// Notify wallets that passed on_change_callback of every status change.
+	callbackSigner, err := signers.CallbackSignerFromSecret(testAnchorSecret)
+	if err != nil {
+		log.Fatalf("Failed to create callback signer: %v", err)
+	}
+	callbacks, err := anchor.NewCallbackNotifier(transferManager, anchor.CallbackConfig{
+		Signer: callbackSigner,
+		Payload: func(_ *stellarconnect.Transfer, resp *anchor.TransferStatusResponse) any {
+			resp.Status = mapStatusToSEP24(resp.Status)
+			return sep24TransactionResponse{Transaction: resp}
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to create callback notifier: %v", err)
+	}
+	defer callbacks.Close()
+
 	distributionAccount := signer.PublicKey()
 	obs := observer.NewHorizonObserver(
 		horizonURL,
@@ -199,6 +219,20 @@ func writeJSONError(w http.ResponseWriter, message string, statusCode int) {
 	json.NewEncoder(w).Encode(map[string]string{"error": message})
 }
 
+// writeInitiateError maps a transfer initiation error to an HTTP response.
+// Idempotency key conflicts are reported as 409 so clients stop retrying.
+func writeInitiateError(w http.ResponseWriter, err error, message string) {
+	var sdkErr *sdkerrors.StellarConnectError
+	if sdkerrors.As(err, &sdkErr) {
+		switch sdkErr.Code {
+		case sdkerrors.IDEMPOTENCY_KEY_REUSED, sdkerrors.IDEMPOTENCY_IN_PROGRESS:
+			writeJSONError(w, sdkErr.Message, http.StatusConflict)
+			return
+		}
+	}
+	writeJSONError(w, message, http.StatusInternalServerError)
+}
+
 // handleGetChallenge returns a SEP-10 challenge transaction for the given account.
 func handleGetChallenge(authIssuer *anchor.AuthIssuer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
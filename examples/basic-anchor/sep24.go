@@ -108,7 +108,7 @@ func handleDepositInteractive(tm *anchor.TransferManager) http.HandlerFunc {
 			return
 		}
 
-		assetCode, account, amount, err := parseDepositRequest(r)
+		assetCode, account, amount, callback, err := parseDepositRequest(r)
 		if err != nil {
 			writeJSONError(w, "invalid request format", http.StatusBadRequest)
 			return
@@ -141,15 +141,17 @@ func handleDepositInteractive(tm *anchor.TransferManager) http.HandlerFunc {
 		}
 
 		req := anchor.DepositRequest{
-			Account:   account,
-			AssetCode: assetCode,
-			Amount:    amount,
-			Mode:      stellarconnect.ModeInteractive,
+			Account:          account,
+			AssetCode:        assetCode,
+			Amount:           amount,
+			Mode:             stellarconnect.ModeInteractive,
+			IdempotencyKey:   r.Header.Get("Idempotency-Key"),
+			OnChangeCallback: callback,
 		}
 
 		result, err := tm.InitiateDeposit(context.Background(), req)
 		if err != nil {
-			writeJSONError(w, "failed to initiate deposit", http.StatusInternalServerError)
+			writeInitiateError(w, err, "failed to initiate deposit")
 			return
 		}
 
@@ -175,7 +177,7 @@ func handleWithdrawInteractive(tm *anchor.TransferManager) http.HandlerFunc {
 			return
 		}
 
-		assetCode, account, amount, dest, err := parseWithdrawRequest(r)
+		assetCode, account, amount, dest, callback, err := parseWithdrawRequest(r)
 		if err != nil {
 			writeJSONError(w, "invalid request format", http.StatusBadRequest)
 			return
@@ -202,16 +204,18 @@ func handleWithdrawInteractive(tm *anchor.TransferManager) http.HandlerFunc {
 		}
 
 		req := anchor.WithdrawalRequest{
-			Account:   account,
-			AssetCode: assetCode,
-			Amount:    amount,
-			Dest:      dest,
-			Mode:      stellarconnect.ModeInteractive,
+			Account:          account,
+			AssetCode:        assetCode,
+			Amount:           amount,
+			Dest:             dest,
+			Mode:             stellarconnect.ModeInteractive,
+			IdempotencyKey:   r.Header.Get("Idempotency-Key"),
+			OnChangeCallback: callback,
 		}
 
 		result, err := tm.InitiateWithdrawal(context.Background(), req)
 		if err != nil {
-			writeJSONError(w, "failed to initiate withdrawal", http.StatusInternalServerError)
+			writeInitiateError(w, err, "failed to initiate withdrawal")
 			return
 		}
 
@@ -395,28 +399,29 @@ func handleMoreInfo(tm *anchor.TransferManager) http.HandlerFunc {
 }
 
 // parseDepositRequest parses deposit request from either JSON or FormData
-func parseDepositRequest(r *http.Request) (assetCode, account, amount string, err error) {
+func parseDepositRequest(r *http.Request) (assetCode, account, amount, callback string, err error) {
 	contentType := r.Header.Get("Content-Type")
 	if strings.Contains(contentType, "application/json") {
 		var req struct {
 			AssetCode string `json:"asset_code"`
 			Account   string `json:"account"`
 			Amount    string `json:"amount"`
+			Callback  string `json:"on_change_callback"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			return "", "", "", err
+			return "", "", "", "", err
 		}
-		return req.AssetCode, req.Account, req.Amount, nil
+		return req.AssetCode, req.Account, req.Amount, req.Callback, nil
 	}
 	// FormData parsing
 	if err := r.ParseForm(); err != nil {
-		return "", "", "", err
+		return "", "", "", "", err
 	}
-	return r.FormValue("asset_code"), r.FormValue("account"), r.FormValue("amount"), nil
+	return r.FormValue("asset_code"), r.FormValue("account"), r.FormValue("amount"), r.FormValue("on_change_callback"), nil
 }
 
 // parseWithdrawRequest parses withdrawal request from either JSON or FormData
-func parseWithdrawRequest(r *http.Request) (assetCode, account, amount, dest string, err error) {
+func parseWithdrawRequest(r *http.Request) (assetCode, account, amount, dest, callback string, err error) {
 	contentType := r.Header.Get("Content-Type")
 	if strings.Contains(contentType, "application/json") {
 		var req struct {
@@ -424,15 +429,16 @@ func parseWithdrawRequest(r *http.Request) (assetCode, account, amount, dest str
 			Account   string `json:"account"`
 			Amount    string `json:"amount"`
 			Dest      string `json:"dest"`
+			Callback  string `json:"on_change_callback"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			return "", "", "", "", err
+			return "", "", "", "", "", err
 		}
-		return req.AssetCode, req.Account, req.Amount, req.Dest, nil
+		return req.AssetCode, req.Account, req.Amount, req.Dest, req.Callback, nil
 	}
 	// FormData parsing
 	if err := r.ParseForm(); err != nil {
-		return "", "", "", "", err
+		return "", "", "", "", "", err
 	}
-	return r.FormValue("asset_code"), r.FormValue("account"), r.FormValue("amount"), r.FormValue("dest"), nil
+	return r.FormValue("asset_code"), r.FormValue("account"), r.FormValue("amount"), r.FormValue("dest"), r.FormValue("on_change_callback"), nil
 }
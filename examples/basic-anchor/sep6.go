@@ -108,15 +108,21 @@ func handleSEP6Deposit(tm *anchor.TransferManager) http.HandlerFunc {
 		}
 
 		req := anchor.DepositRequest{
-			Account:   account,
-			AssetCode: assetCode,
-			Amount:    amount,
-			Mode:      stellarconnect.ModeAPI,
+			Account:        account,
+			AssetCode:      assetCode,
+			Amount:         amount,
+			Mode:           stellarconnect.ModeAPI,
+			IdempotencyKey: r.Header.Get("Idempotency-Key"),
+			Memo:           r.URL.Query().Get("memo"),
+			MemoType:       stellarconnect.MemoType(r.URL.Query().Get("memo_type")),
+
+			ClaimableBalanceSupported: r.URL.Query().Get("claimable_balance_supported") == "true",
+			OnChangeCallback:          r.URL.Query().Get("on_change_callback"),
 		}
 
 		result, err := tm.InitiateDeposit(context.Background(), req)
 		if err != nil {
-			http.Error(w, `{"error":"failed to initiate deposit"}`, http.StatusInternalServerError)
+			writeInitiateError(w, err, "failed to initiate deposit")
 			return
 		}
 
@@ -173,16 +179,18 @@ func handleSEP6Withdraw(tm *anchor.TransferManager) http.HandlerFunc {
 		}
 
 		req := anchor.WithdrawalRequest{
-			Account:   account,
-			AssetCode: assetCode,
-			Amount:    amount,
-			Dest:      dest,
-			Mode:      stellarconnect.ModeAPI,
+			Account:          account,
+			AssetCode:        assetCode,
+			Amount:           amount,
+			Dest:             dest,
+			Mode:             stellarconnect.ModeAPI,
+			IdempotencyKey:   r.Header.Get("Idempotency-Key"),
+			OnChangeCallback: r.URL.Query().Get("on_change_callback"),
 		}
 
 		result, err := tm.InitiateWithdrawal(context.Background(), req)
 		if err != nil {
-			http.Error(w, `{"error":"failed to initiate withdrawal"}`, http.StatusInternalServerError)
+			writeInitiateError(w, err, "failed to initiate withdrawal")
 			return
 		}
 
@@ -3,6 +3,7 @@ package observer
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,18 +11,23 @@ import (
 	"github.com/stellar/go-stellar-sdk/protocols/horizon/base"
 	"github.com/stellar/go-stellar-sdk/protocols/horizon/operations"
 
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
 	"github.com/marwen-abid/anchor-sdk-go/errors"
 )
 
-// HorizonObserver implements Observer by streaming payment operations from Horizon.
+// HorizonObserver implements Observer by streaming payment operations from Horizon,
+// and TrustlineObserver by also streaming change_trust operations.
 // It provides cursor management for resumability, reconnection with exponential backoff,
 // and filtering capabilities.
 type HorizonObserver struct {
-	horizonURL  string
-	client      *horizonclient.Client
-	handlers    []handlerEntry
-	cursor      string
-	cursorSaver func(string) error
+	horizonURL    string
+	client        *horizonclient.Client
+	handlers      []handlerEntry
+	trustHandlers []TrustlineHandler
+	trustWatches  map[string]*trustWatch
+	trustCtx      context.Context // set while Start runs
+	cursor        string
+	cursorSaver   func(string) error
 
 	// Reconnection backoff settings
 	initialBackoff time.Duration
@@ -34,6 +40,12 @@ type HorizonObserver struct {
 	running  bool
 }
 
+// trustWatch is an account whose change_trust operations are streamed.
+type trustWatch struct {
+	cursor string             // paging_token of the last operation seen
+	cancel context.CancelFunc // stops the stream; nil while not streaming
+}
+
 // ObserverOption is a function that configures a HorizonObserver.
 type ObserverOption func(*HorizonObserver)
 
@@ -71,6 +83,7 @@ func NewHorizonObserver(horizonURL string, opts ...ObserverOption) *HorizonObser
 		horizonURL:     horizonURL,
 		client:         &horizonclient.Client{HorizonURL: horizonURL},
 		handlers:       make([]handlerEntry, 0),
+		trustWatches:   make(map[string]*trustWatch),
 		cursor:         "now",
 		initialBackoff: 1 * time.Second,
 		maxBackoff:     60 * time.Second,
@@ -97,7 +110,92 @@ func (h *HorizonObserver) OnPayment(handler PaymentHandler, filters ...PaymentFi
 	})
 }
 
-// Start begins streaming payment operations from Horizon.
+// OnChangeTrust registers a handler for change_trust operations of the
+// accounts passed to WatchTrustlines. Handlers may be called concurrently
+// for different accounts.
+func (h *HorizonObserver) OnChangeTrust(handler TrustlineHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.trustHandlers = append(h.trustHandlers, handler)
+}
+
+// WatchTrustlines streams the change_trust operations of account, a G...
+// address, while Start runs. The stream begins after the account's latest
+// operation at the time of the call, so no change made afterwards is missed,
+// and resumes from the last operation seen after a reconnect. Watching an
+// account twice has no effect.
+func (h *HorizonObserver) WatchTrustlines(account string) error {
+	h.mu.RLock()
+	_, watched := h.trustWatches[account]
+	h.mu.RUnlock()
+	if watched {
+		return nil
+	}
+
+	cursor, err := h.latestCursor(account)
+	if err != nil {
+		return errors.NewObserverError(errors.STREAM_ERROR, "failed to look up operations of "+account, err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, watched := h.trustWatches[account]; watched {
+		return nil
+	}
+	w := &trustWatch{cursor: cursor}
+	h.trustWatches[account] = w
+	if h.trustCtx != nil {
+		h.startTrustStream(account, w)
+	}
+	return nil
+}
+
+// UnwatchTrustlines stops streaming the change_trust operations of account.
+func (h *HorizonObserver) UnwatchTrustlines(account string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if w, ok := h.trustWatches[account]; ok {
+		if w.cancel != nil {
+			w.cancel()
+		}
+		delete(h.trustWatches, account)
+	}
+}
+
+// latestCursor returns the paging_token of the account's latest operation,
+// or "" if it has none.
+func (h *HorizonObserver) latestCursor(account string) (string, error) {
+	page, err := h.client.Operations(horizonclient.OperationRequest{
+		ForAccount: account,
+		Order:      horizonclient.OrderDesc,
+		Limit:      1,
+	})
+	if horizonclient.IsNotFoundError(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(page.Embedded.Records) == 0 {
+		return "", nil
+	}
+	return page.Embedded.Records[0].PagingToken(), nil
+}
+
+// startTrustStream streams the account's operations until the watch or Start
+// ends. The caller must hold h.mu.
+func (h *HorizonObserver) startTrustStream(account string, w *trustWatch) {
+	ctx, cancel := context.WithCancel(h.trustCtx)
+	w.cancel = cancel
+	go func() {
+		_ = h.streamTrustlines(ctx, account, w)
+	}()
+}
+
+// Start begins streaming payment operations from Horizon, and the
+// operations of accounts passed to WatchTrustlines.
 // This method blocks until the context is cancelled or Stop() is called.
 // It automatically reconnects with exponential backoff on stream failures.
 func (h *HorizonObserver) Start(ctx context.Context) error {
@@ -107,44 +205,42 @@ func (h *HorizonObserver) Start(ctx context.Context) error {
 		return errors.NewObserverError(errors.STREAM_ERROR, "observer already running", nil)
 	}
 	h.running = true
+	trustCtx, cancel := context.WithCancel(ctx)
+	h.trustCtx = trustCtx
+	for account, w := range h.trustWatches {
+		h.startTrustStream(account, w)
+	}
 	h.mu.Unlock()
 
 	defer func() {
 		h.mu.Lock()
 		h.running = false
+		h.trustCtx = nil
+		for _, w := range h.trustWatches {
+			w.cancel = nil
+		}
 		h.mu.Unlock()
+		cancel()
 	}()
 
-	// Exponential backoff state
-	backoff := h.initialBackoff
-	attempt := 0
-
-	for {
-		// Check if stopped or context cancelled
-		select {
-		case <-h.stopChan:
-			return nil
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
-
+	return h.reconnect(ctx, "stream", func(connected func()) error {
 		// Get current cursor
 		h.mu.RLock()
 		currentCursor := h.cursor
 		h.mu.RUnlock()
 
 		// Create operation request for streaming payments
+		// Join transactions so each payment carries its transaction memo
 		opRequest := horizonclient.OperationRequest{
 			Cursor: currentCursor,
 			Order:  horizonclient.OrderAsc,
+			Join:   "transactions",
 		}
 
 		// Start streaming
-		err := h.client.StreamPayments(ctx, opRequest, func(op operations.Operation) {
+		return h.client.StreamPayments(ctx, opRequest, func(op operations.Operation) {
 			// Reset backoff on successful stream
-			backoff = h.initialBackoff
-			attempt = 0
+			connected()
 
 			// Convert operation to PaymentEvent
 			evt := h.convertToPaymentEvent(op)
@@ -170,6 +266,70 @@ func (h *HorizonObserver) Start(ctx context.Context) error {
 				}
 			}
 		})
+	})
+}
+
+// streamTrustlines streams the account's operations and passes its
+// change_trust operations to the trustline handlers.
+func (h *HorizonObserver) streamTrustlines(ctx context.Context, account string, w *trustWatch) error {
+	return h.reconnect(ctx, "trustline stream for "+account, func(connected func()) error {
+		h.mu.RLock()
+		cursor := w.cursor
+		h.mu.RUnlock()
+
+		opRequest := horizonclient.OperationRequest{
+			ForAccount: account,
+			Cursor:     cursor,
+			Order:      horizonclient.OrderAsc,
+		}
+		return h.client.StreamOperations(ctx, opRequest, func(op operations.Operation) {
+			connected()
+			h.mu.Lock()
+			w.cursor = op.PagingToken()
+			h.mu.Unlock()
+
+			// The account's operations include those of other accounts that
+			// involve it, such as trustlines to an asset it issues.
+			changeTrust, ok := op.(operations.ChangeTrust)
+			if !ok || changeTrust.LiquidityPoolID != "" || changeTrust.Trustor != account {
+				return
+			}
+			h.processTrustlineEvent(TrustlineEvent{
+				ID:              changeTrust.ID,
+				Account:         changeTrust.Trustor,
+				Asset:           h.formatAsset(changeTrust.Asset),
+				Limit:           changeTrust.Limit,
+				Removed:         isZeroLimit(changeTrust.Limit),
+				Cursor:          changeTrust.PT,
+				TransactionHash: changeTrust.TransactionHash,
+			})
+		})
+	})
+}
+
+// reconnect runs stream until it ends cleanly, the observer is stopped, or ctx
+// is cancelled, reconnecting with exponential backoff after failures. stream
+// calls connected whenever it receives an event, which resets the backoff.
+func (h *HorizonObserver) reconnect(ctx context.Context, name string, stream func(connected func()) error) error {
+	// Exponential backoff state
+	backoff := h.initialBackoff
+	attempt := 0
+	connected := func() {
+		backoff = h.initialBackoff
+		attempt = 0
+	}
+
+	for {
+		// Check if stopped or context cancelled
+		select {
+		case <-h.stopChan:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		err := stream(connected)
 
 		// If stream ended, check reason
 		if err == nil {
@@ -187,7 +347,7 @@ func (h *HorizonObserver) Start(ctx context.Context) error {
 		}
 
 		// Stream error - reconnect with backoff
-		fmt.Printf("observer: stream error (attempt %d): %v, reconnecting in %v\n", attempt, err, backoff)
+		fmt.Printf("observer: %s error (attempt %d): %v, reconnecting in %v\n", name, attempt, err, backoff)
 
 		// Wait for backoff period or until stopped
 		select {
@@ -228,6 +388,10 @@ func (h *HorizonObserver) convertToPaymentEvent(op operations.Operation) *Paymen
 		Cursor:          base.PT, // PT is the paging_token field
 		TransactionHash: base.TransactionHash,
 	}
+	if tx := base.Transaction; tx != nil && tx.MemoType != "none" {
+		evt.Memo = tx.Memo
+		evt.MemoType = stellarconnect.MemoType(tx.MemoType)
+	}
 
 	// Type-specific conversion
 	switch op.GetType() {
@@ -239,6 +403,8 @@ func (h *HorizonObserver) convertToPaymentEvent(op operations.Operation) *Paymen
 		}
 		evt.From = payment.From
 		evt.To = payment.To
+		evt.ToMuxed = payment.ToMuxed
+		evt.ToMuxedID = payment.ToMuxedID
 		evt.Amount = payment.Amount
 		evt.Asset = h.formatAsset(payment.Asset)
 
@@ -319,5 +485,28 @@ func (h *HorizonObserver) processEvent(evt PaymentEvent) {
 	}
 }
 
+// processTrustlineEvent runs all registered trustline handlers for the event.
+func (h *HorizonObserver) processTrustlineEvent(evt TrustlineEvent) {
+	h.mu.RLock()
+	handlers := h.trustHandlers
+	h.mu.RUnlock()
+
+	for _, handler := range handlers {
+		if err := handler(evt); err != nil {
+			// Log error but continue processing other handlers
+			fmt.Printf("observer: trustline handler error: %v\n", err)
+		}
+	}
+}
+
+// isZeroLimit reports whether a trustline limit is zero, i.e. the trustline
+// was removed.
+func isZeroLimit(limit string) bool {
+	return strings.Trim(limit, "0.") == ""
+}
+
 // Compile-time interface check
 var _ Observer = (*HorizonObserver)(nil)
+
+// Compile-time interface check
+var _ TrustlineObserver = (*HorizonObserver)(nil)
@@ -4,23 +4,30 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"slices"
 
+	"github.com/stellar/go-stellar-sdk/xdr"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
 	"github.com/marwen-abid/anchor-sdk-go/anchor"
 )
 
 // AutoMatchPayments automatically matches incoming Stellar payments to pending
-// withdrawals by extracting the transfer ID from the payment's memo field.
+// withdrawals by looking up the transfer that was assigned the payment's muxed
+// destination or, failing that, its memo.
 //
 // This function simplifies the common use case where:
-// 1. User initiates withdrawal, receives transfer ID
-// 2. User sends Stellar payment to anchor's distribution account with memo=transferID
+// 1. User initiates withdrawal, receives the anchor account and memo
+// 2. User sends Stellar payment to anchor's distribution account with that memo
 // 3. Observer detects payment and calls tm.NotifyPaymentReceived() automatically
 //
 // AutoMatchPayments registers a payment handler with the observer that:
-// - Filters for payments to the distribution account
-// - Extracts memo as the transfer ID
-// - Calls tm.NotifyPaymentReceived(ctx, transferID, details) on match
-// - Logs errors but does not crash on processing failures
+//   - Filters for payments to the distribution account
+//   - Resolves the transfer with tm.FindByMuxID(ctx, id) for payments to a
+//     muxed (M...) address, even when no memo is present
+//   - Otherwise resolves the transfer with tm.FindByMemo(ctx, memo, memoType)
+//   - Calls tm.NotifyPaymentReceived(ctx, transferID, details) on match
+//   - Logs errors but does not crash on processing failures
 //
 // The observer must already be configured with a cursor and handlers before
 // calling AutoMatchPayments. The registered handler will be called for each
@@ -56,15 +63,14 @@ func AutoMatchPayments(obs Observer, tm *anchor.TransferManager, distributionAcc
 				return nil
 			}
 
-			// Extract transfer ID from memo
-			transferID := evt.Memo
-			if transferID == "" {
-				log.Printf("Payment %s: received to distribution account but has no memo, skipping", evt.ID)
+			ctx := context.Background()
+			transfer, ok := resolveTransfer(ctx, tm, evt)
+			if !ok {
 				return nil
 			}
+			transferID := transfer.ID
 
 			// Call NotifyPaymentReceived to transition withdrawal
-			ctx := context.Background()
 			details := anchor.PaymentReceivedDetails{
 				StellarTxHash: evt.TransactionHash,
 				Amount:        evt.Amount,
@@ -85,3 +91,140 @@ func AutoMatchPayments(obs Observer, tm *anchor.TransferManager, distributionAcc
 
 	return nil
 }
+
+// resolveTransfer finds the withdrawal an incoming payment belongs to.
+// A muxed destination takes precedence over the memo.
+func resolveTransfer(ctx context.Context, tm *anchor.TransferManager, evt PaymentEvent) (*stellarconnect.Transfer, bool) {
+	if evt.ToMuxedID != 0 {
+		transfer, err := tm.FindByMuxID(ctx, evt.ToMuxedID)
+		if err == nil {
+			return transfer, true
+		}
+		if evt.Memo == "" {
+			log.Printf("Payment %s: no transfer for muxed destination %s, skipping", evt.ID, evt.ToMuxed)
+			return nil, false
+		}
+	}
+
+	if evt.Memo == "" {
+		log.Printf("Payment %s: received to distribution account but has no memo, skipping", evt.ID)
+		return nil, false
+	}
+
+	transfer, err := tm.FindByMemo(ctx, evt.Memo, evt.MemoType)
+	if err != nil {
+		log.Printf("Payment %s: no transfer for memo %q (%s), skipping", evt.ID, evt.Memo, evt.MemoType)
+		return nil, false
+	}
+	return transfer, true
+}
+
+// AutoResumeTrustlines resumes deposits waiting in pending_trust as soon as
+// the user's change_trust operation is streamed.
+//
+// It watches the trustlines of each account with a deposit in pending_trust:
+// those waiting when it is called, and those that enter pending_trust later,
+// as reported by hooks (the TransferManager's registry). An account is
+// unwatched once none of its deposits wait. For each added or updated
+// trustline it calls tm.ResumeTrustline(ctx, account, asset); the resumed
+// deposits move back to pending_stellar and are paid out by the
+// PayoutWorker on its next poll. Removed trustlines are ignored, and errors
+// are logged without stopping the stream.
+//
+// With an accounts fetcher, each account is also looked up once its watch
+// begins, resuming deposits whose trustline was added earlier, for example
+// while the anchor was down.
+//
+// Example usage:
+//
+//	obs := observer.NewHorizonObserver("https://horizon.stellar.org")
+//	fetcher := account.NewHorizonAccountFetcher("https://horizon.stellar.org")
+//	if err := observer.AutoResumeTrustlines(ctx, obs, tm, hooks, fetcher); err != nil {
+//	    log.Fatal(err)
+//	}
+//	obs.Start(ctx) // blocks until context cancelled
+func AutoResumeTrustlines(ctx context.Context, obs TrustlineObserver, tm *anchor.TransferManager, hooks *anchor.HookRegistry, accounts stellarconnect.AccountInfoFetcher) error {
+	if obs == nil {
+		return fmt.Errorf("observer is nil")
+	}
+	if tm == nil {
+		return fmt.Errorf("transfer manager is nil")
+	}
+	if hooks == nil {
+		return fmt.Errorf("hook registry is nil")
+	}
+
+	watch := func(ctx context.Context, account string) {
+		if err := obs.WatchTrustlines(account); err != nil {
+			log.Printf("Trustlines of %s: failed to watch: %v", account, err)
+			return
+		}
+		if accounts == nil {
+			return
+		}
+		// The trustline may have been added before the watch began.
+		resumed, err := tm.CheckTrustline(ctx, accounts, account)
+		if err != nil {
+			log.Printf("Trustlines of %s: failed to check waiting deposits: %v", account, err)
+		}
+		if resumed > 0 {
+			log.Printf("Trustlines of %s: resumed %d deposit(s)", account, resumed)
+		}
+	}
+
+	obs.OnChangeTrust(func(evt TrustlineEvent) error {
+		if evt.Removed {
+			return nil
+		}
+		resumed, err := tm.ResumeTrustline(context.Background(), evt.Account, evt.Asset)
+		if err != nil {
+			log.Printf("Trustline %s: failed to resume deposits for %s: %v", evt.ID, evt.Account, err)
+			return nil
+		}
+		if resumed > 0 {
+			log.Printf("Trustline %s: resumed %d deposit(s) to %s for %s", evt.ID, resumed, evt.Account, evt.Asset)
+		}
+		return nil
+	})
+
+	hooks.On(anchor.HookTransferStatusChanged, func(ctx context.Context, evt *anchor.HookEnvelope) error {
+		account, err := baseAccount(evt.Transfer.Account)
+		if err != nil {
+			return nil
+		}
+		if evt.Status == stellarconnect.StatusPendingTrust {
+			watch(ctx, account)
+			return nil
+		}
+		if evt.PreviousStatus != stellarconnect.StatusPendingTrust {
+			return nil
+		}
+		waiting, err := tm.TrustlineAccounts(ctx)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(waiting, account) {
+			obs.UnwatchTrustlines(account)
+		}
+		return nil
+	}, anchor.HookAsync(), anchor.HookKind(stellarconnect.KindDeposit))
+
+	waiting, err := tm.TrustlineAccounts(ctx)
+	if err != nil {
+		return err
+	}
+	for _, account := range waiting {
+		watch(ctx, account)
+	}
+	return nil
+}
+
+// baseAccount returns the G... account of a G... or muxed M... address.
+func baseAccount(address string) (string, error) {
+	muxed, err := xdr.AddressToMuxedAccount(address)
+	if err != nil {
+		return "", err
+	}
+	accountID := muxed.ToAccountId()
+	return accountID.Address(), nil
+}
@@ -31,6 +31,9 @@ package observer
 
 import (
 	"context"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/core/amount"
 )
 
 // PaymentEvent represents a Stellar payment operation that was streamed from Horizon.
@@ -45,15 +48,27 @@ type PaymentEvent struct {
 	// To is the destination account that received the payment (Stellar public key)
 	To string
 
+	// ToMuxed is the muxed (M...) destination address, if the payment was
+	// sent to one; To still holds the underlying G... account
+	ToMuxed string
+
+	// ToMuxedID is the mux ID of ToMuxed; 0 when the destination is not muxed
+	ToMuxedID uint64
+
 	// Asset is the asset code (e.g., "native" for XLM, "USDC:G..." for issued assets)
 	Asset string
 
 	// Amount is the payment amount as a string (e.g., "100.0000000")
 	Amount string
 
-	// Memo is the transaction memo (optional, may be empty)
+	// Memo is the transaction memo (optional, may be empty).
+	// Hash and return memos are standard base64 encoded.
 	Memo string
 
+	// MemoType is the type of Memo ("text", "id", "hash"); empty when the
+	// transaction has no memo
+	MemoType stellarconnect.MemoType
+
 	// Cursor is the paging_token for this payment, used for resumability
 	Cursor string
 
@@ -95,6 +110,53 @@ type Observer interface {
 	Stop() error
 }
 
+// TrustlineEvent represents a change_trust operation streamed from Horizon:
+// an account adding, updating or removing a trustline.
+type TrustlineEvent struct {
+	// ID is the unique operation ID from Horizon
+	ID string
+
+	// Account is the account whose trustline changed (the trustor)
+	Account string
+
+	// Asset is the trusted asset in "CODE:ISSUER" format
+	Asset string
+
+	// Limit is the new trustline limit; "0.0000000" when the trustline was removed
+	Limit string
+
+	// Removed reports whether the operation removed the trustline
+	Removed bool
+
+	// Cursor is the paging_token for this operation
+	Cursor string
+
+	// TransactionHash is the hash of the transaction containing this operation
+	TransactionHash string
+}
+
+// TrustlineHandler is a user-supplied function that processes a TrustlineEvent.
+// If the handler returns an error, the error is logged but streaming continues.
+type TrustlineHandler func(TrustlineEvent) error
+
+// TrustlineObserver is implemented by observers that can also watch
+// trustline changes, e.g. to resume deposits waiting in pending_trust.
+type TrustlineObserver interface {
+	Observer
+
+	// OnChangeTrust registers a handler for change_trust operations of the
+	// watched accounts.
+	OnChangeTrust(handler TrustlineHandler)
+
+	// WatchTrustlines starts watching the trustlines of account, a G...
+	// address. Changes made after the call are reported, including those
+	// made before Start. Watching an account twice has no effect.
+	WatchTrustlines(account string) error
+
+	// UnwatchTrustlines stops watching the trustlines of account.
+	UnwatchTrustlines(account string)
+}
+
 // Common filter constructors
 
 // WithAsset returns a PaymentFilter that matches payments of a specific asset.
@@ -106,14 +168,38 @@ func WithAsset(assetCode string) PaymentFilter {
 	}
 }
 
-// WithMinAmount returns a PaymentFilter that matches payments above a minimum amount.
-// The amount is compared as a string (lexicographic comparison works for decimal strings
-// with the same precision).
+// WithMinAmount returns a PaymentFilter that matches payments of at least minAmount.
+// Amounts are compared as exact decimals, so "9" is less than "10" regardless of
+// precision. Payments whose amount cannot be parsed never match, and an invalid
+// minAmount matches nothing.
 func WithMinAmount(minAmount string) PaymentFilter {
+	lower, lowerErr := amount.Parse(minAmount)
+	return func(evt PaymentEvent) bool {
+		if lowerErr != nil {
+			return false
+		}
+		got, err := amount.Parse(evt.Amount)
+		if err != nil {
+			return false
+		}
+		return !got.LessThan(lower)
+	}
+}
+
+// WithMaxAmount returns a PaymentFilter that matches payments of at most maxAmount.
+// Payments whose amount cannot be parsed never match, and an invalid maxAmount
+// matches nothing.
+func WithMaxAmount(maxAmount string) PaymentFilter {
+	upper, upperErr := amount.Parse(maxAmount)
 	return func(evt PaymentEvent) bool {
-		// Simple string comparison - works for amounts with same precision
-		// Production implementation might parse to decimal for accurate comparison
-		return evt.Amount >= minAmount
+		if upperErr != nil {
+			return false
+		}
+		got, err := amount.Parse(evt.Amount)
+		if err != nil {
+			return false
+		}
+		return !got.GreaterThan(upper)
 	}
 }
 
@@ -139,7 +139,8 @@ func (t *TransferProcess) isTerminal() bool {
 		stellarconnect.StatusFailed,
 		stellarconnect.StatusDenied,
 		stellarconnect.StatusCancelled,
-		stellarconnect.StatusExpired:
+		stellarconnect.StatusExpired,
+		stellarconnect.StatusRefunded:
 		return true
 	default:
 		return false
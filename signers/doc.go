@@ -7,4 +7,6 @@
 //     Allows you to delegate signing to any external infrastructure.
 //
 // Both return implementations of the stellarconnect.Signer interface.
+// CallbackSignerFromSecret returns a stellarconnect.CallbackSigner for signing
+// wallet callbacks with the anchor's SIGNING_KEY.
 package signers
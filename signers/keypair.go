@@ -32,16 +32,25 @@ func (s *keypairSigner) PublicKey() string {
 
 // SignTransaction signs a Stellar transaction envelope (base64 XDR).
 // It parses the XDR, signs the transaction hash with the keypair, and returns
-// the signed envelope as base64 XDR.
+// the signed envelope as base64 XDR. Fee-bump envelopes are signed on the
+// outer transaction, as required of the fee account.
 func (s *keypairSigner) SignTransaction(ctx context.Context, xdr string, networkPassphrase string) (string, error) {
 	parsed, err := txnbuild.TransactionFromXDR(xdr)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse transaction XDR: %w", err)
 	}
 
+	if feeBump, ok := parsed.FeeBump(); ok {
+		signedFeeBump, err := feeBump.Sign(networkPassphrase, s.kp)
+		if err != nil {
+			return "", fmt.Errorf("failed to sign fee-bump transaction: %w", err)
+		}
+		return signedFeeBump.Base64()
+	}
+
 	tx, ok := parsed.Transaction()
 	if !ok {
-		return "", fmt.Errorf("expected a Transaction, got a FeeBumpTransaction")
+		return "", fmt.Errorf("unsupported transaction envelope")
 	}
 
 	signedTx, err := tx.Sign(networkPassphrase, s.kp)
@@ -51,3 +60,28 @@ func (s *keypairSigner) SignTransaction(ctx context.Context, xdr string, network
 
 	return signedTx.Base64()
 }
+
+// keypairCallbackSigner signs wallet callbacks with a stellar/go keypair.
+type keypairCallbackSigner struct {
+	kp *keypair.Full
+}
+
+// CallbackSignerFromSecret creates a CallbackSigner from the anchor's
+// SIGNING_KEY secret (S...), for anchor.CallbackNotifier.
+// Returns an error if the secret key is invalid.
+func CallbackSignerFromSecret(secret string) (stellarconnect.CallbackSigner, error) {
+	kp, err := keypair.ParseFull(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key: %w", err)
+	}
+	return &keypairCallbackSigner{kp: kp}, nil
+}
+
+// SignCallback signs payload with the keypair.
+func (s *keypairCallbackSigner) SignCallback(ctx context.Context, payload []byte) ([]byte, error) {
+	signature, err := s.kp.Sign(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign callback: %w", err)
+	}
+	return signature, nil
+}
@@ -6,7 +6,11 @@ package stellarconnect
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
+
+	"github.com/marwen-abid/anchor-sdk-go/core/amount"
 )
 
 // Signer is the minimal contract for proving identity and authorizing actions.
@@ -30,6 +34,13 @@ type MessageSigner interface {
 	SignMessage(ctx context.Context, message string) (string, error)
 }
 
+// CallbackSigner signs the requests an anchor sends to wallet callback URLs
+// (SEP-24 on_change_callback) with the anchor's SIGNING_KEY.
+type CallbackSigner interface {
+	// SignCallback returns the raw Ed25519 signature of payload.
+	SignCallback(ctx context.Context, payload []byte) ([]byte, error)
+}
+
 // TransferStore is the persistence interface for transfer records.
 // The SDK calls these methods internally during state transitions.
 // The developer implements this interface against their own database.
@@ -52,49 +63,318 @@ type TransferStore interface {
 	List(ctx context.Context, filters TransferFilters) ([]*Transfer, error)
 }
 
+// VersionedTransferStore is an optional extension for TransferStore.
+// If a TransferStore also implements VersionedTransferStore, the SDK applies
+// updates as compare-and-swap operations on Transfer.Version, so concurrent
+// writers (including separate processes) cannot overwrite each other.
+type VersionedTransferStore interface {
+	TransferStore
+
+	// CompareAndUpdate applies the update only if the stored transfer's
+	// Version equals expectedVersion, and increments Version on success.
+	// Returns a *VersionConflictError if the versions differ.
+	CompareAndUpdate(ctx context.Context, id string, expectedVersion int64, update *TransferUpdate) error
+}
+
+// VersionConflictError is returned by VersionedTransferStore.CompareAndUpdate
+// when the transfer was modified since it was read.
+type VersionConflictError struct {
+	TransferID string
+	Expected   int64
+	Actual     int64
+}
+
+// Error returns a description of the conflicting versions.
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("transfer %s version conflict: expected %d, found %d", e.TransferID, e.Expected, e.Actual)
+}
+
+// IsVersionConflict reports whether err is or wraps a *VersionConflictError.
+func IsVersionConflict(err error) bool {
+	var conflict *VersionConflictError
+	return errors.As(err, &conflict)
+}
+
+// OutboxEvent is a lifecycle event persisted together with the transfer
+// change that produced it, for at-least-once delivery.
+type OutboxEvent struct {
+	ID             string
+	Event          string // Hook event name, e.g. "transfer:status_changed"
+	TransferID     string
+	Transfer       Transfer // Snapshot of the transfer after the change
+	CreatedAt      time.Time
+	PreviousStatus TransferStatus // Status before the change; empty for creation
+	Changes        []FieldChange  // Fields the change modified, excluding status
+	Actor          Actor          // Who made the change
+	CorrelationID  string         // Shared by the events of one change
+	Attempts       int            // Delivery attempts so far
+	LastError      string         // Error from the most recent failed attempt
+	NextAttemptAt  time.Time      // Earliest time of the next attempt; zero for now
+	DeliveredAt    *time.Time     // Set once delivered; nil while pending
+	DeadAt         *time.Time     // Set once retries are exhausted; no longer retried
+}
+
+// OutboxStore is an optional extension for TransferStore implementing the
+// transactional outbox pattern: transfer writes and the events they produce
+// are committed atomically, so a crash between the write and hook delivery
+// cannot lose events.
+type OutboxStore interface {
+	TransferStore
+
+	// SaveWithEvents persists a new transfer and its events atomically.
+	// The store assigns event IDs and fills each event's Transfer snapshot.
+	SaveWithEvents(ctx context.Context, transfer *Transfer, events []OutboxEvent) error
+
+	// UpdateWithEvents applies the update and appends the events atomically.
+	// If expectedVersion is non-zero the update is a compare-and-swap, as in
+	// VersionedTransferStore. The store assigns event IDs and fills each
+	// event's Transfer snapshot with the updated transfer.
+	UpdateWithEvents(ctx context.Context, id string, expectedVersion int64, update *TransferUpdate, events []OutboxEvent) error
+
+	// PendingEvents returns up to limit events that are neither delivered nor
+	// dead and whose NextAttemptAt has passed, oldest first. A transfer's
+	// events queued behind one that is still backing off are left out, so
+	// each transfer's events stay in order. A limit of zero or less returns
+	// all of them.
+	PendingEvents(ctx context.Context, limit int) ([]OutboxEvent, error)
+
+	// MarkDelivered records that an event was delivered, clearing any
+	// dead-letter mark.
+	MarkDelivered(ctx context.Context, eventID string) error
+
+	// MarkFailed records a failed delivery attempt; the event stays pending
+	// and is not returned by PendingEvents before nextAttemptAt.
+	MarkFailed(ctx context.Context, eventID string, reason string, nextAttemptAt time.Time) error
+
+	// MarkDead records a final failed attempt and moves the event to the
+	// dead-letter state, where it is kept but no longer retried.
+	MarkDead(ctx context.Context, eventID string, reason string) error
+
+	// PruneEvents removes delivered and dead events that were finalized
+	// before the given time and returns how many were removed.
+	PruneEvents(ctx context.Context, before time.Time) (int, error)
+
+	// ListEvents returns all events for a transfer, delivered or not,
+	// oldest first.
+	ListEvents(ctx context.Context, transferID string) ([]OutboxEvent, error)
+}
+
+// ActorType identifies the kind of party that changed a transfer.
+type ActorType string
+
+const (
+	// ActorSystem is the SDK itself or background workers (the default).
+	ActorSystem ActorType = "system"
+
+	// ActorOperator is a human operator, e.g. through an admin API.
+	ActorOperator ActorType = "operator"
+
+	// ActorWebhook is an external system notifying the anchor via webhook.
+	ActorWebhook ActorType = "webhook"
+)
+
+// Actor is the party responsible for a transfer change.
+type Actor struct {
+	Type ActorType
+	ID   string // Operator identity or webhook source; empty for the system
+}
+
+// FieldChange is a single field modified by a transfer update.
+// Values are rendered as strings; metadata keys appear as "metadata.<key>".
+type FieldChange struct {
+	Field string
+	From  string
+	To    string
+}
+
+// HistoryEntry is an append-only audit record of one change to a transfer.
+type HistoryEntry struct {
+	ID         string
+	TransferID string
+	FromStatus TransferStatus // Empty for the entry recording creation
+	ToStatus   TransferStatus // Equal to FromStatus for updates without a transition
+	Actor      Actor
+	Reason     string
+	Changes    []FieldChange
+	CreatedAt  time.Time
+}
+
+// HistoryStore is an optional extension for TransferStore.
+// If a TransferStore also implements HistoryStore, the SDK records a history
+// entry for every transfer creation, transition, and update.
+type HistoryStore interface {
+	TransferStore
+
+	// AppendHistory records a history entry. Entries are never modified or
+	// deleted. The store assigns the entry ID.
+	AppendHistory(ctx context.Context, entry HistoryEntry) error
+
+	// History returns the entries for a transfer, oldest first.
+	History(ctx context.Context, transferID string) ([]HistoryEntry, error)
+}
+
+// AtomicHistoryStore is an optional extension for HistoryStore. If a store
+// implements it, the SDK commits each transfer change together with its
+// history entry, and with its outbox events when Config.Outbox is enabled, so
+// none of them is visible without the others.
+type AtomicHistoryStore interface {
+	HistoryStore
+
+	// SaveWithHistory persists a new transfer, its history entry, and any
+	// events atomically. Events are filled in as by
+	// OutboxStore.SaveWithEvents.
+	SaveWithHistory(ctx context.Context, transfer *Transfer, entry HistoryEntry, events []OutboxEvent) error
+
+	// UpdateWithHistory applies the update and appends the history entry
+	// and any events atomically. If expectedVersion is non-zero the update
+	// is a compare-and-swap, as in VersionedTransferStore.
+	UpdateWithHistory(ctx context.Context, id string, expectedVersion int64, update *TransferUpdate, entry HistoryEntry, events []OutboxEvent) error
+}
+
+// Note is an internal comment by an operator on a transfer. Notes are never
+// shown to users.
+type Note struct {
+	ID         string
+	TransferID string
+	Author     string // Operator who wrote the note
+	Body       string
+	CreatedAt  time.Time
+}
+
+// NoteStore is an optional extension for TransferStore that keeps operator
+// notes on transfers.
+type NoteStore interface {
+	TransferStore
+
+	// AddNote stores a note on an existing transfer and returns it with the
+	// ID and CreatedAt assigned by the store.
+	AddNote(ctx context.Context, note Note) (*Note, error)
+
+	// Notes returns the notes on a transfer, oldest first.
+	Notes(ctx context.Context, transferID string) ([]Note, error)
+}
+
+// PayoutState is a payout worker's progress on one deposit. It is kept apart
+// from the transfer so the signed envelope never appears in transfer
+// metadata, history, hooks, or webhooks.
+type PayoutState struct {
+	TransferID string
+	TxHash     string    // Hash of the pending transaction
+	Envelope   string    // Signed envelope of the pending transaction, possibly fee-bumped
+	ExpiresAt  time.Time // Max time of the pending transaction
+	OpIndex    int       // Transfer's operation in the pending transaction; non-zero in batches
+	Channel    string    // Channel account the pending transaction uses, if any
+	Claimable  bool      // Pay a claimable balance instead of a payment
+	Error      string    // Why the payout is held; empty unless held
+	UpdatedAt  time.Time
+}
+
+// PayoutStore keeps payout worker state per transfer.
+type PayoutStore interface {
+	// FindPayout returns the payout state of a transfer, or nil if it has
+	// none.
+	FindPayout(ctx context.Context, transferID string) (*PayoutState, error)
+
+	// SavePayout creates or replaces the payout state of a transfer.
+	SavePayout(ctx context.Context, state *PayoutState) error
+
+	// DeletePayout removes the payout state of a transfer, if any.
+	DeletePayout(ctx context.Context, transferID string) error
+}
+
+// MemoTransferStore is an optional extension for TransferStore.
+// If a TransferStore also implements MemoTransferStore, the SDK resolves
+// incoming payments through the memo index instead of scanning List results.
+type MemoTransferStore interface {
+	TransferStore
+
+	// FindByMemo retrieves the transfer that was assigned the given memo.
+	// An empty memoType matches any memo type.
+	FindByMemo(ctx context.Context, memo string, memoType MemoType) (*Transfer, error)
+}
+
+// MuxedTransferStore is an optional extension for TransferStore.
+// If a TransferStore also implements MuxedTransferStore, the SDK resolves
+// payments to muxed (M...) addresses through the mux ID index instead of
+// scanning List results.
+type MuxedTransferStore interface {
+	TransferStore
+
+	// FindByMuxID retrieves the transfer that was assigned the given mux ID.
+	FindByMuxID(ctx context.Context, muxID uint64) (*Transfer, error)
+}
+
+// ExternalRefTransferStore is an optional extension for TransferStore.
+// If a TransferStore also implements ExternalRefTransferStore, the SDK
+// resolves rail orders through the external reference index instead of
+// scanning List results.
+type ExternalRefTransferStore interface {
+	TransferStore
+
+	// FindByExternalRef retrieves the transfer most recently assigned the
+	// given external reference.
+	FindByExternalRef(ctx context.Context, ref string) (*Transfer, error)
+}
+
 // Transfer is the canonical transfer record.
 type Transfer struct {
-	ID               string
-	Kind             TransferKind   // "deposit" | "withdrawal"
-	Mode             TransferMode   // "interactive" | "api"
-	Status           TransferStatus // Set by SDK state machine, never by developer
-	AssetCode        string
-	AssetIssuer      string
-	Account          string // Stellar account
-	Amount           string // Decimal string
-	InteractiveToken string // One-time token for interactive flows
-	InteractiveURL   string
-	ExternalRef      string // Banking/payment reference
-	StellarTxHash    string // On-chain transaction hash
-	Message          string // Human-readable status message
-	Metadata         map[string]any
-	CreatedAt        time.Time
-	UpdatedAt        time.Time
-	CompletedAt      *time.Time
+	ID                        string
+	Kind                      TransferKind   // "deposit" | "withdrawal"
+	Mode                      TransferMode   // "interactive" | "api"
+	Status                    TransferStatus // Set by SDK state machine, never by developer
+	AssetCode                 string
+	AssetIssuer               string
+	Account                   string        // Stellar account
+	Amount                    amount.Amount // Zero if the user has not entered one
+	AmountReceived            amount.Amount // Total of the Stellar payments received so far; zero if none was reported
+	InteractiveToken          string        // One-time token for interactive flows
+	InteractiveURL            string
+	ExternalRef               string // Banking/payment reference
+	StellarTxHash             string // On-chain transaction hash
+	Memo                      string // Anchor-assigned memo the user attaches to their Stellar payment
+	MemoType                  MemoType
+	MuxID                     uint64 // Anchor-assigned mux ID when the user pays a muxed (M...) address; 0 if unused
+	DepositMemo               string // Memo the anchor attaches to its deposit payment to the user
+	DepositMemoType           MemoType
+	ClaimableBalanceSupported bool   // Wallet accepts a claimable balance when Account lacks a trustline
+	ClaimableBalanceID        string // Set when the deposit was paid as a claimable balance
+	OnChangeCallback          string // Wallet URL notified of status changes (SEP-24 on_change_callback)
+	Message                   string // Human-readable status message
+	Metadata                  map[string]any
+	Version                   int64 // Incremented by the store on every update; used for optimistic concurrency
+	CreatedAt                 time.Time
+	UpdatedAt                 time.Time
+	CompletedAt               *time.Time
 }
 
 // TransferUpdate contains the mutable fields for a transfer update.
 // Only non-zero-value fields are applied. Status is always set by the SDK.
 type TransferUpdate struct {
-	Status           *TransferStatus
-	Amount           *string
-	ExternalRef      *string
-	StellarTxHash    *string
-	InteractiveToken *string
-	InteractiveURL   *string
-	Message          *string
-	Metadata         map[string]any
-	CompletedAt      *time.Time
+	Status             *TransferStatus
+	Amount             *amount.Amount
+	AmountReceived     *amount.Amount
+	AssetCode          *string
+	AssetIssuer        *string
+	ExternalRef        *string
+	StellarTxHash      *string
+	ClaimableBalanceID *string
+	InteractiveToken   *string
+	InteractiveURL     *string
+	Message            *string
+	Metadata           map[string]any
+	CompletedAt        *time.Time
 }
 
 // TransferFilters for listing transfers.
 type TransferFilters struct {
-	Account   string
-	AssetCode string
-	Status    *TransferStatus
-	Kind      *TransferKind
-	Limit     int
-	Offset    int
+	Account       string
+	AssetCode     string
+	Status        *TransferStatus
+	Kind          *TransferKind
+	CreatedAfter  time.Time // Optional: only transfers created at or after this time
+	CreatedBefore time.Time // Optional: only transfers created before this time
+	Limit         int
+	Offset        int
 }
 
 // TransferStatus represents the current state in the transfer lifecycle.
@@ -118,6 +398,10 @@ const (
 	// StatusPendingStellar means the on-chain Stellar transaction is in progress.
 	StatusPendingStellar TransferStatus = "pending_stellar"
 
+	// StatusPendingTrust means the deposit is waiting for the user to add a
+	// trustline for the asset before it can be paid out.
+	StatusPendingTrust TransferStatus = "pending_trust"
+
 	// StatusPaymentRequired means the user must send a Stellar payment to proceed.
 	StatusPaymentRequired TransferStatus = "payment_required"
 
@@ -138,9 +422,27 @@ const (
 	// StatusExpired is a terminal state indicating the transfer timed out
 	// before completion.
 	StatusExpired TransferStatus = "expired"
+
+	// StatusRefunded is a terminal state indicating the funds received for
+	// the transfer were returned to the user.
+	StatusRefunded TransferStatus = "refunded"
+)
+
+// MemoType identifies the kind of Stellar transaction memo.
+type MemoType string
+
+const (
+	// MemoTypeText is a UTF-8 text memo of at most 28 bytes.
+	MemoTypeText MemoType = "text"
+
+	// MemoTypeID is an unsigned 64-bit integer memo, encoded as a decimal string.
+	MemoTypeID MemoType = "id"
+
+	// MemoTypeHash is a 32-byte hash memo, encoded as standard base64.
+	MemoTypeHash MemoType = "hash"
 )
 
-// TransferKind distinguishes deposits from withdrawals.
+// TransferKind distinguishes deposits, withdrawals, and SEP-31 receives.
 type TransferKind string
 
 const (
@@ -149,6 +451,10 @@ const (
 
 	// KindWithdrawal represents an on-chain to off-chain transfer.
 	KindWithdrawal TransferKind = "withdrawal"
+
+	// KindReceive represents a SEP-31 payment: a sending anchor pays the
+	// asset on Stellar and the receiving anchor pays the receiver off-chain.
+	KindReceive TransferKind = "receive"
 )
 
 // TransferMode distinguishes interactive flows from direct API calls.
@@ -174,6 +480,56 @@ type NonceStore interface {
 	Consume(ctx context.Context, nonce string) (bool, error)
 }
 
+// Locker provides mutual exclusion for per-transfer critical sections.
+// Implementations backed by shared storage let several anchor processes
+// coordinate, so a webhook handler and the observer never process the same
+// transfer at once.
+type Locker interface {
+	// Acquire blocks until the lock for key is held or ctx is done.
+	// The lock is held until the lease is released or ttl elapses, whichever
+	// comes first, so a crashed holder cannot block others forever.
+	Acquire(ctx context.Context, key string, ttl time.Duration) (Lease, error)
+}
+
+// Lease is a held lock returned by Locker.Acquire.
+type Lease interface {
+	// Extend pushes the lease expiry to ttl from now.
+	// Returns an error if the lease has already expired or been taken over.
+	Extend(ctx context.Context, ttl time.Duration) error
+
+	// Release gives up the lock. Releasing an expired lease is a no-op.
+	Release(ctx context.Context) error
+}
+
+// IdempotencyRecord is the state stored for an idempotency key.
+type IdempotencyRecord struct {
+	Key         string
+	Fingerprint string     // Hash of the request parameters the key was first used with
+	ResourceID  string     // ID of the resource created for the key, if any
+	CompletedAt *time.Time // Set by Complete; nil while the request is in progress
+	ExpiresAt   time.Time  // Record is discarded after this time
+}
+
+// IdempotencyStore tracks idempotency keys so retried requests return the
+// original result instead of creating duplicates.
+type IdempotencyStore interface {
+	// Reserve claims a key for a new request. If the key is not held (or has
+	// expired), it is stored with the fingerprint and Reserve returns
+	// (nil, true, nil). Otherwise the existing record is returned with false.
+	// expiresAt is the in-progress lease: a request that neither completes
+	// nor releases the key by then, e.g. because it crashed, gives it up.
+	Reserve(ctx context.Context, key, fingerprint string, expiresAt time.Time) (*IdempotencyRecord, bool, error)
+
+	// Complete marks a reserved key as done, records the ID of the resource
+	// created for it, which may be empty, and keeps the record until
+	// expiresAt.
+	Complete(ctx context.Context, key, resourceID string, expiresAt time.Time) error
+
+	// Release removes a reserved key, e.g. after the request failed, so it
+	// can be retried.
+	Release(ctx context.Context, key string) error
+}
+
 // JWTIssuer creates authentication tokens after successful SEP-10 verification.
 type JWTIssuer interface {
 	Issue(ctx context.Context, claims JWTClaims) (string, error)
@@ -217,6 +573,130 @@ type AccountFetcher interface {
 	FetchSigners(ctx context.Context, accountID string) ([]AccountSigner, AccountThresholds, error)
 }
 
+// AccountInfo is the state of a Stellar account as seen by an
+// AccountInfoFetcher.
+type AccountInfo struct {
+	AccountID string
+	Sequence  int64
+	Balances  []AccountBalance
+}
+
+// AccountBalance is the account's native balance or one of its trustlines.
+type AccountBalance struct {
+	Asset      string // "native" or "CODE:ISSUER"
+	Balance    string
+	Limit      string // empty for native
+	Authorized bool   // the issuer allows the account to receive the asset; always true for native
+}
+
+// HasTrustline reports whether the account can receive the asset, given as
+// "native" or "CODE:ISSUER": it holds an authorized trustline for it, or the
+// asset is native.
+func (a *AccountInfo) HasTrustline(asset string) bool {
+	if asset == "native" {
+		return true
+	}
+	for _, b := range a.Balances {
+		if b.Asset == asset {
+			return b.Authorized
+		}
+	}
+	return false
+}
+
+// AccountInfoFetcher is an optional extension of AccountFetcher for looking
+// up an account's balances and trustlines. The SDK uses it to decide whether
+// a deposit can be paid out or must wait in pending_trust.
+type AccountInfoFetcher interface {
+	// FetchAccountInfo returns the account's sequence number and balances.
+	// Returns (nil, nil) if the account does not exist.
+	FetchAccountInfo(ctx context.Context, accountID string) (*AccountInfo, error)
+}
+
+// TransactionSubmitter submits signed transactions to the Stellar network
+// and looks up their outcome. Implementations may use Horizon, Stellar RPC,
+// or a fake for tests.
+type TransactionSubmitter interface {
+	// SubmitTransaction submits a signed envelope (base64 XDR) and waits for
+	// it to be included in a ledger. Returns a *SubmitError if the network
+	// rejected the transaction; any other error (e.g. a timeout) leaves the
+	// outcome unknown, and the transaction may still be applied.
+	SubmitTransaction(ctx context.Context, envelopeXDR string) (*SubmitResult, error)
+
+	// TransactionStatus looks up a transaction by hash. Returns (nil, nil)
+	// if the network has no record of it.
+	TransactionStatus(ctx context.Context, hash string) (*SubmitResult, error)
+
+	// SequenceNumber returns the current sequence number of an account.
+	SequenceNumber(ctx context.Context, accountID string) (int64, error)
+}
+
+// SubmitResult describes a transaction included in a ledger.
+type SubmitResult struct {
+	Hash       string
+	Ledger     int32
+	Successful bool
+}
+
+// SubmitError is returned when the network rejects a transaction.
+// TransactionCode and OperationCodes are the Stellar result codes,
+// e.g. "tx_bad_seq" or "tx_failed" with ["op_no_trust"].
+type SubmitError struct {
+	TransactionCode string
+	OperationCodes  []string
+	Err             error
+}
+
+// Error returns the result codes of the rejected transaction.
+func (e *SubmitError) Error() string {
+	msg := fmt.Sprintf("transaction rejected: %s", e.TransactionCode)
+	if len(e.OperationCodes) > 0 {
+		msg += fmt.Sprintf(" %v", e.OperationCodes)
+	}
+	if e.Err != nil {
+		msg += fmt.Sprintf(" (%v)", e.Err)
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error.
+func (e *SubmitError) Unwrap() error {
+	return e.Err
+}
+
+// HasOperationCode reports whether any operation failed with code.
+func (e *SubmitError) HasOperationCode(code string) bool {
+	for _, c := range e.OperationCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// FeeStats summarizes the fees bid by transactions in recent ledgers, in
+// stroops per operation.
+type FeeStats struct {
+	LastLedgerBaseFee   int64
+	LedgerCapacityUsage float64       // Fraction of recent ledger capacity used; surge pricing applies near 1
+	MaxFee              map[int]int64 // Percentile (10, 20, ..., 90, 95, 99) -> max fee bid
+}
+
+// FeeStatsSource reports recent network fees. TransactionSubmitter
+// implementations usually implement it too.
+type FeeStatsSource interface {
+	FeeStats(ctx context.Context) (*FeeStats, error)
+}
+
+// AsSubmitError returns the *SubmitError in err's chain, if any.
+func AsSubmitError(err error) (*SubmitError, bool) {
+	var submitErr *SubmitError
+	if errors.As(err, &submitErr) {
+		return submitErr, true
+	}
+	return nil, false
+}
+
 // PaymentEvent represents an incoming or outgoing Stellar payment
 // detected by the Observer.
 type PaymentEvent struct {
@@ -226,6 +706,7 @@ type PaymentEvent struct {
 	Asset           string
 	Amount          string
 	Memo            string
+	MemoType        MemoType
 	Cursor          string
 	TransactionHash string
 }
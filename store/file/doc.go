@@ -0,0 +1,8 @@
+// Package file provides filesystem-backed storage implementations.
+//
+// The Locker coordinates several anchor processes that share a directory,
+// such as replicas on one host or containers mounting the same volume. The
+// TransferStore keeps transfers, their history, notes, and outbox events in
+// a directory that the anchor and operator tools such as anchorctl can open
+// at the same time.
+package file
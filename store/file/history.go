@@ -0,0 +1,65 @@
+package file
+
+import (
+	"context"
+	"fmt"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+)
+
+// AppendHistory records a history entry for a transfer.
+// Entries are kept in insertion order and never modified.
+func (s *TransferStore) AppendHistory(ctx context.Context, entry stellarconnect.HistoryEntry) error {
+	return s.update(ctx, func(d *data) error {
+		appendHistory(d, entry)
+		return nil
+	})
+}
+
+// SaveWithHistory persists a new transfer with its history entry and outbox
+// events in a single write of the data file.
+func (s *TransferStore) SaveWithHistory(ctx context.Context, transfer *stellarconnect.Transfer, entry stellarconnect.HistoryEntry, events []stellarconnect.OutboxEvent) error {
+	return s.update(ctx, func(d *data) error {
+		if err := saveTransfer(d, transfer); err != nil {
+			return err
+		}
+		appendHistory(d, entry)
+		appendEvents(d, d.Transfers[transfer.ID], events)
+		return nil
+	})
+}
+
+// UpdateWithHistory applies the update and appends the history entry and
+// outbox events in a single write. A non-zero expectedVersion makes the
+// update a compare-and-swap.
+func (s *TransferStore) UpdateWithHistory(ctx context.Context, id string, expectedVersion int64, update *stellarconnect.TransferUpdate, entry stellarconnect.HistoryEntry, events []stellarconnect.OutboxEvent) error {
+	return s.update(ctx, func(d *data) error {
+		transfer, err := compareAndUpdate(d, id, expectedVersion, update)
+		if err != nil {
+			return err
+		}
+		appendHistory(d, entry)
+		appendEvents(d, transfer, events)
+		return nil
+	})
+}
+
+// appendHistory assigns the entry an ID and adds it to d.
+func appendHistory(d *data, entry stellarconnect.HistoryEntry) {
+	d.HistorySeq++
+	entry.ID = fmt.Sprintf("hist_%d", d.HistorySeq)
+	d.History[entry.TransferID] = append(d.History[entry.TransferID], entry)
+}
+
+// History returns the entries for a transfer, oldest first.
+// Returns an empty slice if the transfer has no history.
+func (s *TransferStore) History(ctx context.Context, transferID string) ([]stellarconnect.HistoryEntry, error) {
+	d, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return append([]stellarconnect.HistoryEntry{}, d.History[transferID]...), nil
+}
+
+// Verify that TransferStore implements stellarconnect.AtomicHistoryStore
+var _ stellarconnect.AtomicHistoryStore = (*TransferStore)(nil)
@@ -0,0 +1,255 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	corecrypto "github.com/marwen-abid/anchor-sdk-go/core/crypto"
+)
+
+const (
+	lockFileSuffix = ".lock"
+	takeoverSuffix = ".takeover"
+
+	// staleGuardAge is how old a takeover guard must be before it is treated
+	// as abandoned.
+	staleGuardAge = 10 * time.Second
+
+	// defaultPollInterval is how often Acquire re-checks a held lock.
+	defaultPollInterval = 50 * time.Millisecond
+)
+
+// lockRecord is the content of a lock file.
+type lockRecord struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Locker is a filesystem-backed implementation of stellarconnect.Locker.
+// Each held lock is a file in the lock directory, created atomically with
+// O_EXCL. Lock files are removed on release; expired ones are taken over by
+// the next caller, so a crashed process cannot block others beyond its TTL.
+type Locker struct {
+	dir          string
+	pollInterval time.Duration
+}
+
+// NewLocker creates a locker that keeps lock files in dir, creating the
+// directory if needed.
+func NewLocker(dir string) (*Locker, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	return &Locker{dir: dir, pollInterval: defaultPollInterval}, nil
+}
+
+// Acquire blocks until the lock for key is held or ctx is done.
+func (l *Locker) Acquire(ctx context.Context, key string, ttl time.Duration) (stellarconnect.Lease, error) {
+	token, err := corecrypto.GenerateNonce(16)
+	if err != nil {
+		return nil, err
+	}
+	path := l.path(key)
+
+	for {
+		acquired, err := l.tryAcquire(path, token, ttl)
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			return &lease{path: path, token: token}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(l.pollInterval):
+		}
+	}
+}
+
+// tryAcquire creates the lock file, removing it first if the current holder's
+// lease has expired.
+func (l *Locker) tryAcquire(path, token string, ttl time.Duration) (bool, error) {
+	created, err := createLockFile(path, lockRecord{Token: token, ExpiresAt: time.Now().Add(ttl)})
+	if err != nil || created {
+		return created, err
+	}
+
+	current, err := readLockFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil // released in between; retry
+	}
+	if err != nil {
+		return false, err
+	}
+	if time.Now().After(current.ExpiresAt) {
+		removeStale(path, current.Token)
+	}
+	return false, nil
+}
+
+// removeStale removes an expired lock file. The guard file serializes
+// takeovers so two waiters cannot both remove the lock, where the second
+// would delete the fresh lock created by the first. If another process holds
+// the guard, the takeover is left to it.
+func removeStale(path, staleToken string) {
+	if !tryGuard(path) {
+		return
+	}
+	defer releaseGuard(path)
+
+	current, err := readLockFile(path)
+	if err == nil && current.Token == staleToken && time.Now().After(current.ExpiresAt) {
+		_ = os.Remove(path)
+	}
+}
+
+// tryGuard creates the guard file of a lock, which every change to an
+// existing lock file is made under. Returns false if another process holds
+// it.
+func tryGuard(path string) bool {
+	guard := path + takeoverSuffix
+	if info, err := os.Stat(guard); err == nil && time.Since(info.ModTime()) > staleGuardAge {
+		_ = os.Remove(guard) // left behind by a crashed process
+	}
+	f, err := os.OpenFile(guard, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// waitGuard takes the guard file of a lock, waiting while another process
+// holds it, until ctx is done.
+func waitGuard(ctx context.Context, path string) error {
+	for !tryGuard(path) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(defaultPollInterval):
+		}
+	}
+	return nil
+}
+
+func releaseGuard(path string) {
+	_ = os.Remove(path + takeoverSuffix)
+}
+
+// path maps a key to a lock file name that is safe on any filesystem.
+func (l *Locker) path(key string) string {
+	return filepath.Join(l.dir, url.PathEscape(key)+lockFileSuffix)
+}
+
+// lease is a lock file held by a Locker, identified by a random token so an
+// expired holder cannot release or extend a lock that was taken over.
+type lease struct {
+	path  string
+	token string
+}
+
+// Extend pushes the lease expiry to ttl from now.
+// Returns an error if the lease expired or was taken over. The check and the
+// write are made under the lock's guard file, so a takeover cannot happen in
+// between.
+func (le *lease) Extend(ctx context.Context, ttl time.Duration) error {
+	if err := waitGuard(ctx, le.path); err != nil {
+		return err
+	}
+	defer releaseGuard(le.path)
+
+	current, err := readLockFile(le.path)
+	if err != nil || current.Token != le.token || time.Now().After(current.ExpiresAt) {
+		return errors.New("lease expired")
+	}
+	return writeLockFile(le.path, lockRecord{Token: le.token, ExpiresAt: time.Now().Add(ttl)})
+}
+
+// Release removes the lock file if this lease still holds it.
+// Releasing an expired or taken-over lease is a no-op. The check and the
+// removal are made under the lock's guard file, so Release cannot delete a
+// lock a new holder created after a takeover. It waits for the guard even if
+// ctx is cancelled, for at most staleGuardAge, so that a cancelled caller
+// does not leave the lock held until it expires.
+func (le *lease) Release(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), staleGuardAge)
+	defer cancel()
+	if err := waitGuard(ctx, le.path); err != nil {
+		return err
+	}
+	defer releaseGuard(le.path)
+
+	current, err := readLockFile(le.path)
+	if err != nil || current.Token != le.token {
+		return nil
+	}
+	if err := os.Remove(le.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove lock file: %w", err)
+	}
+	return nil
+}
+
+// createLockFile atomically creates the lock file. Returns false if it exists.
+func createLockFile(path string, record lockRecord) (bool, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create lock file: %w", err)
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(record); err != nil {
+		_ = os.Remove(path)
+		return false, fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return true, nil
+}
+
+// writeLockFile replaces the lock file content atomically via rename.
+func writeLockFile(path string, record lockRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp-" + record.Token
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return nil
+}
+
+func readLockFile(path string) (lockRecord, error) {
+	var record lockRecord
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return record, err
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		// A lock file is briefly empty between create and write. Treat it as
+		// held for a second after its last modification so a file left
+		// unwritten by a crash still expires.
+		info, statErr := os.Stat(path)
+		if statErr != nil {
+			return record, statErr
+		}
+		return lockRecord{ExpiresAt: info.ModTime().Add(time.Second)}, nil
+	}
+	return record, nil
+}
+
+// Verify that Locker implements stellarconnect.Locker
+var _ stellarconnect.Locker = (*Locker)(nil)
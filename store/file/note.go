@@ -0,0 +1,42 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+)
+
+// AddNote stores an operator note on a transfer.
+// Returns an error if the transfer is not found.
+func (s *TransferStore) AddNote(ctx context.Context, note stellarconnect.Note) (*stellarconnect.Note, error) {
+	err := s.update(ctx, func(d *data) error {
+		if _, exists := d.Transfers[note.TransferID]; !exists {
+			return errors.New("transfer not found")
+		}
+		d.NoteSeq++
+		note.ID = fmt.Sprintf("note_%d", d.NoteSeq)
+		note.CreatedAt = time.Now()
+		d.Notes[note.TransferID] = append(d.Notes[note.TransferID], note)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// Notes returns the notes on a transfer, oldest first.
+// Returns an empty slice if the transfer has no notes.
+func (s *TransferStore) Notes(ctx context.Context, transferID string) ([]stellarconnect.Note, error) {
+	d, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return append([]stellarconnect.Note{}, d.Notes[transferID]...), nil
+}
+
+// Verify that TransferStore implements stellarconnect.NoteStore
+var _ stellarconnect.NoteStore = (*TransferStore)(nil)
@@ -0,0 +1,150 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/store/internal/storeutil"
+)
+
+// SaveWithEvents persists a new transfer and appends its outbox events in a
+// single write of the data file, so neither is visible without the other.
+func (s *TransferStore) SaveWithEvents(ctx context.Context, transfer *stellarconnect.Transfer, events []stellarconnect.OutboxEvent) error {
+	return s.update(ctx, func(d *data) error {
+		if err := saveTransfer(d, transfer); err != nil {
+			return err
+		}
+		appendEvents(d, d.Transfers[transfer.ID], events)
+		return nil
+	})
+}
+
+// UpdateWithEvents applies the update and appends the outbox events in a
+// single write. A non-zero expectedVersion makes the update a compare-and-swap.
+func (s *TransferStore) UpdateWithEvents(ctx context.Context, id string, expectedVersion int64, update *stellarconnect.TransferUpdate, events []stellarconnect.OutboxEvent) error {
+	return s.update(ctx, func(d *data) error {
+		transfer, err := compareAndUpdate(d, id, expectedVersion, update)
+		if err != nil {
+			return err
+		}
+		appendEvents(d, transfer, events)
+		return nil
+	})
+}
+
+// appendEvents assigns IDs and snapshots to events and adds them to d.
+func appendEvents(d *data, transfer *stellarconnect.Transfer, events []stellarconnect.OutboxEvent) {
+	now := time.Now()
+	for _, evt := range events {
+		d.EventSeq++
+		evt.ID = fmt.Sprintf("evt_%d", d.EventSeq)
+		evt.TransferID = transfer.ID
+		evt.Transfer = *storeutil.CloneTransfer(transfer)
+		evt.CreatedAt = now
+		d.Events = append(d.Events, &evt)
+	}
+}
+
+// PendingEvents returns up to limit events that are due for delivery,
+// oldest first.
+func (s *TransferStore) PendingEvents(ctx context.Context, limit int) ([]stellarconnect.OutboxEvent, error) {
+	d, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var result []stellarconnect.OutboxEvent
+	for _, evt := range storeutil.PendingEvents(d.Events, time.Now(), limit) {
+		result = append(result, *evt)
+	}
+	return result, nil
+}
+
+// MarkDelivered records that an event was delivered.
+// Returns an error if the event does not exist.
+func (s *TransferStore) MarkDelivered(ctx context.Context, eventID string) error {
+	return s.update(ctx, func(d *data) error {
+		evt := findEvent(d, eventID)
+		if evt == nil {
+			return errors.New("event not found")
+		}
+		now := time.Now()
+		evt.Attempts++
+		evt.DeliveredAt = &now
+		evt.DeadAt = nil
+		evt.LastError = ""
+		return nil
+	})
+}
+
+// MarkFailed records a failed delivery attempt; the event stays pending
+// until nextAttemptAt. Returns an error if the event does not exist.
+func (s *TransferStore) MarkFailed(ctx context.Context, eventID string, reason string, nextAttemptAt time.Time) error {
+	return s.update(ctx, func(d *data) error {
+		evt := findEvent(d, eventID)
+		if evt == nil {
+			return errors.New("event not found")
+		}
+		evt.Attempts++
+		evt.LastError = reason
+		evt.NextAttemptAt = nextAttemptAt
+		return nil
+	})
+}
+
+// MarkDead records a final failed attempt and dead-letters the event.
+// Returns an error if the event does not exist.
+func (s *TransferStore) MarkDead(ctx context.Context, eventID string, reason string) error {
+	return s.update(ctx, func(d *data) error {
+		evt := findEvent(d, eventID)
+		if evt == nil {
+			return errors.New("event not found")
+		}
+		now := time.Now()
+		evt.Attempts++
+		evt.LastError = reason
+		evt.DeadAt = &now
+		return nil
+	})
+}
+
+// PruneEvents removes delivered and dead events finalized before the given
+// time and returns how many were removed.
+func (s *TransferStore) PruneEvents(ctx context.Context, before time.Time) (int, error) {
+	var removed int
+	err := s.update(ctx, func(d *data) error {
+		d.Events, removed = storeutil.PruneEvents(d.Events, before)
+		return nil
+	})
+	return removed, err
+}
+
+// ListEvents returns all events for a transfer, oldest first.
+func (s *TransferStore) ListEvents(ctx context.Context, transferID string) ([]stellarconnect.OutboxEvent, error) {
+	d, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var result []stellarconnect.OutboxEvent
+	for _, evt := range d.Events {
+		if evt.TransferID == transferID {
+			result = append(result, *evt)
+		}
+	}
+	return result, nil
+}
+
+// findEvent returns the event with the given ID in d, or nil.
+func findEvent(d *data, eventID string) *stellarconnect.OutboxEvent {
+	for _, evt := range d.Events {
+		if evt.ID == eventID {
+			return evt
+		}
+	}
+	return nil
+}
+
+// Verify that TransferStore implements stellarconnect.OutboxStore
+var _ stellarconnect.OutboxStore = (*TransferStore)(nil)
@@ -0,0 +1,36 @@
+package file
+
+import (
+	"context"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+)
+
+// FindPayout returns the payout state of a transfer, or nil if it has none.
+func (s *TransferStore) FindPayout(ctx context.Context, transferID string) (*stellarconnect.PayoutState, error) {
+	d, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return d.Payouts[transferID], nil
+}
+
+// SavePayout creates or replaces the payout state of a transfer.
+func (s *TransferStore) SavePayout(ctx context.Context, state *stellarconnect.PayoutState) error {
+	return s.update(ctx, func(d *data) error {
+		c := *state
+		d.Payouts[state.TransferID] = &c
+		return nil
+	})
+}
+
+// DeletePayout removes the payout state of a transfer, if any.
+func (s *TransferStore) DeletePayout(ctx context.Context, transferID string) error {
+	return s.update(ctx, func(d *data) error {
+		delete(d.Payouts, transferID)
+		return nil
+	})
+}
+
+// Verify that TransferStore implements stellarconnect.PayoutStore
+var _ stellarconnect.PayoutStore = (*TransferStore)(nil)
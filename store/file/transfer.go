@@ -0,0 +1,328 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	corecrypto "github.com/marwen-abid/anchor-sdk-go/core/crypto"
+	"github.com/marwen-abid/anchor-sdk-go/store/internal/storeutil"
+)
+
+const (
+	// dataFileName is the file holding all store data inside the directory.
+	dataFileName = "transfers.json"
+
+	// lockDirName is the directory of the Locker serializing writers.
+	lockDirName = "locks"
+
+	// writeLockKey is the lock held while a write reads, changes, and
+	// replaces the data file.
+	writeLockKey = "store"
+
+	// writeLockTTL bounds how long a crashed writer can block others.
+	writeLockTTL = 10 * time.Second
+)
+
+// data is the content of the data file.
+type data struct {
+	Transfers  map[string]*stellarconnect.Transfer      `json:"transfers"`
+	History    map[string][]stellarconnect.HistoryEntry `json:"history,omitempty"`
+	HistorySeq int64                                    `json:"history_seq,omitempty"`
+	Notes      map[string][]stellarconnect.Note         `json:"notes,omitempty"`
+	NoteSeq    int64                                    `json:"note_seq,omitempty"`
+	Events     []*stellarconnect.OutboxEvent            `json:"events,omitempty"`
+	EventSeq   int64                                    `json:"event_seq,omitempty"`
+	Payouts    map[string]*stellarconnect.PayoutState   `json:"payouts,omitempty"`
+}
+
+// TransferStore is a filesystem-backed implementation of
+// stellarconnect.TransferStore. All records are kept in a single JSON file
+// that every call reads and every write replaces atomically, so several
+// processes sharing the directory, such as an anchor and anchorctl, see each
+// other's changes. Writers are serialized with a Locker in the same
+// directory.
+//
+// Reading the whole file on every call suits development, single-host
+// deployments, and operator tooling, not high volumes. As with any JSON
+// round trip, numbers in Transfer.Metadata are read back as float64.
+type TransferStore struct {
+	path   string
+	locker *Locker
+	mu     sync.Mutex // serializes writers within this process
+}
+
+// NewTransferStore opens the transfer store kept in dir, creating the
+// directory if needed.
+func NewTransferStore(dir string) (*TransferStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+	locker, err := NewLocker(filepath.Join(dir, lockDirName))
+	if err != nil {
+		return nil, err
+	}
+	return &TransferStore{path: filepath.Join(dir, dataFileName), locker: locker}, nil
+}
+
+// load reads the data file. A missing file is an empty store.
+func (s *TransferStore) load() (*data, error) {
+	d := &data{}
+	raw, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read store: %w", err)
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, d); err != nil {
+			return nil, fmt.Errorf("failed to decode store: %w", err)
+		}
+	}
+	if d.Transfers == nil {
+		d.Transfers = make(map[string]*stellarconnect.Transfer)
+	}
+	if d.History == nil {
+		d.History = make(map[string][]stellarconnect.HistoryEntry)
+	}
+	if d.Notes == nil {
+		d.Notes = make(map[string][]stellarconnect.Note)
+	}
+	if d.Payouts == nil {
+		d.Payouts = make(map[string]*stellarconnect.PayoutState)
+	}
+	return d, nil
+}
+
+// update loads the data file under the write lock, applies fn, and replaces
+// the file if fn succeeds.
+func (s *TransferStore) update(ctx context.Context, fn func(d *data) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease, err := s.locker.Acquire(ctx, writeLockKey, writeLockTTL)
+	if err != nil {
+		return fmt.Errorf("failed to lock store: %w", err)
+	}
+	defer lease.Release(ctx)
+
+	d, err := s.load()
+	if err != nil {
+		return err
+	}
+	if err := fn(d); err != nil {
+		return err
+	}
+	return s.store(d)
+}
+
+// store replaces the data file atomically via rename.
+func (s *TransferStore) store(d *data) error {
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to encode store: %w", err)
+	}
+	suffix, err := corecrypto.GenerateNonce(8)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp-" + suffix
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return fmt.Errorf("failed to write store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write store: %w", err)
+	}
+	return nil
+}
+
+// Save persists a new transfer record.
+// Returns an error if a transfer with the same ID, memo, or mux ID exists.
+func (s *TransferStore) Save(ctx context.Context, transfer *stellarconnect.Transfer) error {
+	return s.update(ctx, func(d *data) error {
+		return saveTransfer(d, transfer)
+	})
+}
+
+// saveTransfer adds a new transfer to d.
+func saveTransfer(d *data, transfer *stellarconnect.Transfer) error {
+	if _, exists := d.Transfers[transfer.ID]; exists {
+		return errors.New("transfer already exists")
+	}
+	for _, other := range d.Transfers {
+		if transfer.Memo != "" && other.Memo == transfer.Memo {
+			return errors.New("memo already assigned to another transfer")
+		}
+		if transfer.MuxID != 0 && other.MuxID == transfer.MuxID {
+			return errors.New("mux ID already assigned to another transfer")
+		}
+	}
+
+	transfer.Version = 1
+	d.Transfers[transfer.ID] = storeutil.CloneTransfer(transfer)
+	return nil
+}
+
+// FindByID retrieves a transfer by its unique identifier.
+// Returns an error if the transfer is not found.
+func (s *TransferStore) FindByID(ctx context.Context, id string) (*stellarconnect.Transfer, error) {
+	d, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	transfer, exists := d.Transfers[id]
+	if !exists {
+		return nil, errors.New("transfer not found")
+	}
+	return transfer, nil
+}
+
+// FindByMemo retrieves the transfer that was assigned the given memo.
+// An empty memoType matches any memo type.
+// Returns an error if no transfer has the memo.
+func (s *TransferStore) FindByMemo(ctx context.Context, memo string, memoType stellarconnect.MemoType) (*stellarconnect.Transfer, error) {
+	d, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, transfer := range d.Transfers {
+		if memo != "" && transfer.Memo == memo && (memoType == "" || transfer.MemoType == memoType) {
+			return transfer, nil
+		}
+	}
+	return nil, errors.New("transfer not found")
+}
+
+// FindByMuxID retrieves the transfer that was assigned the given mux ID.
+// Returns an error if no transfer has the mux ID.
+func (s *TransferStore) FindByMuxID(ctx context.Context, muxID uint64) (*stellarconnect.Transfer, error) {
+	d, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, transfer := range d.Transfers {
+		if muxID != 0 && transfer.MuxID == muxID {
+			return transfer, nil
+		}
+	}
+	return nil, errors.New("transfer not found")
+}
+
+// FindByExternalRef retrieves the transfer most recently assigned the given
+// external reference.
+// Returns an error if no transfer has the reference.
+func (s *TransferStore) FindByExternalRef(ctx context.Context, ref string) (*stellarconnect.Transfer, error) {
+	d, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var found *stellarconnect.Transfer
+	for _, transfer := range d.Transfers {
+		if ref != "" && transfer.ExternalRef == ref && (found == nil || transfer.UpdatedAt.After(found.UpdatedAt)) {
+			found = transfer
+		}
+	}
+	if found == nil {
+		return nil, errors.New("transfer not found")
+	}
+	return found, nil
+}
+
+// FindByAccount returns all transfers for a given Stellar account.
+// Returns a slice of matching transfers (or empty slice if none found).
+func (s *TransferStore) FindByAccount(ctx context.Context, account string) ([]*stellarconnect.Transfer, error) {
+	return s.List(ctx, stellarconnect.TransferFilters{Account: account})
+}
+
+// Update applies partial updates to an existing transfer.
+// Only non-nil fields in the update are applied and Version is incremented.
+// Returns an error if the transfer does not exist.
+func (s *TransferStore) Update(ctx context.Context, id string, update *stellarconnect.TransferUpdate) error {
+	return s.CompareAndUpdate(ctx, id, 0, update)
+}
+
+// CompareAndUpdate applies partial updates only if the stored transfer's
+// Version equals expectedVersion; an expectedVersion of zero skips the check.
+// Returns a *stellarconnect.VersionConflictError if the versions differ, or
+// an error if the transfer does not exist.
+func (s *TransferStore) CompareAndUpdate(ctx context.Context, id string, expectedVersion int64, update *stellarconnect.TransferUpdate) error {
+	return s.update(ctx, func(d *data) error {
+		_, err := compareAndUpdate(d, id, expectedVersion, update)
+		return err
+	})
+}
+
+// compareAndUpdate applies the update to the transfer in d if the version
+// matches. Returns the updated transfer.
+func compareAndUpdate(d *data, id string, expectedVersion int64, update *stellarconnect.TransferUpdate) (*stellarconnect.Transfer, error) {
+	transfer, exists := d.Transfers[id]
+	if !exists {
+		return nil, errors.New("transfer not found")
+	}
+	if expectedVersion != 0 && transfer.Version != expectedVersion {
+		return nil, &stellarconnect.VersionConflictError{
+			TransferID: id,
+			Expected:   expectedVersion,
+			Actual:     transfer.Version,
+		}
+	}
+
+	storeutil.ApplyUpdate(transfer, update)
+	return transfer, nil
+}
+
+// List returns transfers matching the given filters.
+// Filters by account, asset code, status, kind, and creation time.
+// Returns a slice of matching transfers (or empty slice if none found).
+func (s *TransferStore) List(ctx context.Context, filters stellarconnect.TransferFilters) ([]*stellarconnect.Transfer, error) {
+	d, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*stellarconnect.Transfer
+	for _, transfer := range d.Transfers {
+		if filters.Account != "" && transfer.Account != filters.Account {
+			continue
+		}
+		if filters.AssetCode != "" && transfer.AssetCode != filters.AssetCode {
+			continue
+		}
+		if filters.Status != nil && transfer.Status != *filters.Status {
+			continue
+		}
+		if filters.Kind != nil && transfer.Kind != *filters.Kind {
+			continue
+		}
+		if !filters.CreatedAfter.IsZero() && transfer.CreatedAt.Before(filters.CreatedAfter) {
+			continue
+		}
+		if !filters.CreatedBefore.IsZero() && !transfer.CreatedAt.Before(filters.CreatedBefore) {
+			continue
+		}
+
+		result = append(result, transfer)
+	}
+
+	return result, nil
+}
+
+// Verify that TransferStore implements stellarconnect.TransferStore
+var _ stellarconnect.TransferStore = (*TransferStore)(nil)
+
+// Verify that TransferStore implements stellarconnect.MemoTransferStore
+var _ stellarconnect.MemoTransferStore = (*TransferStore)(nil)
+
+// Verify that TransferStore implements stellarconnect.MuxedTransferStore
+var _ stellarconnect.MuxedTransferStore = (*TransferStore)(nil)
+
+// Verify that TransferStore implements stellarconnect.ExternalRefTransferStore
+var _ stellarconnect.ExternalRefTransferStore = (*TransferStore)(nil)
+
+// Verify that TransferStore implements stellarconnect.VersionedTransferStore
+var _ stellarconnect.VersionedTransferStore = (*TransferStore)(nil)
@@ -0,0 +1,136 @@
+// Package storeutil holds the record-handling helpers shared by the memory
+// and file stores, so both apply updates and copy records the same way.
+package storeutil
+
+import (
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+)
+
+// ApplyUpdate copies the non-nil fields of update onto transfer, bumps its
+// Version, and refreshes UpdatedAt. The caller must hold the store's write
+// lock.
+func ApplyUpdate(transfer *stellarconnect.Transfer, update *stellarconnect.TransferUpdate) {
+	if update.Status != nil {
+		transfer.Status = *update.Status
+	}
+	if update.Amount != nil {
+		transfer.Amount = *update.Amount
+	}
+	if update.AmountReceived != nil {
+		transfer.AmountReceived = *update.AmountReceived
+	}
+	if update.AssetCode != nil {
+		transfer.AssetCode = *update.AssetCode
+	}
+	if update.AssetIssuer != nil {
+		transfer.AssetIssuer = *update.AssetIssuer
+	}
+	if update.ExternalRef != nil {
+		transfer.ExternalRef = *update.ExternalRef
+	}
+	if update.StellarTxHash != nil {
+		transfer.StellarTxHash = *update.StellarTxHash
+	}
+	if update.ClaimableBalanceID != nil {
+		transfer.ClaimableBalanceID = *update.ClaimableBalanceID
+	}
+	if update.InteractiveToken != nil {
+		transfer.InteractiveToken = *update.InteractiveToken
+	}
+	if update.InteractiveURL != nil {
+		transfer.InteractiveURL = *update.InteractiveURL
+	}
+	if update.Message != nil {
+		transfer.Message = *update.Message
+	}
+	if update.Metadata != nil {
+		transfer.Metadata = CloneMetadata(update.Metadata)
+	}
+	if update.CompletedAt != nil {
+		completedAt := *update.CompletedAt
+		transfer.CompletedAt = &completedAt
+	}
+
+	transfer.Version++
+	transfer.UpdatedAt = time.Now()
+}
+
+// CloneTransfer returns a copy of t that shares no mutable state with it.
+// Metadata is copied one level deep.
+func CloneTransfer(t *stellarconnect.Transfer) *stellarconnect.Transfer {
+	c := *t
+	c.Metadata = CloneMetadata(t.Metadata)
+	if t.CompletedAt != nil {
+		completedAt := *t.CompletedAt
+		c.CompletedAt = &completedAt
+	}
+	return &c
+}
+
+// CloneMetadata returns a shallow copy of m, or nil if m is nil.
+func CloneMetadata(m map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]any, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// CloneEvent returns a copy of evt that shares no mutable state with it.
+func CloneEvent(evt *stellarconnect.OutboxEvent) stellarconnect.OutboxEvent {
+	c := *evt
+	c.Transfer = *CloneTransfer(&evt.Transfer)
+	c.Changes = append([]stellarconnect.FieldChange(nil), evt.Changes...)
+	if evt.DeliveredAt != nil {
+		deliveredAt := *evt.DeliveredAt
+		c.DeliveredAt = &deliveredAt
+	}
+	if evt.DeadAt != nil {
+		deadAt := *evt.DeadAt
+		c.DeadAt = &deadAt
+	}
+	return c
+}
+
+// PendingEvents selects from events, which must be oldest first, up to limit
+// events that are due at now. Delivered and dead events are skipped; once a
+// transfer has an event still backing off, that transfer's later events are
+// skipped too so its events stay in order.
+func PendingEvents(events []*stellarconnect.OutboxEvent, now time.Time, limit int) []*stellarconnect.OutboxEvent {
+	var result []*stellarconnect.OutboxEvent
+	waiting := make(map[string]bool)
+	for _, evt := range events {
+		if evt.DeliveredAt != nil || evt.DeadAt != nil || waiting[evt.TransferID] {
+			continue
+		}
+		if evt.NextAttemptAt.After(now) {
+			waiting[evt.TransferID] = true
+			continue
+		}
+		result = append(result, evt)
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+	}
+	return result
+}
+
+// PruneEvents returns events without the delivered and dead ones finalized
+// before the given time, and how many were dropped.
+func PruneEvents(events []*stellarconnect.OutboxEvent, before time.Time) ([]*stellarconnect.OutboxEvent, int) {
+	kept := events[:0]
+	for _, evt := range events {
+		if (evt.DeliveredAt != nil && evt.DeliveredAt.Before(before)) || (evt.DeliveredAt == nil && evt.DeadAt != nil && evt.DeadAt.Before(before)) {
+			continue
+		}
+		kept = append(kept, evt)
+	}
+	removed := len(events) - len(kept)
+	clear(events[len(kept):])
+	return kept, removed
+}
@@ -0,0 +1,76 @@
+// Package memory provides in-memory implementations of store interfaces.
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+)
+
+// AppendHistory records a history entry for a transfer.
+// Entries are kept in insertion order and never modified.
+func (s *TransferStore) AppendHistory(ctx context.Context, entry stellarconnect.HistoryEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.appendHistoryLocked(entry)
+	return nil
+}
+
+// SaveWithHistory persists a new transfer with its history entry and outbox
+// events under a single lock.
+func (s *TransferStore) SaveWithHistory(ctx context.Context, transfer *stellarconnect.Transfer, entry stellarconnect.HistoryEntry, events []stellarconnect.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.saveLocked(transfer); err != nil {
+		return err
+	}
+	s.appendHistoryLocked(entry)
+	s.appendEventsLocked(s.transfers[transfer.ID], events)
+	return nil
+}
+
+// UpdateWithHistory applies the update and appends the history entry and
+// outbox events under a single lock. A non-zero expectedVersion makes the
+// update a compare-and-swap.
+func (s *TransferStore) UpdateWithHistory(ctx context.Context, id string, expectedVersion int64, update *stellarconnect.TransferUpdate, entry stellarconnect.HistoryEntry, events []stellarconnect.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transfer, err := s.compareAndUpdateLocked(id, expectedVersion, update)
+	if err != nil {
+		return err
+	}
+	s.appendHistoryLocked(entry)
+	s.appendEventsLocked(transfer, events)
+	return nil
+}
+
+// appendHistoryLocked assigns the entry an ID and stores it. The caller must
+// hold the write lock.
+func (s *TransferStore) appendHistoryLocked(entry stellarconnect.HistoryEntry) {
+	s.historySeq++
+	entry.ID = fmt.Sprintf("hist_%d", s.historySeq)
+	entry.Changes = append([]stellarconnect.FieldChange(nil), entry.Changes...)
+	s.history[entry.TransferID] = append(s.history[entry.TransferID], entry)
+}
+
+// History returns the entries for a transfer, oldest first.
+// Returns an empty slice if the transfer has no history.
+func (s *TransferStore) History(ctx context.Context, transferID string) ([]stellarconnect.HistoryEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := s.history[transferID]
+	result := make([]stellarconnect.HistoryEntry, len(entries))
+	for i, entry := range entries {
+		entry.Changes = append([]stellarconnect.FieldChange(nil), entry.Changes...)
+		result[i] = entry
+	}
+	return result, nil
+}
+
+// Verify that TransferStore implements stellarconnect.AtomicHistoryStore
+var _ stellarconnect.AtomicHistoryStore = (*TransferStore)(nil)
@@ -0,0 +1,90 @@
+// Package memory provides in-memory implementations of store interfaces.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+)
+
+// IdempotencyStore is an in-memory implementation of stellarconnect.IdempotencyStore.
+// Records expire lazily: expired keys are discarded on the next Reserve.
+// Access is protected by sync.Mutex for thread safety.
+type IdempotencyStore struct {
+	records map[string]stellarconnect.IdempotencyRecord
+	mu      sync.Mutex
+}
+
+// NewIdempotencyStore creates a new in-memory idempotency store.
+func NewIdempotencyStore() *IdempotencyStore {
+	return &IdempotencyStore{
+		records: make(map[string]stellarconnect.IdempotencyRecord),
+	}
+}
+
+// Reserve claims a key for a new request.
+// Returns the existing record and false if the key is held and unexpired.
+// Performs lazy cleanup of expired records during operation.
+func (s *IdempotencyStore) Reserve(ctx context.Context, key, fingerprint string, expiresAt time.Time) (*stellarconnect.IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Lazy cleanup: remove expired records
+	now := time.Now()
+	for k, record := range s.records {
+		if now.After(record.ExpiresAt) {
+			delete(s.records, k)
+		}
+	}
+
+	if record, exists := s.records[key]; exists {
+		existing := record
+		if record.CompletedAt != nil {
+			completedAt := *record.CompletedAt
+			existing.CompletedAt = &completedAt
+		}
+		return &existing, false, nil
+	}
+
+	s.records[key] = stellarconnect.IdempotencyRecord{
+		Key:         key,
+		Fingerprint: fingerprint,
+		ExpiresAt:   expiresAt,
+	}
+	return nil, true, nil
+}
+
+// Complete marks a reserved key as done, records its resource ID, and keeps
+// it until expiresAt.
+// Returns an error if the key is not held.
+func (s *IdempotencyStore) Complete(ctx context.Context, key, resourceID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, exists := s.records[key]
+	if !exists {
+		return fmt.Errorf("idempotency key not found")
+	}
+	now := time.Now()
+	record.ResourceID = resourceID
+	record.CompletedAt = &now
+	record.ExpiresAt = expiresAt
+	s.records[key] = record
+	return nil
+}
+
+// Release removes a key so it can be reserved again.
+// Releasing an unknown key is a no-op.
+func (s *IdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
+
+// Verify that IdempotencyStore implements stellarconnect.IdempotencyStore
+var _ stellarconnect.IdempotencyStore = (*IdempotencyStore)(nil)
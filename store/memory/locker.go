@@ -0,0 +1,130 @@
+// Package memory provides in-memory implementations of store interfaces.
+package memory
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	corecrypto "github.com/marwen-abid/anchor-sdk-go/core/crypto"
+)
+
+// lockEntry is a held lock. released is closed when the lock is given up so
+// waiters can retry without polling.
+type lockEntry struct {
+	token     string
+	expiresAt time.Time
+	released  chan struct{}
+}
+
+// Locker is an in-memory implementation of stellarconnect.Locker.
+// Locks only coordinate goroutines within one process. Entries are removed when
+// released, and expired entries are evicted lazily on Acquire, so idle keys do
+// not accumulate.
+type Locker struct {
+	locks map[string]*lockEntry
+	mu    sync.Mutex
+}
+
+// NewLocker creates a new in-memory locker.
+func NewLocker() *Locker {
+	return &Locker{
+		locks: make(map[string]*lockEntry),
+	}
+}
+
+// Acquire blocks until the lock for key is held or ctx is done.
+// A lock whose lease has expired is taken over by the next caller.
+func (l *Locker) Acquire(ctx context.Context, key string, ttl time.Duration) (stellarconnect.Lease, error) {
+	token, err := corecrypto.GenerateNonce(16)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.evictExpired(now, key)
+		entry, held := l.locks[key]
+		if !held || now.After(entry.expiresAt) {
+			if held {
+				close(entry.released)
+			}
+			l.locks[key] = &lockEntry{
+				token:     token,
+				expiresAt: now.Add(ttl),
+				released:  make(chan struct{}),
+			}
+			l.mu.Unlock()
+			return &lease{locker: l, key: key, token: token}, nil
+		}
+		released := entry.released
+		wait := entry.expiresAt.Sub(now)
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-released:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// evictExpired removes expired locks other than skip and wakes their waiters.
+// The caller must hold l.mu.
+func (l *Locker) evictExpired(now time.Time, skip string) {
+	for key, entry := range l.locks {
+		if key != skip && now.After(entry.expiresAt) {
+			delete(l.locks, key)
+			close(entry.released)
+		}
+	}
+}
+
+// lease is a lock held in a Locker, identified by a random token so an
+// expired holder cannot release or extend a lock that was taken over.
+type lease struct {
+	locker *Locker
+	key    string
+	token  string
+}
+
+// Extend pushes the lease expiry to ttl from now.
+// Returns an error if the lease expired or was taken over.
+func (le *lease) Extend(ctx context.Context, ttl time.Duration) error {
+	l := le.locker
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, held := l.locks[le.key]
+	if !held || entry.token != le.token || time.Now().After(entry.expiresAt) {
+		return errors.New("lease expired")
+	}
+	entry.expiresAt = time.Now().Add(ttl)
+	return nil
+}
+
+// Release gives up the lock and wakes any waiters.
+// Releasing an expired or taken-over lease is a no-op.
+func (le *lease) Release(ctx context.Context) error {
+	l := le.locker
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, held := l.locks[le.key]
+	if !held || entry.token != le.token {
+		return nil
+	}
+	delete(l.locks, le.key)
+	close(entry.released)
+	return nil
+}
+
+// Verify that Locker implements stellarconnect.Locker
+var _ stellarconnect.Locker = (*Locker)(nil)
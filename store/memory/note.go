@@ -0,0 +1,39 @@
+// Package memory provides in-memory implementations of store interfaces.
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+)
+
+// AddNote stores an operator note on a transfer.
+// Returns an error if the transfer is not found.
+func (s *TransferStore) AddNote(ctx context.Context, note stellarconnect.Note) (*stellarconnect.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.transfers[note.TransferID]; !exists {
+		return nil, errors.New("transfer not found")
+	}
+	s.noteSeq++
+	note.ID = fmt.Sprintf("note_%d", s.noteSeq)
+	note.CreatedAt = time.Now()
+	s.notes[note.TransferID] = append(s.notes[note.TransferID], note)
+	return &note, nil
+}
+
+// Notes returns the notes on a transfer, oldest first.
+// Returns an empty slice if the transfer has no notes.
+func (s *TransferStore) Notes(ctx context.Context, transferID string) ([]stellarconnect.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]stellarconnect.Note{}, s.notes[transferID]...), nil
+}
+
+// Verify that TransferStore implements stellarconnect.NoteStore
+var _ stellarconnect.NoteStore = (*TransferStore)(nil)
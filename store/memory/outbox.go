@@ -0,0 +1,157 @@
+// Package memory provides in-memory implementations of store interfaces.
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/store/internal/storeutil"
+)
+
+// SaveWithEvents persists a new transfer and appends its outbox events under
+// a single lock, so neither is visible without the other.
+func (s *TransferStore) SaveWithEvents(ctx context.Context, transfer *stellarconnect.Transfer, events []stellarconnect.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.saveLocked(transfer); err != nil {
+		return err
+	}
+	s.appendEventsLocked(s.transfers[transfer.ID], events)
+	return nil
+}
+
+// UpdateWithEvents applies the update and appends the outbox events under a
+// single lock. A non-zero expectedVersion makes the update a compare-and-swap.
+func (s *TransferStore) UpdateWithEvents(ctx context.Context, id string, expectedVersion int64, update *stellarconnect.TransferUpdate, events []stellarconnect.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transfer, err := s.compareAndUpdateLocked(id, expectedVersion, update)
+	if err != nil {
+		return err
+	}
+	s.appendEventsLocked(transfer, events)
+	return nil
+}
+
+// appendEventsLocked assigns IDs and snapshots to events and stores them.
+// The caller must hold the write lock.
+func (s *TransferStore) appendEventsLocked(transfer *stellarconnect.Transfer, events []stellarconnect.OutboxEvent) {
+	now := time.Now()
+	for _, evt := range events {
+		s.eventSeq++
+		evt.ID = fmt.Sprintf("evt_%d", s.eventSeq)
+		evt.TransferID = transfer.ID
+		evt.Transfer = *storeutil.CloneTransfer(transfer)
+		evt.Changes = append([]stellarconnect.FieldChange(nil), evt.Changes...)
+		evt.CreatedAt = now
+		s.events = append(s.events, &evt)
+	}
+}
+
+// PendingEvents returns up to limit events that are due for delivery,
+// oldest first.
+func (s *TransferStore) PendingEvents(ctx context.Context, limit int) ([]stellarconnect.OutboxEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []stellarconnect.OutboxEvent
+	for _, evt := range storeutil.PendingEvents(s.events, time.Now(), limit) {
+		result = append(result, storeutil.CloneEvent(evt))
+	}
+	return result, nil
+}
+
+// MarkDelivered records that an event was delivered.
+// Returns an error if the event does not exist.
+func (s *TransferStore) MarkDelivered(ctx context.Context, eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evt := s.findEventLocked(eventID)
+	if evt == nil {
+		return errors.New("event not found")
+	}
+	now := time.Now()
+	evt.Attempts++
+	evt.DeliveredAt = &now
+	evt.DeadAt = nil
+	evt.LastError = ""
+	return nil
+}
+
+// MarkFailed records a failed delivery attempt; the event stays pending
+// until nextAttemptAt. Returns an error if the event does not exist.
+func (s *TransferStore) MarkFailed(ctx context.Context, eventID string, reason string, nextAttemptAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evt := s.findEventLocked(eventID)
+	if evt == nil {
+		return errors.New("event not found")
+	}
+	evt.Attempts++
+	evt.LastError = reason
+	evt.NextAttemptAt = nextAttemptAt
+	return nil
+}
+
+// MarkDead records a final failed attempt and dead-letters the event.
+// Returns an error if the event does not exist.
+func (s *TransferStore) MarkDead(ctx context.Context, eventID string, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evt := s.findEventLocked(eventID)
+	if evt == nil {
+		return errors.New("event not found")
+	}
+	now := time.Now()
+	evt.Attempts++
+	evt.LastError = reason
+	evt.DeadAt = &now
+	return nil
+}
+
+// PruneEvents removes delivered and dead events finalized before the given
+// time and returns how many were removed.
+func (s *TransferStore) PruneEvents(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed int
+	s.events, removed = storeutil.PruneEvents(s.events, before)
+	return removed, nil
+}
+
+// ListEvents returns all events for a transfer, oldest first.
+func (s *TransferStore) ListEvents(ctx context.Context, transferID string) ([]stellarconnect.OutboxEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []stellarconnect.OutboxEvent
+	for _, evt := range s.events {
+		if evt.TransferID == transferID {
+			result = append(result, storeutil.CloneEvent(evt))
+		}
+	}
+	return result, nil
+}
+
+// findEventLocked returns the stored event with the given ID, or nil.
+// The caller must hold the lock.
+func (s *TransferStore) findEventLocked(eventID string) *stellarconnect.OutboxEvent {
+	for _, evt := range s.events {
+		if evt.ID == eventID {
+			return evt
+		}
+	}
+	return nil
+}
+
+// Verify that TransferStore implements stellarconnect.OutboxStore
+var _ stellarconnect.OutboxStore = (*TransferStore)(nil)
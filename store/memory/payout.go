@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"context"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+)
+
+// FindPayout returns the payout state of a transfer, or nil if it has none.
+func (s *TransferStore) FindPayout(ctx context.Context, transferID string) (*stellarconnect.PayoutState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	state, ok := s.payouts[transferID]
+	if !ok {
+		return nil, nil
+	}
+	c := *state
+	return &c, nil
+}
+
+// SavePayout creates or replaces the payout state of a transfer.
+func (s *TransferStore) SavePayout(ctx context.Context, state *stellarconnect.PayoutState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := *state
+	s.payouts[state.TransferID] = &c
+	return nil
+}
+
+// DeletePayout removes the payout state of a transfer, if any.
+func (s *TransferStore) DeletePayout(ctx context.Context, transferID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.payouts, transferID)
+	return nil
+}
+
+// Verify that TransferStore implements stellarconnect.PayoutStore
+var _ stellarconnect.PayoutStore = (*TransferStore)(nil)
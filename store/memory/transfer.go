@@ -1,30 +1,50 @@
 // Package memory provides in-memory implementations of store interfaces.
 // The TransferStore implementation uses a map[string]*Transfer with sync.RWMutex
-// for thread-safe CRUD operations. It is suitable for examples, testing, and
-// small-scale anchor services without persistent storage requirements.
+// for thread-safe CRUD operations. Transfers are copied on the way in and out,
+// so callers never share state with the store; updates bump Transfer.Version
+// and CompareAndUpdate provides optimistic concurrency control. It is suitable
+// for examples, testing, and small-scale anchor services without persistent
+// storage requirements.
 package memory
 
 import (
 	"context"
 	"errors"
 	"sync"
-	"time"
 
 	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/store/internal/storeutil"
 )
 
 // TransferStore is an in-memory implementation of stellarconnect.TransferStore.
 // It stores transfers in a map with thread-safe access via sync.RWMutex.
-// All transfers are keyed by their ID field.
+// All transfers are keyed by their ID field, with secondary indexes on memo,
+// mux ID, and external reference.
 type TransferStore struct {
-	transfers map[string]*stellarconnect.Transfer
-	mu        sync.RWMutex
+	transfers  map[string]*stellarconnect.Transfer
+	memos      map[string]string // memo -> transfer ID
+	muxIDs     map[uint64]string // mux ID -> transfer ID
+	refs       map[string]string // external reference -> transfer ID
+	events     []*stellarconnect.OutboxEvent
+	eventSeq   int64
+	history    map[string][]stellarconnect.HistoryEntry // transfer ID -> entries
+	historySeq int64
+	notes      map[string][]stellarconnect.Note // transfer ID -> notes
+	noteSeq    int64
+	payouts    map[string]*stellarconnect.PayoutState // transfer ID -> payout state
+	mu         sync.RWMutex
 }
 
 // NewTransferStore creates a new in-memory transfer store.
 func NewTransferStore() *TransferStore {
 	return &TransferStore{
 		transfers: make(map[string]*stellarconnect.Transfer),
+		memos:     make(map[string]string),
+		muxIDs:    make(map[uint64]string),
+		refs:      make(map[string]string),
+		history:   make(map[string][]stellarconnect.HistoryEntry),
+		notes:     make(map[string][]stellarconnect.Note),
+		payouts:   make(map[string]*stellarconnect.PayoutState),
 	}
 }
 
@@ -34,11 +54,37 @@ func (s *TransferStore) Save(ctx context.Context, transfer *stellarconnect.Trans
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	return s.saveLocked(transfer)
+}
+
+// saveLocked stores a new transfer and indexes it. The caller must hold the
+// write lock.
+func (s *TransferStore) saveLocked(transfer *stellarconnect.Transfer) error {
 	if _, exists := s.transfers[transfer.ID]; exists {
 		return errors.New("transfer already exists")
 	}
+	if transfer.Memo != "" {
+		if _, exists := s.memos[transfer.Memo]; exists {
+			return errors.New("memo already assigned to another transfer")
+		}
+	}
+	if transfer.MuxID != 0 {
+		if _, exists := s.muxIDs[transfer.MuxID]; exists {
+			return errors.New("mux ID already assigned to another transfer")
+		}
+	}
+	if transfer.Memo != "" {
+		s.memos[transfer.Memo] = transfer.ID
+	}
+	if transfer.MuxID != 0 {
+		s.muxIDs[transfer.MuxID] = transfer.ID
+	}
+	if transfer.ExternalRef != "" {
+		s.refs[transfer.ExternalRef] = transfer.ID
+	}
 
-	s.transfers[transfer.ID] = transfer
+	transfer.Version = 1
+	s.transfers[transfer.ID] = storeutil.CloneTransfer(transfer)
 	return nil
 }
 
@@ -53,7 +99,55 @@ func (s *TransferStore) FindByID(ctx context.Context, id string) (*stellarconnec
 		return nil, errors.New("transfer not found")
 	}
 
-	return transfer, nil
+	return storeutil.CloneTransfer(transfer), nil
+}
+
+// FindByMemo retrieves the transfer that was assigned the given memo.
+// An empty memoType matches any memo type.
+// Returns an error if no transfer has the memo.
+func (s *TransferStore) FindByMemo(ctx context.Context, memo string, memoType stellarconnect.MemoType) (*stellarconnect.Transfer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, exists := s.memos[memo]
+	if !exists {
+		return nil, errors.New("transfer not found")
+	}
+	transfer := s.transfers[id]
+	if memoType != "" && transfer.MemoType != memoType {
+		return nil, errors.New("transfer not found")
+	}
+
+	return storeutil.CloneTransfer(transfer), nil
+}
+
+// FindByMuxID retrieves the transfer that was assigned the given mux ID.
+// Returns an error if no transfer has the mux ID.
+func (s *TransferStore) FindByMuxID(ctx context.Context, muxID uint64) (*stellarconnect.Transfer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, exists := s.muxIDs[muxID]
+	if !exists {
+		return nil, errors.New("transfer not found")
+	}
+
+	return storeutil.CloneTransfer(s.transfers[id]), nil
+}
+
+// FindByExternalRef retrieves the transfer most recently assigned the given
+// external reference.
+// Returns an error if no transfer has the reference.
+func (s *TransferStore) FindByExternalRef(ctx context.Context, ref string) (*stellarconnect.Transfer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, exists := s.refs[ref]
+	if !exists {
+		return nil, errors.New("transfer not found")
+	}
+
+	return storeutil.CloneTransfer(s.transfers[id]), nil
 }
 
 // FindByAccount returns all transfers for a given Stellar account.
@@ -65,7 +159,7 @@ func (s *TransferStore) FindByAccount(ctx context.Context, account string) ([]*s
 	var result []*stellarconnect.Transfer
 	for _, transfer := range s.transfers {
 		if transfer.Account == account {
-			result = append(result, transfer)
+			result = append(result, storeutil.CloneTransfer(transfer))
 		}
 	}
 
@@ -73,7 +167,7 @@ func (s *TransferStore) FindByAccount(ctx context.Context, account string) ([]*s
 }
 
 // Update applies partial updates to an existing transfer.
-// Only non-nil fields in the update are applied.
+// Only non-nil fields in the update are applied and Version is incremented.
 // Returns an error if the transfer does not exist.
 func (s *TransferStore) Update(ctx context.Context, id string, update *stellarconnect.TransferUpdate) error {
 	s.mu.Lock()
@@ -84,39 +178,54 @@ func (s *TransferStore) Update(ctx context.Context, id string, update *stellarco
 		return errors.New("transfer not found")
 	}
 
-	// Apply non-nil fields from the update struct
-	if update.Status != nil {
-		transfer.Status = *update.Status
-	}
-	if update.Amount != nil {
-		transfer.Amount = *update.Amount
-	}
-	if update.ExternalRef != nil {
-		transfer.ExternalRef = *update.ExternalRef
-	}
-	if update.StellarTxHash != nil {
-		transfer.StellarTxHash = *update.StellarTxHash
-	}
-	if update.InteractiveToken != nil {
-		transfer.InteractiveToken = *update.InteractiveToken
-	}
-	if update.InteractiveURL != nil {
-		transfer.InteractiveURL = *update.InteractiveURL
-	}
-	if update.Message != nil {
-		transfer.Message = *update.Message
-	}
-	if update.Metadata != nil {
-		transfer.Metadata = update.Metadata
+	s.applyLocked(transfer, update)
+	return nil
+}
+
+// CompareAndUpdate applies partial updates only if the stored transfer's
+// Version equals expectedVersion.
+// Returns a *stellarconnect.VersionConflictError if the versions differ, or
+// an error if the transfer does not exist.
+func (s *TransferStore) CompareAndUpdate(ctx context.Context, id string, expectedVersion int64, update *stellarconnect.TransferUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.compareAndUpdateLocked(id, expectedVersion, update)
+	return err
+}
+
+// compareAndUpdateLocked applies the update if the version matches; an
+// expectedVersion of zero skips the check. Returns the stored transfer.
+// The caller must hold the write lock.
+func (s *TransferStore) compareAndUpdateLocked(id string, expectedVersion int64, update *stellarconnect.TransferUpdate) (*stellarconnect.Transfer, error) {
+	transfer, exists := s.transfers[id]
+	if !exists {
+		return nil, errors.New("transfer not found")
 	}
-	if update.CompletedAt != nil {
-		transfer.CompletedAt = update.CompletedAt
+	if expectedVersion != 0 && transfer.Version != expectedVersion {
+		return nil, &stellarconnect.VersionConflictError{
+			TransferID: id,
+			Expected:   expectedVersion,
+			Actual:     transfer.Version,
+		}
 	}
 
-	// Always update UpdatedAt to current time
-	transfer.UpdatedAt = time.Now()
+	s.applyLocked(transfer, update)
+	return transfer, nil
+}
 
-	return nil
+// applyLocked applies the update and keeps the external reference index in
+// step with it. The caller must hold the write lock.
+func (s *TransferStore) applyLocked(transfer *stellarconnect.Transfer, update *stellarconnect.TransferUpdate) {
+	if update.ExternalRef != nil && *update.ExternalRef != transfer.ExternalRef {
+		if s.refs[transfer.ExternalRef] == transfer.ID {
+			delete(s.refs, transfer.ExternalRef)
+		}
+		if *update.ExternalRef != "" {
+			s.refs[*update.ExternalRef] = transfer.ID
+		}
+	}
+	storeutil.ApplyUpdate(transfer, update)
 }
 
 // List returns transfers matching the given filters.
@@ -142,8 +251,14 @@ func (s *TransferStore) List(ctx context.Context, filters stellarconnect.Transfe
 		if filters.Kind != nil && transfer.Kind != *filters.Kind {
 			continue
 		}
+		if !filters.CreatedAfter.IsZero() && transfer.CreatedAt.Before(filters.CreatedAfter) {
+			continue
+		}
+		if !filters.CreatedBefore.IsZero() && !transfer.CreatedAt.Before(filters.CreatedBefore) {
+			continue
+		}
 
-		result = append(result, transfer)
+		result = append(result, storeutil.CloneTransfer(transfer))
 	}
 
 	return result, nil
@@ -151,3 +266,15 @@ func (s *TransferStore) List(ctx context.Context, filters stellarconnect.Transfe
 
 // Verify that TransferStore implements stellarconnect.TransferStore
 var _ stellarconnect.TransferStore = (*TransferStore)(nil)
+
+// Verify that TransferStore implements stellarconnect.MemoTransferStore
+var _ stellarconnect.MemoTransferStore = (*TransferStore)(nil)
+
+// Verify that TransferStore implements stellarconnect.MuxedTransferStore
+var _ stellarconnect.MuxedTransferStore = (*TransferStore)(nil)
+
+// Verify that TransferStore implements stellarconnect.ExternalRefTransferStore
+var _ stellarconnect.ExternalRefTransferStore = (*TransferStore)(nil)
+
+// Verify that TransferStore implements stellarconnect.VersionedTransferStore
+var _ stellarconnect.VersionedTransferStore = (*TransferStore)(nil)
@@ -0,0 +1,417 @@
+// Package webhook receives signed webhooks from off-chain partners.
+//
+// A Receiver is an http.Handler that authenticates each request with a
+// Verifier (HMAC-SHA256 or Ed25519), rejects requests outside a timestamp
+// window, drops redelivered events by ID using a
+// stellarconnect.IdempotencyStore, and routes events by type to handlers,
+// optionally decoding their payload into a typed value with On. Handler
+// failures are answered with a 5xx status so the partner retries.
+package webhook
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	stellarconnect "github.com/marwen-abid/anchor-sdk-go"
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+)
+
+// Event is an authenticated webhook.
+type Event struct {
+	ID        string          // Partner's event ID; empty if it sends none
+	Type      string          // Event type used for routing
+	Timestamp time.Time       // Signed timestamp; zero without Config.TimestampHeader
+	Data      json.RawMessage // Event payload, decoded by On handlers
+	Header    http.Header
+	Body      []byte // Raw request body
+}
+
+// Parser extracts the event from an authenticated request body. It returns
+// (nil, nil) for requests that carry no event, such as pings.
+type Parser func(header http.Header, body []byte) (*Event, error)
+
+// HandlerFunc processes one event. Returning an error makes the partner
+// redeliver the event, unless the error is wrapped with Permanent.
+type HandlerFunc func(ctx context.Context, event *Event) error
+
+// Config configures a Receiver.
+type Config struct {
+	// Name identifies the partner in logs and deduplication keys.
+	Name string
+
+	// Verifier authenticates requests. Use Unverified only for local
+	// development.
+	Verifier Verifier
+
+	// Optional: extracts events from bodies (default: JSONEnvelope("id", "type", "data"))
+	Parser Parser
+
+	// Optional: header with the time the partner signed the request, as Unix
+	// seconds, Unix milliseconds, or RFC 3339. When set, requests without it
+	// or outside Tolerance are rejected, and the signed message is
+	// SignedMessage(timestamp, body).
+	TimestampHeader string
+
+	// Optional: accepted clock difference for TimestampHeader (default: 5m)
+	Tolerance time.Duration
+
+	// Optional: builds the signed message from the timestamp header value and
+	// the body (default: "<timestamp>.<body>")
+	SignedMessage func(timestamp string, body []byte) []byte
+
+	// Optional: records processed event IDs so redeliveries are acknowledged
+	// without running handlers again. Events without an ID are keyed by a
+	// hash of their body. nil disables deduplication.
+	Dedup stellarconnect.IdempotencyStore
+
+	// Optional: how long processed event IDs are remembered; should exceed
+	// the partner's retry window (default: 24h)
+	DedupTTL time.Duration
+
+	// Optional: how long an event being processed blocks its redeliveries
+	// (answered with 409) before one may run it again, e.g. after a crash
+	// (default: 1m)
+	DedupLease time.Duration
+
+	// Optional: largest accepted body (default: 1 MiB)
+	MaxBodyBytes int64
+}
+
+// Receiver is an http.Handler for one partner's webhooks. Register handlers
+// with Handle or On before serving requests.
+//
+// Responses:
+//
+//	401  signature or timestamp invalid
+//	400  body malformed, or payload does not decode into the On type
+//	409  the same event is being processed by another request
+//	413  body larger than MaxBodyBytes
+//	500  handler or deduplication store failed; the partner should retry
+//	200  processed, duplicate, unhandled type, or failed with Permanent
+type Receiver struct {
+	cfg      Config
+	handlers map[string]HandlerFunc
+	mu       sync.RWMutex
+}
+
+// NewReceiver creates a Receiver. Returns a CONFIG_INVALID error if Name or
+// Verifier is missing.
+func NewReceiver(cfg Config) (*Receiver, error) {
+	if cfg.Name == "" {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "webhook receiver name is required", nil)
+	}
+	if cfg.Verifier == nil {
+		return nil, errors.NewAnchorError(errors.CONFIG_INVALID, "webhook verifier is required", nil)
+	}
+	if cfg.Parser == nil {
+		cfg.Parser = JSONEnvelope("id", "type", "data")
+	}
+	if cfg.Tolerance <= 0 {
+		cfg.Tolerance = 5 * time.Minute
+	}
+	if cfg.SignedMessage == nil {
+		cfg.SignedMessage = func(timestamp string, body []byte) []byte {
+			return append([]byte(timestamp+"."), body...)
+		}
+	}
+	if cfg.DedupTTL <= 0 {
+		cfg.DedupTTL = 24 * time.Hour
+	}
+	if cfg.DedupLease <= 0 {
+		cfg.DedupLease = time.Minute
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = 1 << 20
+	}
+	return &Receiver{cfg: cfg, handlers: make(map[string]HandlerFunc)}, nil
+}
+
+// Handle registers fn for events of eventType, replacing any previous
+// handler. Events without a handler are acknowledged and ignored.
+func (r *Receiver) Handle(eventType string, fn HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.handlers[eventType] = fn
+}
+
+// On registers fn for events of eventType, decoding their Data into a T.
+// A payload that does not decode is answered with 400.
+func On[T any](r *Receiver, eventType string, fn func(ctx context.Context, event *Event, data T) error) {
+	r.Handle(eventType, func(ctx context.Context, event *Event) error {
+		var data T
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return errors.NewAnchorError(errors.WEBHOOK_PAYLOAD_INVALID, fmt.Sprintf("invalid %s payload", eventType), err)
+		}
+		return fn(ctx, event, data)
+	})
+}
+
+// permanentError marks a handler failure that redelivery cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps a handler error that redelivery cannot fix, such as an
+// event for an unknown transfer. The event is logged and acknowledged with
+// 200 so the partner stops retrying.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// ServeHTTP authenticates, deduplicates, and dispatches one webhook.
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(req.Body, r.cfg.MaxBodyBytes+1))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if int64(len(body)) > r.cfg.MaxBodyBytes {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	timestamp, message, err := r.signedMessage(req.Header, body)
+	if err == nil {
+		err = r.cfg.Verifier.Verify(req.Header, message)
+	}
+	if err != nil {
+		switch code(err) {
+		case errors.WEBHOOK_SIGNATURE_INVALID, errors.WEBHOOK_TIMESTAMP_INVALID:
+			log.Printf("%s webhook: rejected: %v", r.cfg.Name, err)
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+		default:
+			log.Printf("%s webhook: verification failed: %v", r.cfg.Name, err)
+			http.Error(w, "verification failed", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	event, err := r.cfg.Parser(req.Header, body)
+	if err != nil {
+		log.Printf("%s webhook: invalid payload: %v", r.cfg.Name, err)
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if event == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	event.Timestamp = timestamp
+	event.Header = req.Header
+	event.Body = body
+
+	r.mu.RLock()
+	handler, ok := r.handlers[event.Type]
+	r.mu.RUnlock()
+	if !ok {
+		log.Printf("%s webhook: ignoring %q event %s", r.cfg.Name, event.Type, event.ID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	ctx := req.Context()
+	key, fingerprint := r.dedupKey(event)
+	if r.cfg.Dedup != nil {
+		existing, reserved, err := r.cfg.Dedup.Reserve(ctx, key, fingerprint, time.Now().Add(r.cfg.DedupLease))
+		if err != nil {
+			log.Printf("%s webhook: dedup store failed for event %s: %v", r.cfg.Name, event.ID, err)
+			http.Error(w, "failed to record event", http.StatusInternalServerError)
+			return
+		}
+		if !reserved {
+			if existing != nil && existing.CompletedAt != nil {
+				// Already processed; acknowledge the redelivery.
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			http.Error(w, "event is being processed", http.StatusConflict)
+			return
+		}
+	}
+
+	err = r.dispatch(ctx, handler, event)
+	var permanent *permanentError
+	switch {
+	case err == nil:
+	case code(err) == errors.WEBHOOK_PAYLOAD_INVALID:
+		r.release(ctx, key)
+		log.Printf("%s webhook: %s event %s: %v", r.cfg.Name, event.Type, event.ID, err)
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	case asPermanent(err, &permanent):
+		// Redelivery will not help; acknowledge it.
+		log.Printf("%s webhook: %s event %s: %v", r.cfg.Name, event.Type, event.ID, permanent.err)
+	default:
+		r.release(ctx, key)
+		log.Printf("%s webhook: %s event %s: %v", r.cfg.Name, event.Type, event.ID, err)
+		http.Error(w, "failed to process event", http.StatusInternalServerError)
+		return
+	}
+
+	if r.cfg.Dedup != nil {
+		if err := r.cfg.Dedup.Complete(ctx, key, event.ID, time.Now().Add(r.cfg.DedupTTL)); err != nil {
+			log.Printf("%s webhook: failed to record event %s as processed: %v", r.cfg.Name, event.ID, err)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// dispatch runs handler, turning a panic into an error.
+func (r *Receiver) dispatch(ctx context.Context, handler HandlerFunc, event *Event) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("handler panicked: %v", p)
+		}
+	}()
+	return handler(ctx, event)
+}
+
+// signedMessage checks the timestamp header, if configured, and returns the
+// message the partner signed.
+func (r *Receiver) signedMessage(header http.Header, body []byte) (time.Time, []byte, error) {
+	if r.cfg.TimestampHeader == "" {
+		return time.Time{}, body, nil
+	}
+	value := header.Get(r.cfg.TimestampHeader)
+	if value == "" {
+		return time.Time{}, nil, errors.NewAnchorError(errors.WEBHOOK_TIMESTAMP_INVALID, "missing "+r.cfg.TimestampHeader+" header", nil)
+	}
+	timestamp, err := parseTimestamp(value)
+	if err != nil {
+		return time.Time{}, nil, errors.NewAnchorError(errors.WEBHOOK_TIMESTAMP_INVALID, "malformed "+r.cfg.TimestampHeader+" header", err)
+	}
+	if age := time.Since(timestamp); age > r.cfg.Tolerance || age < -r.cfg.Tolerance {
+		return time.Time{}, nil, errors.NewAnchorError(errors.WEBHOOK_TIMESTAMP_INVALID,
+			fmt.Sprintf("timestamp %s is outside the %s tolerance", timestamp.UTC().Format(time.RFC3339), r.cfg.Tolerance), nil)
+	}
+	return timestamp, r.cfg.SignedMessage(value, body), nil
+}
+
+// dedupKey returns the deduplication key of an event and the fingerprint
+// stored with it.
+func (r *Receiver) dedupKey(event *Event) (key, fingerprint string) {
+	sum := sha256.Sum256(event.Body)
+	fingerprint = hex.EncodeToString(sum[:])
+	if event.ID != "" {
+		return "webhook:" + r.cfg.Name + ":" + event.ID, fingerprint
+	}
+	return "webhook:" + r.cfg.Name + ":sha256:" + fingerprint, fingerprint
+}
+
+// release forgets an event that failed so that its redelivery is processed.
+func (r *Receiver) release(ctx context.Context, key string) {
+	if r.cfg.Dedup == nil {
+		return
+	}
+	if err := r.cfg.Dedup.Release(ctx, key); err != nil {
+		log.Printf("%s webhook: failed to release %s: %v", r.cfg.Name, key, err)
+	}
+}
+
+// JSONEnvelope parses bodies of the form {"<idField>": ..., "<typeField>":
+// ..., "<dataField>": {...}}. With an empty dataField, Data is the whole body.
+func JSONEnvelope(idField, typeField, dataField string) Parser {
+	return func(header http.Header, body []byte) (*Event, error) {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return nil, err
+		}
+		event := &Event{Data: body}
+		var err error
+		if event.ID, err = stringField(fields, idField); err != nil {
+			return nil, err
+		}
+		if event.Type, err = stringField(fields, typeField); err != nil {
+			return nil, err
+		}
+		if event.Type == "" {
+			return nil, fmt.Errorf("missing %q field", typeField)
+		}
+		if dataField != "" {
+			event.Data = fields[dataField]
+		}
+		return event, nil
+	}
+}
+
+// KeyedJSON parses bodies whose single top-level key is the event type and
+// whose value is the payload, e.g. {"order_updated": {...}}. Such events
+// have no ID and are deduplicated by body.
+func KeyedJSON() Parser {
+	return func(header http.Header, body []byte) (*Event, error) {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return nil, err
+		}
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("expected one top-level key, got %d", len(fields))
+		}
+		for eventType, data := range fields {
+			return &Event{Type: eventType, Data: data}, nil
+		}
+		return nil, nil
+	}
+}
+
+// stringField reads a string or number field; a missing field is "".
+func stringField(fields map[string]json.RawMessage, name string) (string, error) {
+	raw, ok := fields[name]
+	if !ok || name == "" {
+		return "", nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return "", fmt.Errorf("field %q is not a string or number", name)
+	}
+	return n.String(), nil
+}
+
+// parseTimestamp parses Unix seconds, Unix milliseconds, or RFC 3339.
+func parseTimestamp(value string) (time.Time, error) {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if n > 1e12 {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// code returns the code of an SDK error, or "" for other errors.
+func code(err error) errors.Code {
+	var sdkErr *errors.StellarConnectError
+	if errors.As(err, &sdkErr) {
+		return sdkErr.Code
+	}
+	return ""
+}
+
+// asPermanent reports whether err, or an error it wraps, was wrapped with
+// Permanent.
+func asPermanent(err error, target **permanentError) bool {
+	return stderrors.As(err, target)
+}
+
+// Verify that Receiver implements http.Handler
+var _ http.Handler = (*Receiver)(nil)
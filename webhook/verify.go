@@ -0,0 +1,125 @@
+package webhook
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/marwen-abid/anchor-sdk-go/errors"
+)
+
+// Verifier authenticates a webhook. message is what the partner signed:
+// the body, or the timestamp and body when Config.TimestampHeader is set.
+// Verify returns a WEBHOOK_SIGNATURE_INVALID error if the signature does
+// not match.
+type Verifier interface {
+	Verify(header http.Header, message []byte) error
+}
+
+// Encoding is how a signature is written in its header.
+type Encoding int
+
+const (
+	// Hex is lowercase or uppercase hexadecimal.
+	Hex Encoding = iota
+
+	// Base64 is standard base64 with padding.
+	Base64
+)
+
+// HMACSHA256 verifies an HMAC-SHA256 signature of the message keyed with a
+// shared secret.
+type HMACSHA256 struct {
+	Secret   []byte
+	Header   string   // Header carrying the signature, e.g. "X-Signature"
+	Encoding Encoding // Optional: Hex or Base64 (default: Hex)
+	Prefix   string   // Optional: stripped from the header value, e.g. "sha256="
+}
+
+// Verify checks the signature in v.Header against message.
+func (v HMACSHA256) Verify(header http.Header, message []byte) error {
+	if len(v.Secret) == 0 {
+		return errors.NewAnchorError(errors.CONFIG_INVALID, "HMAC secret is empty", nil)
+	}
+	signature, err := decodeSignature(header, v.Header, v.Prefix, v.Encoding)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, v.Secret)
+	mac.Write(message)
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return errors.NewAnchorError(errors.WEBHOOK_SIGNATURE_INVALID, "webhook signature does not match", nil)
+	}
+	return nil
+}
+
+// Ed25519 verifies an Ed25519 signature of the message made with the
+// partner's private key.
+type Ed25519 struct {
+	PublicKey ed25519.PublicKey
+	Header    string   // Header carrying the signature
+	Encoding  Encoding // Optional: Hex or Base64 (default: Hex)
+	Prefix    string   // Optional: stripped from the header value
+}
+
+// Verify checks the signature in v.Header against message.
+func (v Ed25519) Verify(header http.Header, message []byte) error {
+	if len(v.PublicKey) != ed25519.PublicKeySize {
+		return errors.NewAnchorError(errors.CONFIG_INVALID, "invalid Ed25519 public key", nil)
+	}
+	signature, err := decodeSignature(header, v.Header, v.Prefix, v.Encoding)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(v.PublicKey, message, signature) {
+		return errors.NewAnchorError(errors.WEBHOOK_SIGNATURE_INVALID, "webhook signature does not match", nil)
+	}
+	return nil
+}
+
+// Unverified accepts every webhook. It is meant for local development
+// against partners that do not sign requests; never use it in production.
+var Unverified Verifier = unverified{}
+
+type unverified struct{}
+
+func (unverified) Verify(http.Header, []byte) error {
+	return nil
+}
+
+// decodeSignature reads the signature from the named header.
+func decodeSignature(header http.Header, name, prefix string, encoding Encoding) ([]byte, error) {
+	value := strings.TrimSpace(header.Get(name))
+	if value == "" {
+		return nil, errors.NewAnchorError(errors.WEBHOOK_SIGNATURE_INVALID, "missing "+name+" header", nil)
+	}
+	if prefix != "" {
+		var ok bool
+		if value, ok = strings.CutPrefix(value, prefix); !ok {
+			return nil, errors.NewAnchorError(errors.WEBHOOK_SIGNATURE_INVALID, name+" header has no "+prefix+" prefix", nil)
+		}
+	}
+
+	var signature []byte
+	var err error
+	switch encoding {
+	case Base64:
+		signature, err = base64.StdEncoding.DecodeString(value)
+	default:
+		signature, err = hex.DecodeString(value)
+	}
+	if err != nil {
+		return nil, errors.NewAnchorError(errors.WEBHOOK_SIGNATURE_INVALID, "malformed "+name+" header", err)
+	}
+	return signature, nil
+}
+
+// Verify that the verifiers implement Verifier
+var (
+	_ Verifier = HMACSHA256{}
+	_ Verifier = Ed25519{}
+)